@@ -3,10 +3,14 @@ package elastic
 import (
 	"bytes"
 	crand "crypto/rand"
+	"io"
 	"math/rand"
+	"net"
 	"runtime"
 	"testing"
 
+	"go-pkg/buffer/ring"
+
 	"github.com/stretchr/testify/require"
 )
 
@@ -187,3 +191,99 @@ func TestMixedBuffer_WriteTo(t *testing.T) {
 	require.NotNil(t, mb.ringBuffer)
 	require.True(t, mb.IsEmpty())
 }
+
+func TestMixedBuffer_MaxBytes(t *testing.T) {
+	const maxStaticSize = 1024
+	mb, _ := New(maxStaticSize)
+	defer mb.Release()
+	mb.SetMaxBytes(4 * 1024)
+
+	data := make([]byte, 5*1024)
+	_, err := crand.Read(data)
+	require.NoError(t, err)
+	n, err := mb.Write(data)
+	require.ErrorIs(t, err, ring.ErrBufferFull)
+	require.EqualValues(t, 4*1024, n)
+	require.EqualValues(t, 4*1024, mb.Buffered())
+
+	n, err = mb.Writev([][]byte{data[:10]})
+	require.ErrorIs(t, err, ring.ErrBufferFull)
+	require.Zero(t, n)
+
+	_, _ = mb.Discard(1024)
+	n, err = mb.Writev([][]byte{data[:512], data[512:2048]})
+	require.ErrorIs(t, err, ring.ErrBufferFull)
+	require.EqualValues(t, 1024, n)
+
+	var buf bytes.Buffer
+	m, err := mb.WriteTo(&buf)
+	require.NoError(t, err)
+	require.EqualValues(t, 4*1024, m)
+	require.EqualValues(t, append(data[1024:4*1024:4*1024], data[:1024]...), buf.Bytes())
+
+	m, err = mb.ReadFrom(bytes.NewReader(data))
+	require.ErrorIs(t, err, ring.ErrBufferFull)
+	require.EqualValues(t, 4*1024, m)
+	require.EqualValues(t, 4*1024, mb.Buffered())
+}
+
+func TestMixedBuffer_Watermark(t *testing.T) {
+	var highs, lows int
+	mb, _ := New(1024)
+	defer mb.Release()
+	mb.SetWatermark(2048, 512, func() { highs++ }, func() { lows++ })
+
+	_, _ = mb.Write(make([]byte, 1024))
+	require.Zero(t, highs)
+	_, _ = mb.Writev([][]byte{make([]byte, 512), make([]byte, 1024)})
+	require.EqualValues(t, 1, highs)
+
+	_, _ = mb.Discard(1024)
+	require.Zero(t, lows)
+	_, _ = mb.Read(make([]byte, 1024))
+	require.EqualValues(t, 1, lows)
+
+	_, _ = mb.ReadFrom(bytes.NewReader(make([]byte, 4096)))
+	require.EqualValues(t, 2, highs)
+	mb.Reset(-1)
+	require.EqualValues(t, 2, lows)
+}
+
+func TestMixedBuffer_WriteToVectored(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	received := make(chan []byte, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			received <- nil
+			return
+		}
+		defer conn.Close()
+		b, _ := io.ReadAll(conn)
+		received <- b
+	}()
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+
+	const maxStaticSize = 4 * 1024
+	mb, _ := New(maxStaticSize)
+	defer mb.Release()
+	var buf bytes.Buffer
+	for i := 0; i < 50; i++ {
+		data := make([]byte, rand.Intn(1024)+128)
+		_, err := crand.Read(data)
+		require.NoError(t, err)
+		_, _ = mb.Write(data)
+		buf.Write(data)
+	}
+	require.False(t, mb.listBuffer.IsEmpty())
+
+	n, err := mb.WriteToVectored(conn)
+	require.NoError(t, err)
+	require.EqualValues(t, buf.Len(), n)
+	require.True(t, mb.IsEmpty())
+	require.NoError(t, conn.Close())
+	require.EqualValues(t, buf.Bytes(), <-received)
+}
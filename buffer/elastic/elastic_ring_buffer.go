@@ -4,36 +4,57 @@ package elastic
 import (
 	"go-pkg/buffer/ring"
 	"io"
+	"net"
 
 	rbPool "go-pkg/pool/ring_buffer"
 )
 
 // RingBuffer is the elastic wrapper of ring.Buffer.
 type RingBuffer struct {
-	rb *ring.Buffer
+	rb    *ring.Buffer
+	alloc ring.Allocator
 }
 
 func (b *RingBuffer) instance() *ring.Buffer {
 	if b.rb == nil {
 		b.rb = rbPool.Get()
+		b.rb.SetAllocator(b.alloc)
 	}
 
 	return b.rb
 }
 
+// SetAllocator sets the allocator of the underlying buffers of the internal ring-buffer,
+// e.g. byte_slice.DefaultLargePool() for large transfers. nil means the built-in byte_slice pool.
+func (b *RingBuffer) SetAllocator(alloc ring.Allocator) {
+	b.alloc = alloc
+	if b.rb != nil {
+		b.rb.SetAllocator(alloc)
+	}
+}
+
 // Done checks and returns the internal ring-buffer to pool.
 func (b *RingBuffer) Done() {
 	if b.rb != nil {
-		rbPool.Put(b.rb)
-		b.rb = nil
+		b.put()
 	}
 }
 
 func (b *RingBuffer) done() {
 	if b.rb != nil && b.rb.IsEmpty() {
-		rbPool.Put(b.rb)
-		b.rb = nil
+		b.put()
+	}
+}
+
+// put returns the internal ring-buffer to pool, the underlying buffer of a custom allocator
+// is given back to it first so that it doesn't leak into the pool.
+func (b *RingBuffer) put() {
+	if b.alloc != nil {
+		b.rb.Release()
+		b.rb.SetAllocator(nil)
 	}
+	rbPool.Put(b.rb)
+	b.rb = nil
 }
 
 // Peek returns the next n bytes without advancing the read pointer,
@@ -166,6 +187,16 @@ func (b *RingBuffer) WriteTo(w io.Writer) (int64, error) {
 	return b.instance().WriteTo(w)
 }
 
+// WriteToVectored writes all buffered bytes to conn with a single vectored write (writev), see ring.Buffer.
+func (b *RingBuffer) WriteToVectored(conn net.Conn) (int64, error) {
+	if b.rb == nil {
+		return 0, ring.ErrIsEmpty
+	}
+
+	defer b.done()
+	return b.rb.WriteToVectored(conn)
+}
+
 // IsFull tells if this ring-buffer is full.
 func (b *RingBuffer) IsFull() bool {
 	if b.rb == nil {
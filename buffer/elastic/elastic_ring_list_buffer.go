@@ -4,8 +4,10 @@ import (
 	"errors"
 	"io"
 	"math"
+	"net"
 
 	"go-pkg/buffer/linked_list"
+	"go-pkg/buffer/ring"
 )
 
 // Buffer combines ring-buffer and list-buffer.
@@ -14,8 +16,15 @@ import (
 // flexible and scalable, which helps the application reduce memory footprint.
 type Buffer struct {
 	maxStaticBytes int
+	maxBytes       int // hard limit of buffered bytes, 0 means unlimited
 	ringBuffer     RingBuffer
 	listBuffer     linked_list.Buffer
+
+	highWater int
+	lowWater  int
+	onHigh    func()
+	onLow     func()
+	aboveHigh bool
 }
 
 // New instantiates an elastic.Buffer and returns it.
@@ -26,8 +35,43 @@ func New(maxStaticBytes int) (*Buffer, error) {
 	return &Buffer{maxStaticBytes: maxStaticBytes}, nil
 }
 
+// SetMaxBytes sets the hard limit of buffered bytes, writes that do not fit return ring.ErrBufferFull
+// after writing as much as possible. A value <= 0 removes the limit.
+func (mb *Buffer) SetMaxBytes(maxBytes int) {
+	if maxBytes < 0 {
+		maxBytes = 0
+	}
+	mb.maxBytes = maxBytes
+}
+
+// SetAllocator sets the allocator of the underlying buffers of the ring-buffer,
+// e.g. byte_slice.DefaultLargePool() for large transfers. nil means the built-in byte_slice pool.
+func (mb *Buffer) SetAllocator(alloc ring.Allocator) {
+	mb.ringBuffer.SetAllocator(alloc)
+}
+
+// SetWatermark registers callbacks for backpressure: onHigh is invoked once the buffered bytes reach high,
+// onLow is invoked once they drop to low or below afterwards.
+// A high <= 0 disables the watermark callbacks.
+func (mb *Buffer) SetWatermark(high, low int, onHigh, onLow func()) {
+	if high <= 0 {
+		mb.highWater, mb.lowWater = 0, 0
+		mb.onHigh, mb.onLow = nil, nil
+		mb.aboveHigh = false
+		return
+	}
+	if low > high {
+		low = high
+	}
+	mb.highWater, mb.lowWater = high, low
+	mb.onHigh, mb.onLow = onHigh, onLow
+	mb.aboveHigh = false
+	mb.checkHighWater()
+}
+
 // Read reads data from the Buffer.
 func (mb *Buffer) Read(p []byte) (n int, err error) {
+	defer mb.checkLowWater()
 	n, err = mb.ringBuffer.Read(p)
 	if n == len(p) {
 		return n, err
@@ -54,6 +98,7 @@ func (mb *Buffer) Peek(n int) ([][]byte, error) {
 
 // Discard discards n bytes in this buffer.
 func (mb *Buffer) Discard(n int) (discarded int, err error) {
+	defer mb.checkLowWater()
 	discarded, err = mb.ringBuffer.Discard(n)
 	if n <= discarded {
 		return
@@ -67,7 +112,20 @@ func (mb *Buffer) Discard(n int) (discarded int, err error) {
 }
 
 // Write appends data to this buffer.
+// When the max bytes limit is reached it writes as much as possible and returns ring.ErrBufferFull.
 func (mb *Buffer) Write(p []byte) (n int, err error) {
+	if free := mb.free(); len(p) > free {
+		p, err = p[:free], ring.ErrBufferFull
+	}
+	n, _ = mb.write(p)
+	mb.checkHighWater()
+	return
+}
+
+func (mb *Buffer) write(p []byte) (n int, err error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
 	if !mb.listBuffer.IsEmpty() || mb.ringBuffer.Buffered() >= mb.maxStaticBytes {
 		mb.listBuffer.PushBack(p)
 		return len(p), nil
@@ -84,7 +142,24 @@ func (mb *Buffer) Write(p []byte) (n int, err error) {
 }
 
 // Writev appends multiple byte slices to this buffer.
-func (mb *Buffer) Writev(bs [][]byte) (int, error) {
+// When the max bytes limit is reached it writes as much as possible and returns ring.ErrBufferFull.
+func (mb *Buffer) Writev(bs [][]byte) (n int, err error) {
+	if free := mb.free(); free < math.MaxInt32 {
+		for i, b := range bs {
+			if len(b) > free {
+				bs = append(bs[:i:i], b[:free])
+				err = ring.ErrBufferFull
+				break
+			}
+			free -= len(b)
+		}
+	}
+	n, _ = mb.writev(bs)
+	mb.checkHighWater()
+	return
+}
+
+func (mb *Buffer) writev(bs [][]byte) (int, error) {
 	if !mb.listBuffer.IsEmpty() || mb.ringBuffer.Buffered() >= mb.maxStaticBytes {
 		var n int
 		for _, b := range bs {
@@ -118,7 +193,23 @@ func (mb *Buffer) Writev(bs [][]byte) (int, error) {
 }
 
 // ReadFrom implements io.ReaderFrom.
-func (mb *Buffer) ReadFrom(r io.Reader) (int64, error) {
+// It stops with ring.ErrBufferFull once the max bytes limit is reached.
+func (mb *Buffer) ReadFrom(r io.Reader) (n int64, err error) {
+	defer mb.checkHighWater()
+	free := mb.free()
+	if free == math.MaxInt32 {
+		return mb.readFrom(r)
+	}
+	if free == 0 {
+		return 0, ring.ErrBufferFull
+	}
+	if n, err = mb.readFrom(io.LimitReader(r, int64(free))); err == nil && n == int64(free) {
+		err = ring.ErrBufferFull
+	}
+	return
+}
+
+func (mb *Buffer) readFrom(r io.Reader) (int64, error) {
 	if !mb.listBuffer.IsEmpty() || mb.ringBuffer.Buffered() >= mb.maxStaticBytes {
 		return mb.listBuffer.ReadFrom(r)
 	}
@@ -127,6 +218,7 @@ func (mb *Buffer) ReadFrom(r io.Reader) (int64, error) {
 
 // WriteTo implements io.WriterTo.
 func (mb *Buffer) WriteTo(w io.Writer) (n int64, err error) {
+	defer mb.checkLowWater()
 	if n, err = mb.ringBuffer.WriteTo(w); err != nil {
 		return
 	}
@@ -136,6 +228,20 @@ func (mb *Buffer) WriteTo(w io.Writer) (n int64, err error) {
 	return
 }
 
+// WriteToVectored writes all buffered bytes of both the ring-buffer and the list-buffer to conn
+// with vectored writes (writev) when conn supports it, without copying them.
+func (mb *Buffer) WriteToVectored(conn net.Conn) (n int64, err error) {
+	if mb.IsEmpty() {
+		return
+	}
+
+	bs, _ := mb.Peek(-1)
+	bufs := net.Buffers(bs)
+	n, err = bufs.WriteTo(conn)
+	_, _ = mb.Discard(int(n))
+	return
+}
+
 // Buffered returns the number of bytes that can be read from the current buffer.
 func (mb *Buffer) Buffered() int {
 	return mb.ringBuffer.Buffered() + mb.listBuffer.Buffered()
@@ -153,10 +259,46 @@ func (mb *Buffer) Reset(maxStaticBytes int) {
 	if maxStaticBytes > 0 {
 		mb.maxStaticBytes = maxStaticBytes
 	}
+	mb.checkLowWater()
 }
 
 // Release frees all resource of this buffer.
 func (mb *Buffer) Release() {
 	mb.ringBuffer.Done()
 	mb.listBuffer.Reset()
+	mb.checkLowWater()
+}
+
+// free returns the number of bytes that can still be written before hitting the max bytes limit,
+// or math.MaxInt32 if there is no limit.
+func (mb *Buffer) free() int {
+	if mb.maxBytes <= 0 {
+		return math.MaxInt32
+	}
+	if free := mb.maxBytes - mb.Buffered(); free > 0 {
+		return free
+	}
+	return 0
+}
+
+// checkHighWater fires onHigh when the buffered bytes reach the high watermark.
+func (mb *Buffer) checkHighWater() {
+	if mb.highWater <= 0 || mb.aboveHigh || mb.Buffered() < mb.highWater {
+		return
+	}
+	mb.aboveHigh = true
+	if mb.onHigh != nil {
+		mb.onHigh()
+	}
+}
+
+// checkLowWater fires onLow when the buffered bytes drop to the low watermark after reaching the high one.
+func (mb *Buffer) checkLowWater() {
+	if !mb.aboveHigh || mb.Buffered() > mb.lowWater {
+		return
+	}
+	mb.aboveHigh = false
+	if mb.onLow != nil {
+		mb.onLow()
+	}
 }
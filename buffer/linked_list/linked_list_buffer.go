@@ -2,8 +2,10 @@
 package linked_list
 
 import (
+	"bytes"
 	"io"
 	"math"
+	"net"
 
 	bsPool "go-pkg/pool/byte_slice"
 )
@@ -158,6 +160,76 @@ func (llb *Buffer) PeekWithBytes(maxBytes int, bs ...[]byte) ([][]byte, error) {
 	return bss, nil
 }
 
+// IndexByte returns the index of the first instance of c in the buffered bytes of l,
+// or -1 if c is not present.
+func (llb *Buffer) IndexByte(c byte) int {
+	var cum int
+	for iter := llb.head; iter != nil; iter = iter.next {
+		if i := bytes.IndexByte(iter.buf, c); i >= 0 {
+			return cum + i
+		}
+		cum += iter.len()
+	}
+	return -1
+}
+
+// ReadN removes and returns the next n bytes of l, it returns io.ErrShortBuffer without reading anything
+// if fewer than n bytes are buffered.
+// The bytes are not copied unless they span multiple nodes, release must be called once the caller is done
+// with them, p mustn't be touched after that.
+func (llb *Buffer) ReadN(n int) (p []byte, release func(), err error) {
+	if n <= 0 {
+		return nil, noop, nil
+	}
+	if n > llb.bytes {
+		return nil, noop, io.ErrShortBuffer
+	}
+
+	b := llb.head
+	if n < b.len() {
+		// The rest of the node goes back to the pool starting after p, so p stays untouched.
+		p = b.buf[:n:n]
+		b.buf = b.buf[n:]
+		llb.bytes -= n
+		return p, noop, nil
+	}
+	if n == b.len() {
+		llb.pop()
+		return b.buf, func() { bsPool.Put(b.buf) }, nil
+	}
+
+	p = bsPool.Get(n)
+	_, _ = llb.Read(p)
+	return p, func() { bsPool.Put(p) }, nil
+}
+
+// ReadUntil removes and returns the bytes of l up to and including the first instance of delim,
+// it returns io.ErrShortBuffer without reading anything if delim is not present.
+// See ReadN for the semantics of release.
+func (llb *Buffer) ReadUntil(delim byte) (p []byte, release func(), err error) {
+	i := llb.IndexByte(delim)
+	if i < 0 {
+		return nil, noop, io.ErrShortBuffer
+	}
+	return llb.ReadN(i + 1)
+}
+
+// ReadLine removes and returns the next line of l without the trailing "\n" or "\r\n",
+// it returns io.ErrShortBuffer without reading anything if there is no complete line.
+// See ReadN for the semantics of release.
+func (llb *Buffer) ReadLine() (line []byte, release func(), err error) {
+	if line, release, err = llb.ReadUntil('\n'); err != nil {
+		return
+	}
+	line = line[:len(line)-1]
+	if n := len(line); n > 0 && line[n-1] == '\r' {
+		line = line[:n-1]
+	}
+	return
+}
+
+func noop() {}
+
 // Discard removes some nodes based on n bytes.
 func (llb *Buffer) Discard(n int) (discarded int, err error) {
 	if n <= 0 {
@@ -228,6 +300,21 @@ func (llb *Buffer) WriteTo(w io.Writer) (n int64, err error) {
 	return
 }
 
+// WriteToVectored writes all buffered nodes to conn with vectored writes (writev) when conn supports it,
+// without copying them. Fully written nodes are returned to the pool and a partially written node keeps
+// its unwritten bytes at the head of l.
+func (llb *Buffer) WriteToVectored(conn net.Conn) (n int64, err error) {
+	if llb.IsEmpty() {
+		return
+	}
+
+	bs, _ := llb.Peek(-1)
+	bufs := net.Buffers(bs)
+	n, err = bufs.WriteTo(conn)
+	_, _ = llb.Discard(int(n))
+	return
+}
+
 // Len returns the length of the list.
 func (llb *Buffer) Len() int {
 	return llb.size
@@ -1,9 +1,13 @@
 package linked_list
 
 import (
+	"bufio"
 	"bytes"
 	crand "crypto/rand"
+	"io"
 	"math/rand"
+	"net"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -154,3 +158,141 @@ func TestLinkedListBuffer_WriteTo(t *testing.T) {
 	buf.Reset()
 	newBuf.Reset()
 }
+
+func TestLinkedListBuffer_WriteToVectored(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	received := make(chan []byte, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			received <- nil
+			return
+		}
+		defer conn.Close()
+		b, _ := io.ReadAll(conn)
+		received <- b
+	}()
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+
+	const maxBlocks = 50
+	var (
+		llb Buffer
+		buf bytes.Buffer
+	)
+	for i := 0; i < maxBlocks; i++ {
+		data := make([]byte, rand.Intn(1024)+128)
+		_, err := crand.Read(data)
+		require.NoError(t, err)
+		llb.PushBack(data)
+		buf.Write(data)
+	}
+	n, err := llb.WriteToVectored(conn)
+	require.NoError(t, err)
+	require.EqualValues(t, buf.Len(), n)
+	require.True(t, llb.IsEmpty())
+	require.Zero(t, llb.Len())
+	require.NoError(t, conn.Close())
+	require.EqualValues(t, buf.Bytes(), <-received)
+}
+
+func TestLinkedListBuffer_ReadN(t *testing.T) {
+	var llb Buffer
+	llb.PushBack([]byte("*2\r\n$3\r\nGET"))
+	llb.PushBack([]byte("\r\n$5\r\nhel"))
+	llb.PushBack([]byte("lo\r\n"))
+
+	require.EqualValues(t, 2, llb.IndexByte('\r'))
+	require.EqualValues(t, 14, llb.IndexByte('5'))
+	require.EqualValues(t, -1, llb.IndexByte('x'))
+
+	line, release, err := llb.ReadLine()
+	require.NoError(t, err)
+	require.EqualValues(t, "*2", line)
+	release()
+	line, release, err = llb.ReadLine()
+	require.NoError(t, err)
+	require.EqualValues(t, "$3", line)
+	release()
+
+	// the token straddles two nodes
+	line, release, err = llb.ReadUntil('\n')
+	require.NoError(t, err)
+	require.EqualValues(t, "GET\r\n", line)
+	release()
+	require.EqualValues(t, 2, llb.Len())
+
+	line, release, err = llb.ReadLine()
+	require.NoError(t, err)
+	require.EqualValues(t, "$5", line)
+	release()
+
+	_, _, err = llb.ReadN(llb.Buffered() + 1)
+	require.ErrorIs(t, err, io.ErrShortBuffer)
+	p, release, err := llb.ReadN(5)
+	require.NoError(t, err)
+	require.EqualValues(t, "hello", p)
+	release()
+
+	_, _, err = llb.ReadLine()
+	require.NoError(t, err)
+	require.True(t, llb.IsEmpty())
+	_, _, err = llb.ReadLine()
+	require.ErrorIs(t, err, io.ErrShortBuffer)
+}
+
+// bufioReader is the subset of *bufio.Reader methods implemented by Reader.
+type bufioReader interface {
+	io.Reader
+	io.ByteScanner
+	io.RuneScanner
+	io.WriterTo
+	Buffered() int
+	Peek(n int) ([]byte, error)
+	Discard(n int) (int, error)
+	ReadSlice(delim byte) ([]byte, error)
+	ReadLine() ([]byte, bool, error)
+	ReadBytes(delim byte) ([]byte, error)
+	ReadString(delim byte) (string, error)
+}
+
+var (
+	_ bufioReader = (*bufio.Reader)(nil)
+	_ bufioReader = (*Reader)(nil)
+)
+
+func TestReader(t *testing.T) {
+	const text = "GET / HTTP/1.1\r\nHost: héllo\r\n\r\nbody"
+	var llb Buffer
+	for i := 0; i < len(text); i += 3 {
+		llb.PushBack([]byte(text[i:min(i+3, len(text))]))
+	}
+
+	var r, br bufioReader = NewReader(&llb), bufio.NewReader(strings.NewReader(text))
+	for _, step := range []func(r bufioReader) (any, error){
+		func(r bufioReader) (any, error) { line, _, err := r.ReadLine(); return string(line), err },
+		func(r bufioReader) (any, error) { p, err := r.Peek(6); return string(p), err },
+		func(r bufioReader) (any, error) { return r.ReadString(' ') },
+		func(r bufioReader) (any, error) { b, err := r.ReadByte(); return b, err },
+		func(r bufioReader) (any, error) { return nil, r.UnreadByte() },
+		func(r bufioReader) (any, error) { return r.ReadBytes('h') },
+		func(r bufioReader) (any, error) { c, n, err := r.ReadRune(); return []any{c, n}, err },
+		func(r bufioReader) (any, error) { return nil, r.UnreadRune() },
+		func(r bufioReader) (any, error) { c, n, err := r.ReadRune(); return []any{c, n}, err },
+		func(r bufioReader) (any, error) { line, err := r.ReadSlice('\n'); return string(line), err },
+		func(r bufioReader) (any, error) { line, _, err := r.ReadLine(); return string(line), err },
+		func(r bufioReader) (any, error) { return r.Discard(1) },
+		func(r bufioReader) (any, error) { p, err := r.Peek(10); return string(p), err },
+		func(r bufioReader) (any, error) { line, _, err := r.ReadLine(); return string(line), err },
+		func(r bufioReader) (any, error) { line, _, err := r.ReadLine(); return string(line), err },
+		func(r bufioReader) (any, error) { return r.ReadByte() },
+	} {
+		want, wantErr := step(br)
+		got, gotErr := step(r)
+		require.EqualValues(t, want, got)
+		require.EqualValues(t, wantErr, gotErr)
+	}
+	require.True(t, llb.IsEmpty())
+}
@@ -0,0 +1,224 @@
+package linked_list
+
+import (
+	"bufio"
+	"io"
+	"unicode/utf8"
+)
+
+// Reader adapts Buffer to the method set of bufio.Reader, so parsers written against bufio.Reader
+// can consume a Buffer directly.
+// Like bufio.Reader, the slices returned by Peek, ReadSlice and ReadLine are only valid until the next read,
+// they are not copied unless they span multiple nodes.
+type Reader struct {
+	llb          *Buffer
+	release      func() // frees the slice returned by the last read
+	scratch      []byte // holds peeked bytes spanning multiple nodes
+	lastByte     int
+	lastRuneSize int
+	lastRune     [utf8.UTFMax]byte
+}
+
+// NewReader returns a Reader reading from llb.
+func NewReader(llb *Buffer) *Reader {
+	return &Reader{llb: llb, lastByte: -1, lastRuneSize: -1}
+}
+
+// Buffered returns the number of bytes that can be read from the underlying Buffer.
+func (r *Reader) Buffered() int {
+	return r.llb.Buffered()
+}
+
+// Read reads data into p, it returns io.EOF when the underlying Buffer is empty.
+func (r *Reader) Read(p []byte) (n int, err error) {
+	r.free()
+	r.lastRuneSize = -1
+	n, err = r.llb.Read(p)
+	if n > 0 {
+		r.lastByte = int(p[n-1])
+	}
+	return
+}
+
+// ReadByte reads and returns a single byte, it returns io.EOF when the underlying Buffer is empty.
+func (r *Reader) ReadByte() (byte, error) {
+	r.free()
+	r.lastRuneSize = -1
+	h := r.llb.head
+	if h == nil {
+		return 0, io.EOF
+	}
+	c := h.buf[0]
+	_, _ = r.llb.Discard(1)
+	r.lastByte = int(c)
+	return c, nil
+}
+
+// UnreadByte unreads the last byte, only the most recently read byte can be unread.
+func (r *Reader) UnreadByte() error {
+	if r.lastByte < 0 {
+		return bufio.ErrInvalidUnreadByte
+	}
+	r.free()
+	r.llb.PushFront([]byte{byte(r.lastByte)})
+	r.lastByte = -1
+	r.lastRuneSize = -1
+	return nil
+}
+
+// ReadRune reads a single UTF-8 encoded Unicode character and returns the rune and its size in bytes.
+// If the encoded rune is invalid, it consumes one byte and returns unicode.ReplacementChar (U+FFFD) with a size of 1.
+func (r *Reader) ReadRune() (rn rune, size int, err error) {
+	r.free()
+	n := r.llb.Buffered()
+	if n == 0 {
+		r.lastByte, r.lastRuneSize = -1, -1
+		return 0, 0, io.EOF
+	}
+	if n > utf8.UTFMax {
+		n = utf8.UTFMax
+	}
+	p := r.peek(n)
+	rn, size = utf8.DecodeRune(p)
+	copy(r.lastRune[:], p[:size])
+	_, _ = r.llb.Discard(size)
+	r.lastByte = int(r.lastRune[size-1])
+	r.lastRuneSize = size
+	return
+}
+
+// UnreadRune unreads the last rune, it is only valid right after ReadRune.
+func (r *Reader) UnreadRune() error {
+	if r.lastRuneSize < 0 {
+		return bufio.ErrInvalidUnreadRune
+	}
+	r.free()
+	r.llb.PushFront(r.lastRune[:r.lastRuneSize])
+	r.lastByte = -1
+	r.lastRuneSize = -1
+	return nil
+}
+
+// Peek returns the next n bytes without advancing the reader.
+// If Peek returns fewer than n bytes, it also returns io.EOF.
+func (r *Reader) Peek(n int) ([]byte, error) {
+	if n < 0 {
+		return nil, bufio.ErrNegativeCount
+	}
+	r.lastByte, r.lastRuneSize = -1, -1
+
+	var err error
+	if b := r.llb.Buffered(); n > b {
+		n, err = b, io.EOF
+	}
+	return r.peek(n), err
+}
+
+// Discard skips the next n bytes, returning the number of bytes discarded.
+// If Discard skips fewer than n bytes, it also returns io.EOF.
+func (r *Reader) Discard(n int) (discarded int, err error) {
+	if n < 0 {
+		return 0, bufio.ErrNegativeCount
+	}
+	r.free()
+	r.lastByte, r.lastRuneSize = -1, -1
+
+	discarded, _ = r.llb.Discard(n)
+	if discarded < n {
+		err = io.EOF
+	}
+	return
+}
+
+// ReadSlice reads until the first occurrence of delim in the input, returning a slice pointing at the bytes.
+// If ReadSlice encounters the end of the underlying Buffer before finding delim, it returns all the bytes
+// and io.EOF.
+func (r *Reader) ReadSlice(delim byte) (line []byte, err error) {
+	n := r.llb.IndexByte(delim) + 1
+	if n == 0 {
+		if n, err = r.llb.Buffered(), io.EOF; n == 0 {
+			r.free()
+			r.lastByte, r.lastRuneSize = -1, -1
+			return nil, err
+		}
+	}
+	line = r.readN(n)
+	return
+}
+
+// ReadLine returns a single line, not including the end-of-line bytes.
+// The last line of the underlying Buffer is returned even if it is not terminated,
+// isPrefix is always false since lines are never longer than the buffered data.
+func (r *Reader) ReadLine() (line []byte, isPrefix bool, err error) {
+	line, err = r.ReadSlice('\n')
+	if len(line) == 0 {
+		return nil, false, err
+	}
+
+	if line[len(line)-1] == '\n' {
+		drop := 1
+		if len(line) > 1 && line[len(line)-2] == '\r' {
+			drop = 2
+		}
+		line = line[:len(line)-drop]
+	}
+	return line, false, nil
+}
+
+// ReadBytes reads until the first occurrence of delim in the input, returning a copy of the bytes.
+// If ReadBytes encounters the end of the underlying Buffer before finding delim, it returns all the bytes
+// and io.EOF.
+func (r *Reader) ReadBytes(delim byte) ([]byte, error) {
+	line, err := r.ReadSlice(delim)
+	if line == nil {
+		return nil, err
+	}
+	return append([]byte(nil), line...), err
+}
+
+// ReadString is like ReadBytes but returns a string.
+func (r *Reader) ReadString(delim byte) (string, error) {
+	line, err := r.ReadSlice(delim)
+	return string(line), err
+}
+
+// WriteTo implements io.WriterTo.
+func (r *Reader) WriteTo(w io.Writer) (int64, error) {
+	r.free()
+	r.lastByte, r.lastRuneSize = -1, -1
+	return r.llb.WriteTo(w)
+}
+
+// peek returns the next n bytes without advancing the reader, copying them into the scratch buffer
+// only if they span multiple nodes.
+func (r *Reader) peek(n int) []byte {
+	if n == 0 {
+		return nil
+	}
+	if h := r.llb.head; h.len() >= n {
+		return h.buf[:n:n]
+	}
+	bs, _ := r.llb.Peek(n)
+	r.scratch = r.scratch[:0]
+	for _, b := range bs {
+		r.scratch = append(r.scratch, b...)
+	}
+	return r.scratch
+}
+
+// readN removes the next n bytes, they stay valid until the next read.
+func (r *Reader) readN(n int) []byte {
+	r.free()
+	p, release, _ := r.llb.ReadN(n)
+	r.release = release
+	r.lastByte, r.lastRuneSize = int(p[n-1]), -1
+	return p
+}
+
+// free releases the slice returned by the last read.
+func (r *Reader) free() {
+	if r.release != nil {
+		r.release()
+		r.release = nil
+	}
+}
@@ -6,6 +6,9 @@ import (
 	"go-pkg/bs"
 	"go-pkg/math"
 	"io"
+	"net"
+	"sync"
+	"time"
 
 	bsPool "go-pkg/pool/byte_slice"
 )
@@ -21,8 +24,12 @@ const (
 	bufferGrowThreshold = 4 * 1024 // 4KB
 )
 
-// ErrIsEmpty will be returned when trying to read an empty ring-buffer.
-var ErrIsEmpty = errors.New("ring-buffer is empty")
+var (
+	// ErrIsEmpty will be returned when trying to read an empty ring-buffer.
+	ErrIsEmpty = errors.New("ring-buffer is empty")
+	// ErrBufferFull will be returned when a write would grow the ring-buffer beyond its max capacity.
+	ErrBufferFull = errors.New("ring-buffer is full")
+)
 
 // Buffer is a circular buffer that implement io.ReaderWriter interface.
 type Buffer struct {
@@ -32,6 +39,42 @@ type Buffer struct {
 	r       int // next position to read
 	w       int // next position to write
 	isEmpty bool
+
+	maxCap int // hard limit of size, 0 means unlimited
+
+	highWater int
+	lowWater  int
+	onHigh    func()
+	onLow     func()
+	aboveHigh bool
+
+	shrinkPolicy ShrinkPolicy
+	idleSince    time.Time // when the buffer was first seen mostly empty
+	busy         bool      // buffered bytes exceeded DefaultBufferSize since the last idle check
+	idleTimer    *time.Timer
+
+	alloc Allocator // nil means the built-in byte_slice pool
+}
+
+// Allocator provides the underlying buffers of a ring-buffer, e.g. *byte_slice.LargePool.
+type Allocator interface {
+	Get(size int) []byte
+	Put(buf []byte)
+}
+
+// ShrinkPolicy controls when a grown ring-buffer gives its backing array back to the pool and
+// drops to DefaultBufferSize. The buffer is considered mostly empty while its buffered bytes fit
+// in DefaultBufferSize.
+type ShrinkPolicy struct {
+	// IdleTimeout is how long the buffer must stay mostly empty before it shrinks, 0 disables it.
+	// The buffer checks it when it is drained, a buffer left partly full is only shrunk by the idle
+	// timer of Locker or by its owner calling TryShrink periodically.
+	IdleTimeout time.Duration
+	// Locker, if set, must guard every use of the buffer. An idle timer is then armed whenever the
+	// grown buffer gets mostly empty, and takes it to shrink the buffer in the background.
+	Locker sync.Locker
+	// OnReset shrinks the buffer every time Reset is called.
+	OnReset bool
 }
 
 // New returns a new Buffer whose buffer has the given size.
@@ -113,12 +156,47 @@ func (rb *Buffer) Discard(n int) (discarded int, err error) {
 	discarded = rb.Buffered()
 	if n < discarded {
 		rb.r = (rb.r + n) % rb.size
+		rb.afterRead()
 		return n, nil
 	}
-	rb.Reset()
+	rb.reset()
 	return
 }
 
+// SetMaxCap sets the hard limit of the underlying buffer size, the ring-buffer never grows beyond it
+// and writes that do not fit return ErrBufferFull after writing as much as possible.
+// A value <= 0 removes the limit.
+func (rb *Buffer) SetMaxCap(maxCap int) {
+	if maxCap < 0 {
+		maxCap = 0
+	}
+	rb.maxCap = maxCap
+}
+
+// MaxCap returns the hard limit of the underlying buffer size, 0 means unlimited.
+func (rb *Buffer) MaxCap() int {
+	return rb.maxCap
+}
+
+// SetWatermark registers callbacks for backpressure: onHigh is invoked once the buffered bytes reach high,
+// onLow is invoked once they drop to low or below afterwards.
+// A high <= 0 disables the watermark callbacks.
+func (rb *Buffer) SetWatermark(high, low int, onHigh, onLow func()) {
+	if high <= 0 {
+		rb.highWater, rb.lowWater = 0, 0
+		rb.onHigh, rb.onLow = nil, nil
+		rb.aboveHigh = false
+		return
+	}
+	if low > high {
+		low = high
+	}
+	rb.highWater, rb.lowWater = high, low
+	rb.onHigh, rb.onLow = onHigh, onLow
+	rb.aboveHigh = false
+	rb.checkHighWater()
+}
+
 // Read reads up to len(p) bytes into p. It returns the number of bytes read (0 <= n <= len(p)) and any error
 // encountered.
 // Even if Read returns n < len(p), it may use all of p as scratch space during the call.
@@ -147,8 +225,9 @@ func (rb *Buffer) Read(p []byte) (n int, err error) {
 		copy(p, rb.buf[rb.r:rb.r+n])
 		rb.r += n
 		if rb.r == rb.w {
-			rb.Reset()
+			rb.reset()
 		}
+		rb.afterRead()
 		return
 	}
 
@@ -167,8 +246,9 @@ func (rb *Buffer) Read(p []byte) (n int, err error) {
 	}
 	rb.r = (rb.r + n) % rb.size
 	if rb.r == rb.w {
-		rb.Reset()
+		rb.reset()
 	}
+	rb.afterRead()
 
 	return
 }
@@ -184,8 +264,9 @@ func (rb *Buffer) ReadByte() (b byte, err error) {
 		rb.r = 0
 	}
 	if rb.r == rb.w {
-		rb.Reset()
+		rb.reset()
 	}
+	rb.afterRead()
 
 	return
 }
@@ -194,7 +275,7 @@ func (rb *Buffer) ReadByte() (b byte, err error) {
 // It returns the number of bytes written from p (n == len(p) > 0) and any error encountered that caused the write to
 // stop early.
 // If the length of p is greater than the writable capacity of this ring-buffer, it will allocate more memory to
-// this ring-buffer.
+// this ring-buffer, when the max capacity is reached it writes as much as possible and returns ErrBufferFull.
 // Write must not modify the slice data, even temporarily.
 func (rb *Buffer) Write(p []byte) (n int, err error) {
 	n = len(p)
@@ -205,6 +286,14 @@ func (rb *Buffer) Write(p []byte) (n int, err error) {
 	free := rb.Available()
 	if n > free {
 		rb.grow(rb.size + n - free)
+		if free = rb.Available(); n > free {
+			n, err = free, ErrBufferFull
+			if n == 0 {
+				rb.afterWrite()
+				return
+			}
+			p = p[:n]
+		}
 	}
 
 	if rb.w >= rb.r {
@@ -228,6 +317,7 @@ func (rb *Buffer) Write(p []byte) (n int, err error) {
 	}
 
 	rb.isEmpty = false
+	rb.afterWrite()
 
 	return
 }
@@ -235,7 +325,10 @@ func (rb *Buffer) Write(p []byte) (n int, err error) {
 // WriteByte writes one byte into buffer.
 func (rb *Buffer) WriteByte(c byte) error {
 	if rb.Available() < 1 {
-		rb.grow(1)
+		rb.grow(rb.size + 1)
+		if rb.Available() < 1 {
+			return ErrBufferFull
+		}
 	}
 	rb.buf[rb.w] = c
 	rb.w++
@@ -244,6 +337,7 @@ func (rb *Buffer) WriteByte(c byte) error {
 		rb.w = 0
 	}
 	rb.isEmpty = false
+	rb.afterWrite()
 
 	return nil
 }
@@ -324,9 +418,13 @@ func (rb *Buffer) Bytes() []byte {
 // ReadFrom implements io.ReaderFrom.
 func (rb *Buffer) ReadFrom(r io.Reader) (n int64, err error) {
 	var m int
+	defer rb.afterWrite()
 	for {
 		if rb.Available() < MinRead {
 			rb.grow(rb.Buffered() + MinRead)
+			if rb.Available() == 0 {
+				return n, ErrBufferFull
+			}
 		}
 
 		if rb.w >= rb.r {
@@ -378,6 +476,7 @@ func (rb *Buffer) WriteTo(w io.Writer) (int64, error) {
 	if rb.isEmpty {
 		return 0, ErrIsEmpty
 	}
+	defer rb.afterRead()
 
 	if rb.w > rb.r {
 		n := rb.w - rb.r
@@ -387,7 +486,7 @@ func (rb *Buffer) WriteTo(w io.Writer) (int64, error) {
 		}
 		rb.r += m
 		if rb.r == rb.w {
-			rb.Reset()
+			rb.reset()
 		}
 		if err != nil {
 			return int64(m), err
@@ -406,7 +505,7 @@ func (rb *Buffer) WriteTo(w io.Writer) (int64, error) {
 		}
 		rb.r = (rb.r + m) % rb.size
 		if rb.r == rb.w {
-			rb.Reset()
+			rb.reset()
 		}
 		if err != nil {
 			return int64(m), err
@@ -439,7 +538,7 @@ func (rb *Buffer) WriteTo(w io.Writer) (int64, error) {
 	rb.r = m
 	cum += int64(m)
 	if rb.r == rb.w {
-		rb.Reset()
+		rb.reset()
 	}
 	if err != nil {
 		return cum, err
@@ -450,6 +549,23 @@ func (rb *Buffer) WriteTo(w io.Writer) (int64, error) {
 	return cum, nil
 }
 
+// WriteToVectored writes all buffered bytes to conn with a single vectored write (writev) when conn supports it,
+// without copying them, and advances the read pointer by the number of bytes written.
+func (rb *Buffer) WriteToVectored(conn net.Conn) (int64, error) {
+	if rb.isEmpty {
+		return 0, ErrIsEmpty
+	}
+
+	head, tail := rb.peekAll()
+	bufs := net.Buffers{head}
+	if len(tail) > 0 {
+		bufs = append(bufs, tail)
+	}
+	n, err := bufs.WriteTo(conn)
+	_, _ = rb.Discard(int(n))
+	return n, err
+}
+
 // IsFull tells if this ring-buffer is full.
 func (rb *Buffer) IsFull() bool {
 	return rb.r == rb.w && !rb.isEmpty
@@ -460,10 +576,149 @@ func (rb *Buffer) IsEmpty() bool {
 	return rb.isEmpty
 }
 
-// Reset the read pointer and write pointer to zero.
+// Reset the read pointer and write pointer to zero, it also shrinks the underlying buffer
+// if ShrinkPolicy.OnReset is set.
 func (rb *Buffer) Reset() {
+	rb.reset()
+	if rb.shrinkPolicy.OnReset {
+		rb.Shrink()
+	}
+}
+
+// SetAllocator sets the allocator of the underlying buffers, nil means the built-in byte_slice pool.
+// The current buffer, if any, is moved to a buffer of the new allocator and given back to the previous one.
+func (rb *Buffer) SetAllocator(alloc Allocator) {
+	if rb.buf == nil {
+		rb.alloc = alloc
+		return
+	}
+	rb.relocate(rb.size, alloc)
+}
+
+// Release gives the underlying buffer back to its allocator and drops all buffered bytes,
+// the ring-buffer stays usable and allocates a new buffer on the next write.
+func (rb *Buffer) Release() {
+	rb.stopIdleTimer()
+	if rb.buf != nil {
+		rb.put(rb.buf)
+	}
+	rb.buf, rb.size = nil, 0
+	rb.reset()
+}
+
+// SetShrinkPolicy sets the policy used to give the grown underlying buffer back to the pool.
+func (rb *Buffer) SetShrinkPolicy(policy ShrinkPolicy) {
+	rb.stopIdleTimer()
+	rb.shrinkPolicy = policy
+	rb.idleSince, rb.busy = time.Time{}, false
+	rb.scheduleShrink()
+}
+
+// Shrink gives the underlying buffer back to the pool and drops to DefaultBufferSize,
+// it does nothing and returns false if the buffer is not larger than DefaultBufferSize
+// or the buffered bytes don't fit in DefaultBufferSize.
+func (rb *Buffer) Shrink() bool {
+	if rb.size <= DefaultBufferSize || rb.Buffered() > DefaultBufferSize {
+		return false
+	}
+	rb.resize(DefaultBufferSize)
+	rb.idleSince, rb.busy = time.Time{}, false
+	return true
+}
+
+// TryShrink shrinks the underlying buffer if it has stayed mostly empty for ShrinkPolicy.IdleTimeout,
+// it is called whenever the buffer is drained and by the idle timer of ShrinkPolicy.Locker.
+// Owners of buffers without a Locker should call it periodically, e.g. from their event loop.
+func (rb *Buffer) TryShrink() bool {
+	if rb.shrinkPolicy.IdleTimeout <= 0 || rb.size <= DefaultBufferSize {
+		return false
+	}
+	now := time.Now()
+	if rb.busy || rb.idleSince.IsZero() || rb.Buffered() > DefaultBufferSize {
+		rb.idleSince, rb.busy = now, false
+		return false
+	}
+	if now.Sub(rb.idleSince) < rb.shrinkPolicy.IdleTimeout {
+		return false
+	}
+	return rb.Shrink()
+}
+
+// reset moves the read pointer and write pointer to zero once the buffer is drained.
+func (rb *Buffer) reset() {
 	rb.isEmpty = true
 	rb.r, rb.w = 0, 0
+	rb.afterRead()
+	rb.TryShrink()
+}
+
+// afterRead checks the low watermark and arms the idle timer once the buffer is mostly empty.
+func (rb *Buffer) afterRead() {
+	rb.checkLowWater()
+	rb.scheduleShrink()
+}
+
+// scheduleShrink arms the idle timer of ShrinkPolicy.Locker if the grown buffer is mostly empty.
+func (rb *Buffer) scheduleShrink() {
+	locker := rb.shrinkPolicy.Locker
+	if locker == nil || rb.shrinkPolicy.IdleTimeout <= 0 || rb.idleTimer != nil ||
+		rb.size <= DefaultBufferSize || rb.Buffered() > DefaultBufferSize {
+		return
+	}
+	if rb.busy || rb.idleSince.IsZero() {
+		rb.idleSince, rb.busy = time.Now(), false
+	}
+	var timer *time.Timer
+	timer = time.AfterFunc(rb.shrinkPolicy.IdleTimeout, func() {
+		locker.Lock()
+		defer locker.Unlock()
+		// The timer may have been stopped too late, e.g. by SetShrinkPolicy.
+		if rb.idleTimer != timer {
+			return
+		}
+		rb.idleTimer = nil
+		if !rb.TryShrink() {
+			rb.scheduleShrink()
+		}
+	})
+	rb.idleTimer = timer
+}
+
+func (rb *Buffer) stopIdleTimer() {
+	if rb.idleTimer != nil {
+		rb.idleTimer.Stop()
+		rb.idleTimer = nil
+	}
+}
+
+// afterWrite records the buffer usage for the shrink policy and checks the high watermark.
+func (rb *Buffer) afterWrite() {
+	if rb.Buffered() > DefaultBufferSize {
+		rb.busy = true
+	}
+	rb.checkHighWater()
+}
+
+// checkHighWater fires onHigh when the buffered bytes reach the high watermark.
+func (rb *Buffer) checkHighWater() {
+	if rb.highWater <= 0 || rb.aboveHigh || rb.Buffered() < rb.highWater {
+		return
+	}
+	rb.aboveHigh = true
+	if rb.onHigh != nil {
+		rb.onHigh()
+	}
+}
+
+// checkLowWater fires onLow when the buffered bytes drop to the low watermark after reaching the high one.
+func (rb *Buffer) checkLowWater() {
+	if !rb.aboveHigh || rb.Buffered() > rb.lowWater {
+		return
+	}
+	rb.aboveHigh = false
+	if rb.onLow != nil {
+		rb.onLow()
+	}
 }
 
 func (rb *Buffer) grow(newCap int) {
@@ -490,15 +745,48 @@ func (rb *Buffer) grow(newCap int) {
 			}
 		}
 	}
-	newBuf := bsPool.Get(newCap)
+	if rb.maxCap > 0 && newCap > rb.maxCap {
+		newCap = rb.maxCap
+	}
+	if newCap <= rb.size {
+		return
+	}
+	rb.resize(newCap)
+}
+
+// resize moves the buffered bytes into a new underlying buffer with the given size.
+func (rb *Buffer) resize(newCap int) {
+	rb.relocate(newCap, rb.alloc)
+}
+
+// relocate moves the buffered bytes to a buffer of newCap bytes from alloc, which becomes the allocator.
+func (rb *Buffer) relocate(newCap int, alloc Allocator) {
+	newBuf := allocGet(alloc, newCap)
 	oldLen := rb.Buffered()
-	_, _ = rb.Read(newBuf)
-	bsPool.Put(rb.buf)
+	head, tail := rb.peekAll()
+	copy(newBuf[copy(newBuf, head):], tail)
+	if rb.buf != nil {
+		rb.put(rb.buf)
+	}
+	rb.alloc = alloc
 	rb.buf = newBuf
 	rb.r = 0
-	rb.w = oldLen
+	rb.w = oldLen % newCap
 	rb.size = newCap
-	if rb.w > 0 {
-		rb.isEmpty = false
+	rb.isEmpty = oldLen == 0
+}
+
+func allocGet(alloc Allocator, size int) []byte {
+	if alloc != nil {
+		return alloc.Get(size)
+	}
+	return bsPool.Get(size)
+}
+
+func (rb *Buffer) put(buf []byte) {
+	if rb.alloc != nil {
+		rb.alloc.Put(buf)
+		return
 	}
+	bsPool.Put(buf)
 }
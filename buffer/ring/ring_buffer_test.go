@@ -3,8 +3,14 @@ package ring
 import (
 	"bytes"
 	crand "crypto/rand"
+	"io"
+	"net"
 	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	bsPool "go-pkg/pool/byte_slice"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -436,3 +442,250 @@ func TestRingBuffer_WriteTo(t *testing.T) {
 	require.EqualValues(t, append(data[partLen:], partData...), buf.Bytes())
 	require.True(t, rb.IsEmpty())
 }
+
+func TestRingBuffer_MaxCap(t *testing.T) {
+	rb := New(64)
+	rb.SetMaxCap(128)
+	require.EqualValues(t, 128, rb.MaxCap())
+
+	data := []byte(strings.Repeat("abcd", 40))
+	n, err := rb.Write(data)
+	require.ErrorIs(t, err, ErrBufferFull)
+	require.EqualValues(t, 128, n)
+	require.EqualValues(t, 128, rb.Cap())
+	require.True(t, rb.IsFull())
+	require.EqualValues(t, data[:128], rb.Bytes())
+
+	n, err = rb.Write([]byte("a"))
+	require.ErrorIs(t, err, ErrBufferFull)
+	require.Zero(t, n)
+	require.ErrorIs(t, rb.WriteByte('a'), ErrBufferFull)
+
+	_, _ = rb.Discard(100)
+	n, err = rb.Write(data[:100])
+	require.NoError(t, err)
+	require.EqualValues(t, 100, n)
+	require.EqualValues(t, 128, rb.Cap())
+
+	rb.Reset()
+	m, err := rb.ReadFrom(bytes.NewReader(data))
+	require.ErrorIs(t, err, ErrBufferFull)
+	require.EqualValues(t, 128, m)
+	require.EqualValues(t, data[:128], rb.Bytes())
+
+	rb.SetMaxCap(0)
+	n, err = rb.Write(data)
+	require.NoError(t, err)
+	require.EqualValues(t, len(data), n)
+}
+
+func TestRingBuffer_WriteByteGrow(t *testing.T) {
+	rb := New(bufferGrowThreshold)
+	_, _ = rb.Write(make([]byte, bufferGrowThreshold))
+	require.True(t, rb.IsFull())
+
+	require.NoError(t, rb.WriteByte('a'))
+	require.Greater(t, rb.Cap(), bufferGrowThreshold)
+	require.EqualValues(t, bufferGrowThreshold+1, rb.Buffered())
+}
+
+func TestRingBuffer_Watermark(t *testing.T) {
+	var highs, lows int
+	rb := New(64)
+	rb.SetWatermark(32, 8, func() { highs++ }, func() { lows++ })
+
+	_, _ = rb.Write(make([]byte, 16))
+	require.Zero(t, highs)
+	_, _ = rb.Write(make([]byte, 16))
+	require.EqualValues(t, 1, highs)
+	_ = rb.WriteByte('a')
+	require.EqualValues(t, 1, highs)
+
+	_, _ = rb.Read(make([]byte, 16))
+	require.Zero(t, lows)
+	_, _ = rb.Discard(9)
+	require.EqualValues(t, 1, lows)
+
+	_, _ = rb.Write(make([]byte, 64))
+	require.EqualValues(t, 2, highs)
+	m, err := rb.WriteTo(&bytes.Buffer{})
+	require.NoError(t, err)
+	require.EqualValues(t, 72, m)
+	require.EqualValues(t, 2, lows)
+
+	rb.SetWatermark(0, 0, nil, nil)
+	_, _ = rb.Write(make([]byte, 64))
+	rb.Reset()
+	require.EqualValues(t, 2, highs)
+	require.EqualValues(t, 2, lows)
+}
+
+func TestRingBuffer_Shrink(t *testing.T) {
+	rb := New(64)
+	data := make([]byte, 8*DefaultBufferSize)
+	_, err := crand.Read(data)
+	require.NoError(t, err)
+
+	_, _ = rb.Write(data)
+	require.Greater(t, rb.Cap(), DefaultBufferSize)
+	require.False(t, rb.Shrink())
+	rb.Reset()
+	require.Greater(t, rb.Cap(), DefaultBufferSize)
+
+	_, _ = rb.Write(data)
+	_, _ = rb.Discard(len(data) - DefaultBufferSize)
+	require.True(t, rb.Shrink())
+	require.EqualValues(t, DefaultBufferSize, rb.Cap())
+	require.True(t, rb.IsFull())
+	require.EqualValues(t, data[len(data)-DefaultBufferSize:], rb.Bytes())
+
+	rb.SetShrinkPolicy(ShrinkPolicy{OnReset: true})
+	_, _ = rb.Write(data)
+	require.Greater(t, rb.Cap(), DefaultBufferSize)
+	rb.Reset()
+	require.EqualValues(t, DefaultBufferSize, rb.Cap())
+	require.True(t, rb.IsEmpty())
+}
+
+func TestRingBuffer_ShrinkOnIdle(t *testing.T) {
+	rb := New(64)
+	rb.SetShrinkPolicy(ShrinkPolicy{IdleTimeout: 20 * time.Millisecond})
+	data := make([]byte, 8*DefaultBufferSize)
+
+	_, _ = rb.Write(data)
+	size := rb.Cap()
+	require.Greater(t, size, DefaultBufferSize)
+	_, _ = rb.Read(data)
+	require.EqualValues(t, size, rb.Cap())
+	require.False(t, rb.TryShrink())
+
+	_, _ = rb.Write(data[:16])
+	time.Sleep(30 * time.Millisecond)
+	require.True(t, rb.TryShrink())
+	require.EqualValues(t, DefaultBufferSize, rb.Cap())
+	require.EqualValues(t, data[:16], rb.Bytes())
+
+	_, _ = rb.Write(data)
+	_, _ = rb.Read(data)
+	time.Sleep(30 * time.Millisecond)
+	_, _ = rb.Write(data)
+	require.False(t, rb.TryShrink())
+	require.Greater(t, rb.Cap(), DefaultBufferSize)
+}
+
+func TestRingBuffer_ShrinkIdleTimer(t *testing.T) {
+	var mu sync.Mutex
+	rb := New(64)
+	rb.SetShrinkPolicy(ShrinkPolicy{IdleTimeout: 20 * time.Millisecond, Locker: &mu})
+	data := make([]byte, 8*DefaultBufferSize)
+	_, err := crand.Read(data)
+	require.NoError(t, err)
+	capacity := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return rb.Cap()
+	}
+
+	// A partly full buffer left alone shrinks without any further call.
+	mu.Lock()
+	_, _ = rb.Write(data)
+	_, _ = rb.Read(make([]byte, len(data)-16))
+	require.Greater(t, rb.Cap(), DefaultBufferSize)
+	mu.Unlock()
+	require.Eventually(t, func() bool { return capacity() == DefaultBufferSize }, time.Second, 5*time.Millisecond)
+	mu.Lock()
+	require.EqualValues(t, data[len(data)-16:], rb.Bytes())
+	mu.Unlock()
+
+	// A buffer used again before the timeout keeps its size until it is idle again.
+	mu.Lock()
+	_, _ = rb.Write(data)
+	_, _ = rb.Discard(len(data))
+	mu.Unlock()
+	time.Sleep(10 * time.Millisecond)
+	mu.Lock()
+	_, _ = rb.Write(data)
+	mu.Unlock()
+	time.Sleep(30 * time.Millisecond)
+	require.Greater(t, capacity(), DefaultBufferSize)
+
+	mu.Lock()
+	rb.Reset()
+	mu.Unlock()
+	require.Eventually(t, func() bool { return capacity() == DefaultBufferSize }, time.Second, 5*time.Millisecond)
+}
+
+func TestRingBuffer_WriteToVectored(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	received := make(chan []byte, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			received <- nil
+			return
+		}
+		defer conn.Close()
+		b, _ := io.ReadAll(conn)
+		received <- b
+	}()
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+
+	rb := New(1024)
+	_, err = rb.WriteToVectored(conn)
+	require.ErrorIs(t, err, ErrIsEmpty)
+
+	data := make([]byte, 1024)
+	_, err = crand.Read(data)
+	require.NoError(t, err)
+	_, _ = rb.Write(data)
+	_, _ = rb.Discard(768)
+	_, _ = rb.Write(data[:512])
+	head, tail := rb.Peek(-1)
+	require.NotEmpty(t, head)
+	require.NotEmpty(t, tail)
+
+	n, err := rb.WriteToVectored(conn)
+	require.NoError(t, err)
+	require.EqualValues(t, 768, n)
+	require.True(t, rb.IsEmpty())
+	require.NoError(t, conn.Close())
+	require.EqualValues(t, append(data[768:1024:1024], data[:512]...), <-received)
+}
+
+func TestRingBuffer_Allocator(t *testing.T) {
+	alloc := bsPool.NewLargePool(64 << 20)
+	rb := New(0)
+	rb.SetAllocator(alloc)
+
+	data := make([]byte, 200<<10)
+	_, err := crand.Read(data)
+	require.NoError(t, err)
+	n, err := rb.Write(data)
+	require.NoError(t, err)
+	require.EqualValues(t, len(data), n)
+	require.EqualValues(t, rb.Cap(), alloc.InUse())
+	require.EqualValues(t, data, rb.Bytes())
+
+	rb.Release()
+	require.True(t, rb.IsEmpty())
+	require.Zero(t, rb.Cap())
+	require.Zero(t, alloc.InUse())
+
+	_, _ = rb.Write(data[:16])
+	require.EqualValues(t, data[:16], rb.Bytes())
+
+	// The buffer moves to the new allocator along with its bytes.
+	_, _ = rb.Write(data[16:])
+	require.Positive(t, alloc.InUse())
+	rb.SetAllocator(nil)
+	require.Zero(t, alloc.InUse())
+	require.EqualValues(t, data, rb.Bytes())
+	rb.SetAllocator(alloc)
+	require.Positive(t, alloc.InUse())
+	require.EqualValues(t, data, rb.Bytes())
+	rb.Release()
+	require.Zero(t, alloc.InUse())
+}
@@ -0,0 +1,237 @@
+// Package spsc implements a lock-free single-producer/single-consumer circular byte buffer.
+package spsc
+
+import (
+	"context"
+	"errors"
+	"go-pkg/math"
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// cacheLinePadSize keeps the read and write cursors on separate cache lines to avoid false sharing.
+const cacheLinePadSize = 64
+
+var (
+	// ErrIsEmpty will be returned when trying to read an empty spsc-buffer without blocking.
+	ErrIsEmpty = errors.New("spsc-buffer is empty")
+	// ErrBufferFull will be returned when trying to write a full spsc-buffer without blocking.
+	ErrBufferFull = errors.New("spsc-buffer is full")
+	// ErrClosed will be returned when trying to write a closed spsc-buffer.
+	ErrClosed = errors.New("spsc-buffer is closed")
+)
+
+// Buffer is a fixed-size circular buffer which is safe for one goroutine writing and
+// another goroutine reading concurrently.
+// The read and write cursors grow monotonically and are masked by the power-of-two size,
+// blocked readers and writers are parked on channels instead of busy-spinning.
+type Buffer struct {
+	_ [cacheLinePadSize]byte
+	r atomic.Uint64 // total bytes read
+	_ [cacheLinePadSize - 8]byte
+	w atomic.Uint64 // total bytes written
+	_ [cacheLinePadSize - 8]byte
+
+	buf  []byte
+	size uint64
+	mask uint64
+
+	readerWaiting atomic.Bool
+	writerWaiting atomic.Bool
+	readable      chan struct{}
+	writable      chan struct{}
+
+	closed    atomic.Bool
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// New returns a new Buffer whose size is the given size rounded up to a power of two.
+func New(size int) *Buffer {
+	size = math.CeilToPowerOfTwo(size)
+	return &Buffer{
+		buf:      make([]byte, size),
+		size:     uint64(size),
+		mask:     uint64(size - 1),
+		readable: make(chan struct{}, 1),
+		writable: make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+}
+
+// TryRead reads up to len(p) bytes into p without blocking.
+// It returns ErrIsEmpty if there is nothing to read, or io.EOF once the buffer is closed and drained.
+// It must only be called from the consumer goroutine.
+func (b *Buffer) TryRead(p []byte) (n int, err error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	closed := b.closed.Load()
+	r, w := b.r.Load(), b.w.Load()
+	if r == w {
+		if closed {
+			return 0, io.EOF
+		}
+		return 0, ErrIsEmpty
+	}
+
+	n = int(w - r)
+	if n > len(p) {
+		n = len(p)
+	}
+	pos := r & b.mask
+	c1 := copy(p[:n], b.buf[pos:])
+	copy(p[c1:n], b.buf)
+	b.r.Store(r + uint64(n))
+	b.notify(&b.writerWaiting, b.writable)
+
+	return
+}
+
+// Read reads up to len(p) bytes into p, it blocks until at least one byte is available.
+// It returns io.EOF once the buffer is closed and drained.
+// It must only be called from the consumer goroutine.
+func (b *Buffer) Read(p []byte) (int, error) {
+	return b.ReadContext(context.Background(), p)
+}
+
+// ReadContext is like Read but gives up with ctx.Err() when ctx is done.
+func (b *Buffer) ReadContext(ctx context.Context, p []byte) (int, error) {
+	for {
+		n, err := b.TryRead(p)
+		if err != ErrIsEmpty {
+			return n, err
+		}
+		if err = b.wait(ctx, &b.readerWaiting, b.readable, func() bool {
+			return b.Buffered() > 0
+		}); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// TryWrite writes p into the buffer without blocking.
+// If p doesn't fit it writes as much as possible and returns ErrBufferFull,
+// it returns ErrClosed if the buffer is closed.
+// It must only be called from the producer goroutine.
+func (b *Buffer) TryWrite(p []byte) (n int, err error) {
+	if b.closed.Load() {
+		return 0, ErrClosed
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	r, w := b.r.Load(), b.w.Load()
+	n = int(b.size - (w - r))
+	if n >= len(p) {
+		n = len(p)
+	} else {
+		err = ErrBufferFull
+		if n == 0 {
+			return
+		}
+	}
+	pos := w & b.mask
+	c1 := copy(b.buf[pos:], p[:n])
+	copy(b.buf, p[c1:n])
+	b.w.Store(w + uint64(n))
+	b.notify(&b.readerWaiting, b.readable)
+
+	return
+}
+
+// Write writes all of p into the buffer, it blocks while the buffer is full.
+// It returns ErrClosed if the buffer is closed before p is fully written.
+// It must only be called from the producer goroutine.
+func (b *Buffer) Write(p []byte) (int, error) {
+	return b.WriteContext(context.Background(), p)
+}
+
+// WriteContext is like Write but gives up with ctx.Err() when ctx is done.
+func (b *Buffer) WriteContext(ctx context.Context, p []byte) (n int, err error) {
+	for {
+		var m int
+		m, err = b.TryWrite(p[n:])
+		n += m
+		if err != ErrBufferFull {
+			return
+		}
+		if err = b.wait(ctx, &b.writerWaiting, b.writable, func() bool {
+			return b.Available() > 0
+		}); err != nil {
+			return
+		}
+	}
+}
+
+// Close closes the buffer and wakes up the blocked reader and writer.
+// Subsequent writes fail with ErrClosed, while the reader can still drain the buffered bytes before io.EOF.
+func (b *Buffer) Close() error {
+	b.closeOnce.Do(func() {
+		b.closed.Store(true)
+		close(b.done)
+	})
+	return nil
+}
+
+// Buffered returns the length of available bytes to read.
+func (b *Buffer) Buffered() int {
+	r := b.r.Load()
+	return int(b.w.Load() - r)
+}
+
+// Available returns the length of available bytes to write.
+func (b *Buffer) Available() int {
+	return int(b.size) - b.Buffered()
+}
+
+// Cap returns the size of the underlying buffer.
+func (b *Buffer) Cap() int {
+	return int(b.size)
+}
+
+// IsEmpty tells if this spsc-buffer is empty.
+func (b *Buffer) IsEmpty() bool {
+	return b.Buffered() == 0
+}
+
+// IsFull tells if this spsc-buffer is full.
+func (b *Buffer) IsFull() bool {
+	return b.Available() == 0
+}
+
+// IsClosed tells if this spsc-buffer is closed.
+func (b *Buffer) IsClosed() bool {
+	return b.closed.Load()
+}
+
+// notify wakes up the peer if it is parked.
+func (b *Buffer) notify(waiting *atomic.Bool, ch chan struct{}) {
+	if waiting.Load() {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// wait parks the caller until the peer notifies it, the buffer is closed or ctx is done.
+// The waiting flag is published before ready is checked again, so a notification can't be lost.
+func (b *Buffer) wait(ctx context.Context, waiting *atomic.Bool, ch chan struct{}, ready func() bool) error {
+	waiting.Store(true)
+	defer waiting.Store(false)
+	if ready() || b.closed.Load() {
+		return nil
+	}
+	select {
+	case <-ch:
+		return nil
+	case <-b.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
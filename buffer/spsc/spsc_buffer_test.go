@@ -0,0 +1,148 @@
+package spsc
+
+import (
+	"bytes"
+	"context"
+	crand "crypto/rand"
+	"io"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSPSCBuffer_TryReadWrite(t *testing.T) {
+	b := New(60)
+	require.EqualValues(t, 64, b.Cap())
+	require.True(t, b.IsEmpty())
+
+	_, err := b.TryRead(make([]byte, 8))
+	require.ErrorIs(t, err, ErrIsEmpty)
+
+	data := make([]byte, 80)
+	_, err = crand.Read(data)
+	require.NoError(t, err)
+	n, err := b.TryWrite(data)
+	require.ErrorIs(t, err, ErrBufferFull)
+	require.EqualValues(t, 64, n)
+	require.True(t, b.IsFull())
+	n, err = b.TryWrite(data[64:])
+	require.ErrorIs(t, err, ErrBufferFull)
+	require.Zero(t, n)
+
+	p := make([]byte, 48)
+	n, err = b.TryRead(p)
+	require.NoError(t, err)
+	require.EqualValues(t, 48, n)
+	require.EqualValues(t, data[:48], p)
+
+	// wraps around the end of the underlying buffer
+	n, err = b.TryWrite(data[64:])
+	require.NoError(t, err)
+	require.EqualValues(t, 16, n)
+	require.EqualValues(t, 32, b.Buffered())
+	p = make([]byte, 64)
+	n, err = b.TryRead(p)
+	require.NoError(t, err)
+	require.EqualValues(t, 32, n)
+	require.EqualValues(t, data[48:], p[:n])
+
+	require.NoError(t, b.Close())
+	_, err = b.TryWrite(data)
+	require.ErrorIs(t, err, ErrClosed)
+	_, err = b.TryRead(p)
+	require.ErrorIs(t, err, io.EOF)
+}
+
+func TestSPSCBuffer_Streaming(t *testing.T) {
+	b := New(256)
+	data := make([]byte, 1<<20)
+	_, err := crand.Read(data)
+	require.NoError(t, err)
+
+	go func() {
+		for p := data; len(p) > 0; {
+			m := rand.Intn(512) + 1
+			if m > len(p) {
+				m = len(p)
+			}
+			n, err := b.Write(p[:m])
+			if err != nil {
+				return
+			}
+			p = p[n:]
+		}
+		_ = b.Close()
+	}()
+
+	var buf bytes.Buffer
+	p := make([]byte, 300)
+	for {
+		n, err := b.Read(p[:rand.Intn(len(p))+1])
+		buf.Write(p[:n])
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+	}
+	require.EqualValues(t, data, buf.Bytes())
+}
+
+func TestSPSCBuffer_Blocking(t *testing.T) {
+	b := New(16)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := b.ReadContext(ctx, make([]byte, 8))
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	_, _ = b.TryWrite(make([]byte, 16))
+	ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	n, err := b.WriteContext(ctx, make([]byte, 8))
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Zero(t, n)
+
+	written := make(chan error, 1)
+	go func() {
+		_, err := b.Write(make([]byte, 8))
+		written <- err
+	}()
+	_, _ = b.Read(make([]byte, 8))
+	require.NoError(t, <-written)
+
+	blocked := make(chan error, 1)
+	go func() {
+		_, err := b.Write(make([]byte, 8))
+		blocked <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	require.NoError(t, b.Close())
+	require.ErrorIs(t, <-blocked, ErrClosed)
+
+	n, err = b.Read(make([]byte, 32))
+	require.NoError(t, err)
+	require.EqualValues(t, 16, n)
+	_, err = b.Read(make([]byte, 32))
+	require.ErrorIs(t, err, io.EOF)
+}
+
+func BenchmarkSPSCBuffer(b *testing.B) {
+	buf := New(64 * 1024)
+	p := make([]byte, 512)
+	b.SetBytes(int64(len(p)))
+	go func() {
+		q := make([]byte, 4096)
+		for {
+			if _, err := buf.Read(q); err != nil {
+				return
+			}
+		}
+	}()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _ = buf.Write(p)
+	}
+	_ = buf.Close()
+}
@@ -95,7 +95,7 @@ func NewGRPCError(err error) error {
 	if !errors.As(err, &e) {
 		e = NewServerError(err)
 	}
-	st := status.Newf(httpToGrpcCode[e.HttpCode()], e.Message())
+	st := status.New(httpToGrpcCode[e.HttpCode()], e.Message())
 	errInfo := &errdetails.ErrorInfo{
 		Reason: e.Error(),
 		Metadata: map[string]string{
@@ -1,14 +1,21 @@
+// Package server tracks raw KCP sessions.
+//
+// Deprecated: use go-pkg/transport/kcp, whose Server tracks its sessions in a SessionManager with
+// typed attributes, idle reaping and resume. This package will be removed in the next release.
 package server
 
 import (
-	"sync"
 	"sync/atomic"
 	"time"
 
+	transport "go-pkg/transport/kcp"
+
 	"github.com/xtaci/kcp-go/v5"
 )
 
 // Session represents a KCP session with activity tracking.
+//
+// Deprecated: use transport/kcp.Session.
 type Session struct {
 	Conn         *kcp.UDPSession
 	LastActivity atomic.Int64
@@ -16,17 +23,24 @@ type Session struct {
 	Closed       atomic.Bool
 }
 
-// SessionManager manages multiple KCP sessions.
+// legacySession links the transport session to the Session wrapping it.
+var legacySession = transport.NewAttr[*Session]("server.Session")
+
+// SessionManager manages multiple KCP sessions, it is a thin wrapper around transport/kcp.SessionManager.
+// It never closes idle sessions, nor updates their LastActivity, the caller does.
+//
+// Deprecated: use transport/kcp.SessionManager.
 type SessionManager struct {
-	sessions sync.Map
-	timeout  time.Duration
+	sessions *transport.SessionManager
 }
 
-// NewSessionManager creates a new SessionManager with the given session timeout.
-func NewSessionManager(timeout time.Duration) *SessionManager {
+// NewSessionManager creates a new SessionManager, the timeout is ignored as the sessions are never reaped.
+//
+// Deprecated: use transport/kcp.NewSessionManager, or the SessionManager of a transport/kcp.Server,
+// which reaps the sessions after Config.HeartbeatTimeout or Config.IdleTimeout.
+func NewSessionManager(time.Duration) *SessionManager {
 	return &SessionManager{
-		sessions: sync.Map{},
-		timeout:  timeout,
+		sessions: transport.NewSessionManager(),
 	}
 }
 
@@ -38,28 +52,31 @@ func (sm *SessionManager) Add(conn *kcp.UDPSession) *Session {
 		ID:   id,
 	}
 	s.LastActivity.Store(time.Now().Unix())
-	sm.sessions.Store(id, s)
+	// The connection is closed by Remove, the transport session doesn't own it.
+	session := transport.NewSession(id, nil)
+	legacySession.Set(session, s)
+	sm.sessions.Add(session)
 	return s
 }
 
 // Get retrieves the session with the given id.
 func (sm *SessionManager) Get(id string) (*Session, bool) {
-	if s, ok := sm.sessions.Load(id); ok {
-		return s.(*Session), true
+	session := sm.sessions.Get(id)
+	if session == nil {
+		return nil, false
 	}
-	return nil, false
+	return legacySession.Get(session)
 }
 
 // Remove closes and removes the session with the given id.
 func (sm *SessionManager) Remove(id string) {
-	if s, ok := sm.sessions.LoadAndDelete(id); ok {
-		if session, ok := s.(*Session); ok {
-			session.Closed.CompareAndSwap(false, true)
-			session.Conn.Close()
-		}
+	session := sm.sessions.Get(id)
+	if session == nil {
+		return
+	}
+	sm.sessions.Remove(session)
+	if s, ok := legacySession.Get(session); ok {
+		s.Closed.CompareAndSwap(false, true)
+		s.Conn.Close()
 	}
 }
-
-
-
-
@@ -0,0 +1,59 @@
+package adaptive
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestVegas(t *testing.T) {
+	v := NewVegas(VegasConfig{InitialLimit: 10, MaxLimit: 50})
+	require.Equal(t, 10, v.Limit())
+
+	// Latency at the no-load level grows the limit up to the maximum.
+	v.Update(10*time.Millisecond, 10, false)
+	for i := 0; i < 20; i++ {
+		v.Update(10*time.Millisecond, v.Limit(), false)
+	}
+	require.Equal(t, 50, v.Limit())
+
+	// Few requests in flight tell nothing about the limit.
+	v.Update(100*time.Millisecond, 1, false)
+	require.Equal(t, 50, v.Limit())
+
+	// Queuing shrinks it.
+	for i := 0; i < 10; i++ {
+		v.Update(40*time.Millisecond, v.Limit(), false)
+	}
+	require.Less(t, v.Limit(), 50)
+
+	limit := v.Limit()
+	v.Update(10*time.Millisecond, limit, true)
+	require.Less(t, v.Limit(), limit)
+}
+
+func TestGradient2(t *testing.T) {
+	g := NewGradient2(Gradient2Config{InitialLimit: 10, MaxLimit: 100, Smoothing: 1})
+
+	for i := 0; i < 20; i++ {
+		g.Update(10*time.Millisecond, g.Limit(), false)
+	}
+	require.Equal(t, 90, g.Limit())
+
+	g.Update(10*time.Millisecond, 1, false)
+	require.Equal(t, 90, g.Limit())
+
+	// Latency far above the long-term average halves the limit, plus the queue size.
+	g.Update(100*time.Millisecond, g.Limit(), false)
+	require.Equal(t, 49, g.Limit())
+
+	g.Update(10*time.Millisecond, g.Limit(), true)
+	require.Equal(t, 28, g.Limit())
+
+	// A lasting latency increase becomes the new normal.
+	for i := 0; i < 100; i++ {
+		g.Update(time.Second, g.Limit(), false)
+	}
+	require.Equal(t, 100, g.Limit())
+}
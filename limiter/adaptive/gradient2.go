@@ -0,0 +1,99 @@
+package adaptive
+
+import (
+	"math"
+	"time"
+)
+
+// Gradient2Config configures a Gradient2 algorithm, zero fields take their default value.
+type Gradient2Config struct {
+	InitialLimit int     // defaults to 20
+	MinLimit     int     // defaults to 1
+	MaxLimit     int     // defaults to 200
+	Smoothing    float64 // weight of a new limit in (0, 1], defaults to 0.2
+	// Tolerance is how much the short-term latency may exceed the long-term one before the limit
+	// shrinks, it defaults to 1.5.
+	Tolerance float64
+	// LongWindow is the number of samples averaged by the long-term latency, it defaults to 600.
+	LongWindow int
+	// QueueSize is the headroom added to the limit to allow growth, it defaults to 4.
+	QueueSize int
+}
+
+// Gradient2 is an Algorithm adjusting the limit by the gradient between the long-term exponential
+// average of the latency and the latency of each sample: the limit grows by QueueSize while they
+// match and shrinks proportionally as the latency of the samples rises.
+type Gradient2 struct {
+	cfg     Gradient2Config
+	limit   float64
+	longRtt float64 // exponential moving average, in nanoseconds
+	samples int
+}
+
+// NewGradient2 returns a Gradient2 algorithm.
+func NewGradient2(cfg Gradient2Config) *Gradient2 {
+	if cfg.InitialLimit <= 0 {
+		cfg.InitialLimit = 20
+	}
+	if cfg.MinLimit <= 0 {
+		cfg.MinLimit = 1
+	}
+	if cfg.MaxLimit <= 0 {
+		cfg.MaxLimit = 200
+	}
+	if cfg.Smoothing <= 0 || cfg.Smoothing > 1 {
+		cfg.Smoothing = 0.2
+	}
+	if cfg.Tolerance < 1 {
+		cfg.Tolerance = 1.5
+	}
+	if cfg.LongWindow <= 0 {
+		cfg.LongWindow = 600
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = 4
+	}
+	return &Gradient2{cfg: cfg, limit: float64(cfg.InitialLimit)}
+}
+
+// Limit implements Algorithm.
+func (g *Gradient2) Limit() int {
+	return int(g.limit)
+}
+
+// Update implements Algorithm.
+func (g *Gradient2) Update(rtt time.Duration, inflight int, dropped bool) int {
+	if rtt <= 0 {
+		return g.Limit()
+	}
+	shortRtt := float64(rtt)
+	g.addLongRtt(shortRtt)
+	if !dropped && float64(inflight) < g.limit/2 {
+		// The limit isn't what holds the requests back, there is nothing to learn.
+		return g.Limit()
+	}
+	// Recover quickly once a long period of high latency is over.
+	if g.longRtt/shortRtt > 2 {
+		g.longRtt *= 0.95
+	}
+
+	gradient := math.Max(0.5, math.Min(1, g.cfg.Tolerance*g.longRtt/shortRtt))
+	if dropped {
+		gradient = 0.5
+	}
+	limit := g.limit*gradient + float64(g.cfg.QueueSize)
+	limit = g.limit*(1-g.cfg.Smoothing) + limit*g.cfg.Smoothing
+	g.limit = math.Max(float64(g.cfg.MinLimit), math.Min(float64(g.cfg.MaxLimit), limit))
+	return g.Limit()
+}
+
+// addLongRtt adds the sample to the long-term average, a plain average until the window is full.
+func (g *Gradient2) addLongRtt(rtt float64) {
+	if g.samples < g.cfg.LongWindow {
+		g.samples++
+		g.longRtt += (rtt - g.longRtt) / float64(g.samples)
+		return
+	}
+	factor := 2 / float64(g.cfg.LongWindow+1)
+	g.longRtt = g.longRtt*(1-factor) + rtt*factor
+}
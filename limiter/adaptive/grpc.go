@@ -0,0 +1,72 @@
+package adaptive
+
+import (
+	"context"
+	"errors"
+	"net"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// UnaryServerInterceptor returns a gRPC interceptor rejecting calls with codes.ResourceExhausted
+// once the limit of in-flight calls is reached.
+func UnaryServerInterceptor(l *Limiter) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		release, err := l.Acquire(ctx)
+		if err != nil {
+			return nil, status.Error(codes.ResourceExhausted, err.Error())
+		}
+		resp, err := handler(ctx, req)
+		release(!IsOverloaded(err))
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor returns a gRPC interceptor rejecting streams with codes.ResourceExhausted
+// once the limit of in-flight streams is reached.
+func StreamServerInterceptor(l *Limiter) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		release, err := l.Acquire(ss.Context())
+		if err != nil {
+			return status.Error(codes.ResourceExhausted, err.Error())
+		}
+		err = handler(srv, ss)
+		release(!IsOverloaded(err))
+		return err
+	}
+}
+
+// UnaryClientInterceptor returns a gRPC interceptor limiting the calls in flight to the servers,
+// extra calls fail with codes.ResourceExhausted without reaching the network.
+func UnaryClientInterceptor(l *Limiter) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn,
+		invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		release, err := l.Acquire(ctx)
+		if err != nil {
+			return status.Error(codes.ResourceExhausted, err.Error())
+		}
+		err = invoker(ctx, method, req, reply, cc, opts...)
+		release(!IsOverloaded(err))
+		return err
+	}
+}
+
+// IsOverloaded reports whether the error tells that a call failed because of the load, e.g. a deadline,
+// a network timeout or a gRPC status such as codes.Unavailable, so that its sample counts as a drop.
+// Other errors are answers of the handler and count as successful samples.
+func IsOverloaded(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	switch status.Code(err) {
+	case codes.DeadlineExceeded, codes.ResourceExhausted, codes.Unavailable:
+		return true
+	}
+	return false
+}
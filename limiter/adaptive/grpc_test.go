@@ -0,0 +1,37 @@
+package adaptive
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	l := New(fixedLimit(1))
+	interceptor := UnaryServerInterceptor(l)
+	info := &grpc.UnaryServerInfo{FullMethod: "/test.Service/Method"}
+
+	var nested error
+	resp, err := interceptor(context.Background(), "req", info, func(ctx context.Context, req any) (any, error) {
+		_, nested = interceptor(ctx, req, info, func(context.Context, any) (any, error) {
+			return nil, nil
+		})
+		return "resp", nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, "resp", resp)
+	require.Equal(t, codes.ResourceExhausted, status.Code(nested))
+	require.Zero(t, l.Inflight())
+
+	_, err = interceptor(context.Background(), "req", info, func(context.Context, any) (any, error) {
+		return nil, status.Error(codes.InvalidArgument, "bad request")
+	})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+	require.False(t, IsOverloaded(err))
+	require.True(t, IsOverloaded(status.Error(codes.Unavailable, "")))
+	require.True(t, IsOverloaded(context.DeadlineExceeded))
+}
@@ -0,0 +1,141 @@
+// Package adaptive implements a concurrency limiter whose limit of in-flight requests follows
+// the measured latency, in the spirit of TCP congestion control: the limit grows while the
+// latency stays close to the no-load latency and shrinks as soon as requests start to queue.
+package adaptive
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrLimitExceeded will be returned by Acquire when the limit of in-flight requests is reached.
+var ErrLimitExceeded = errors.New("concurrency limit exceeded")
+
+// Algorithm computes the concurrency limit from the samples of completed requests.
+// It is called with the Limiter lock held and doesn't need to be safe for concurrent use.
+type Algorithm interface {
+	// Limit returns the current limit.
+	Limit() int
+	// Update records the sample of a request which took rtt with inflight requests in flight when it started,
+	// dropped tells that the request failed because of the load, e.g. timed out. It returns the new limit.
+	Update(rtt time.Duration, inflight int, dropped bool) int
+}
+
+type options struct {
+	blocking bool
+	onLimit  func(limit int)
+}
+
+// Option configures a Limiter.
+type Option func(opts *options)
+
+// WithBlocking makes Acquire wait for a free slot until ctx is done instead of returning ErrLimitExceeded.
+func WithBlocking() Option {
+	return func(opts *options) {
+		opts.blocking = true
+	}
+}
+
+// WithLimitHandler sets the handler notified every time the limit changes.
+func WithLimitHandler(handler func(limit int)) Option {
+	return func(opts *options) {
+		opts.onLimit = handler
+	}
+}
+
+// Limiter bounds the number of in-flight requests to the limit computed by its Algorithm.
+type Limiter struct {
+	mu       sync.Mutex
+	alg      Algorithm
+	limit    int
+	inflight int
+	released chan struct{} // closed and replaced every time a slot is freed
+	rejected atomic.Uint64
+	opts     options
+}
+
+// New returns a Limiter driven by the given algorithm.
+func New(alg Algorithm, opts ...Option) *Limiter {
+	l := &Limiter{
+		alg:      alg,
+		limit:    alg.Limit(),
+		released: make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(&l.opts)
+	}
+	return l
+}
+
+// Acquire takes a slot for a request, the caller must call release exactly once when the request completes,
+// with success false if it failed because of the load (e.g. timed out), so that the limit backs off.
+// It returns ErrLimitExceeded if no slot is free, or waits for one until ctx is done with WithBlocking.
+func (l *Limiter) Acquire(ctx context.Context) (release func(success bool), err error) {
+	for {
+		l.mu.Lock()
+		if l.inflight < l.limit {
+			l.inflight++
+			inflight := l.inflight
+			l.mu.Unlock()
+			return l.releaser(time.Now(), inflight), nil
+		}
+		released := l.released
+		l.mu.Unlock()
+
+		if !l.opts.blocking {
+			l.rejected.Add(1)
+			return nil, ErrLimitExceeded
+		}
+		select {
+		case <-released:
+		case <-ctx.Done():
+			l.rejected.Add(1)
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Limit returns the current limit of in-flight requests.
+func (l *Limiter) Limit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limit
+}
+
+// Inflight returns the number of requests in flight.
+func (l *Limiter) Inflight() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.inflight
+}
+
+// Rejected returns the number of Acquire calls which didn't get a slot.
+func (l *Limiter) Rejected() uint64 {
+	return l.rejected.Load()
+}
+
+func (l *Limiter) releaser(start time.Time, inflight int) func(success bool) {
+	var released atomic.Bool
+	return func(success bool) {
+		if !released.CompareAndSwap(false, true) {
+			return
+		}
+		rtt := time.Since(start)
+
+		l.mu.Lock()
+		l.inflight--
+		limit := l.alg.Update(rtt, inflight, !success)
+		changed := limit != l.limit
+		l.limit = limit
+		close(l.released)
+		l.released = make(chan struct{})
+		l.mu.Unlock()
+
+		if changed && l.opts.onLimit != nil {
+			l.opts.onLimit(limit)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package adaptive
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fixedLimit is an Algorithm with a constant limit.
+type fixedLimit int
+
+func (f fixedLimit) Limit() int { return int(f) }
+
+func (f fixedLimit) Update(time.Duration, int, bool) int { return int(f) }
+
+func TestLimiter_Acquire(t *testing.T) {
+	l := New(fixedLimit(2))
+	ctx := context.Background()
+
+	r1, err := l.Acquire(ctx)
+	require.NoError(t, err)
+	r2, err := l.Acquire(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 2, l.Inflight())
+
+	_, err = l.Acquire(ctx)
+	require.ErrorIs(t, err, ErrLimitExceeded)
+	require.EqualValues(t, 1, l.Rejected())
+
+	r1(true)
+	r1(true)
+	require.Equal(t, 1, l.Inflight())
+	r3, err := l.Acquire(ctx)
+	require.NoError(t, err)
+	r2(false)
+	r3(true)
+	require.Zero(t, l.Inflight())
+}
+
+func TestLimiter_Blocking(t *testing.T) {
+	l := New(fixedLimit(1), WithBlocking())
+	ctx := context.Background()
+
+	release, err := l.Acquire(ctx)
+	require.NoError(t, err)
+
+	timeout, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	_, err = l.Acquire(timeout)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		release(true)
+	}()
+	release2, err := l.Acquire(ctx)
+	require.NoError(t, err)
+	release2(true)
+}
+
+func TestLimiter_LimitHandler(t *testing.T) {
+	var limits []int
+	l := New(NewVegas(VegasConfig{InitialLimit: 4}), WithLimitHandler(func(limit int) {
+		limits = append(limits, limit)
+	}))
+
+	// Every drop makes the limit back off.
+	for i := 0; i < 2; i++ {
+		release, err := l.Acquire(context.Background())
+		require.NoError(t, err)
+		release(false)
+	}
+	require.Equal(t, []int{3, 2}, limits)
+	require.Equal(t, 2, l.Limit())
+}
@@ -0,0 +1,93 @@
+package adaptive
+
+import (
+	"math"
+	"time"
+)
+
+// VegasConfig configures a Vegas algorithm, zero fields take their default value.
+type VegasConfig struct {
+	InitialLimit int     // defaults to 20
+	MinLimit     int     // defaults to 1
+	MaxLimit     int     // defaults to 1000
+	Smoothing    float64 // weight of a new limit in (0, 1], defaults to 1
+	// ProbeInterval is the number of samples, multiplied by the limit, after which the no-load
+	// latency is measured again, so that the limiter adapts when the latency floor goes up.
+	// It defaults to 30.
+	ProbeInterval int
+}
+
+// Vegas is an Algorithm modeled after TCP Vegas: it estimates the queue size from the ratio between the
+// lowest latency seen (the no-load latency) and the latency of each sample, and grows the limit while
+// the queue is short and shrinks it once the queue grows or requests are dropped.
+type Vegas struct {
+	cfg       VegasConfig
+	limit     float64
+	rttNoLoad time.Duration
+	samples   int
+}
+
+// NewVegas returns a Vegas algorithm.
+func NewVegas(cfg VegasConfig) *Vegas {
+	if cfg.InitialLimit <= 0 {
+		cfg.InitialLimit = 20
+	}
+	if cfg.MinLimit <= 0 {
+		cfg.MinLimit = 1
+	}
+	if cfg.MaxLimit <= 0 {
+		cfg.MaxLimit = 1000
+	}
+	if cfg.Smoothing <= 0 || cfg.Smoothing > 1 {
+		cfg.Smoothing = 1
+	}
+	if cfg.ProbeInterval <= 0 {
+		cfg.ProbeInterval = 30
+	}
+	return &Vegas{cfg: cfg, limit: float64(cfg.InitialLimit)}
+}
+
+// Limit implements Algorithm.
+func (v *Vegas) Limit() int {
+	return int(v.limit)
+}
+
+// Update implements Algorithm.
+func (v *Vegas) Update(rtt time.Duration, inflight int, dropped bool) int {
+	if rtt <= 0 {
+		return v.Limit()
+	}
+	v.samples++
+	if v.samples >= v.cfg.ProbeInterval*int(v.limit) {
+		v.samples = 0
+		v.rttNoLoad = 0
+	}
+	if !dropped && (v.rttNoLoad == 0 || rtt < v.rttNoLoad) {
+		v.rttNoLoad = rtt
+		return v.Limit()
+	}
+
+	log := math.Max(1, math.Log10(v.limit))
+	limit := v.limit
+	switch {
+	case dropped:
+		limit -= log
+	case float64(inflight)*2 < v.limit:
+		// The limit isn't what holds the requests back, there is nothing to learn.
+		return v.Limit()
+	default:
+		queue := math.Ceil(v.limit * (1 - float64(v.rttNoLoad)/float64(rtt)))
+		switch alpha, beta := 3*log, 6*log; {
+		case queue <= log:
+			limit += beta
+		case queue < alpha:
+			limit += log
+		case queue > beta:
+			limit -= log
+		}
+	}
+
+	limit = math.Max(float64(v.cfg.MinLimit), math.Min(float64(v.cfg.MaxLimit), limit))
+	v.limit = (1-v.cfg.Smoothing)*v.limit + v.cfg.Smoothing*limit
+	return v.Limit()
+}
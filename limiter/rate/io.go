@@ -0,0 +1,68 @@
+package rate
+
+import (
+	"context"
+	"io"
+)
+
+// Reader is an io.Reader limiting the number of bytes per second read from the underlying reader,
+// every byte takes one token from the bucket.
+type Reader struct {
+	ctx context.Context
+	r   io.Reader
+	tb  *TokenBucket
+}
+
+// NewReader returns a Reader reading from r at the byte rate of tb, waits give up once ctx is done.
+func NewReader(ctx context.Context, r io.Reader, tb *TokenBucket) *Reader {
+	return &Reader{ctx: ctx, r: r, tb: tb}
+}
+
+// Read reads at most burst bytes from the underlying reader and waits until they are allowed.
+func (r *Reader) Read(p []byte) (int, error) {
+	if burst := r.tb.Burst(); burst > 0 && len(p) > burst {
+		p = p[:burst]
+	}
+	n, err := r.r.Read(p)
+	if n <= 0 {
+		return n, err
+	}
+	if werr := r.tb.WaitN(r.ctx, n); werr != nil {
+		return n, werr
+	}
+	return n, err
+}
+
+// Writer is an io.Writer limiting the number of bytes per second written to the underlying writer,
+// every byte takes one token from the bucket.
+type Writer struct {
+	ctx context.Context
+	w   io.Writer
+	tb  *TokenBucket
+}
+
+// NewWriter returns a Writer writing to w at the byte rate of tb, waits give up once ctx is done.
+func NewWriter(ctx context.Context, w io.Writer, tb *TokenBucket) *Writer {
+	return &Writer{ctx: ctx, w: w, tb: tb}
+}
+
+// Write writes p to the underlying writer in chunks of at most burst bytes, waiting until each is allowed.
+func (w *Writer) Write(p []byte) (int, error) {
+	var written int
+	for len(p) > 0 {
+		chunk := p
+		if burst := w.tb.Burst(); burst > 0 && len(chunk) > burst {
+			chunk = chunk[:burst]
+		}
+		if err := w.tb.WaitN(w.ctx, len(chunk)); err != nil {
+			return written, err
+		}
+		n, err := w.w.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
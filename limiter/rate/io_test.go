@@ -0,0 +1,38 @@
+package rate
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReaderWriter(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 300)
+	ctx := context.Background()
+
+	// 3000 bytes at 20KB/s with a full 1KB bucket take at least 100ms.
+	start := time.Now()
+	var out bytes.Buffer
+	w := NewWriter(ctx, &out, NewTokenBucket(20<<10, 1<<10))
+	n, err := w.Write(data)
+	require.NoError(t, err)
+	require.Equal(t, len(data), n)
+	require.Equal(t, data, out.Bytes())
+	require.GreaterOrEqual(t, time.Since(start), 90*time.Millisecond)
+
+	start = time.Now()
+	r := NewReader(ctx, bytes.NewReader(data), NewTokenBucket(20<<10, 1<<10))
+	got, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, data, got)
+	require.GreaterOrEqual(t, time.Since(start), 90*time.Millisecond)
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = NewWriter(canceled, io.Discard, NewTokenBucket(1, 1)).Write(data)
+	require.ErrorIs(t, err, context.Canceled)
+}
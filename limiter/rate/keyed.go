@@ -0,0 +1,115 @@
+package rate
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// Keyed holds one Limiter per key, e.g. per client address or user ID.
+// It keeps at most size keys, evicting the least recently used one, and drops the keys
+// idle for longer than the idle timeout.
+type Keyed[K comparable] struct {
+	mu         sync.Mutex
+	newLimiter func(key K) Limiter
+	size       int
+	idle       time.Duration
+	ll         *list.List // front is the most recently used
+	items      map[K]*list.Element
+	now        func() time.Time
+}
+
+type keyedEntry[K comparable] struct {
+	key      K
+	limiter  Limiter
+	lastUsed time.Time
+}
+
+// NewKeyed returns a Keyed creating the limiter of a key with newLimiter on first use.
+// A size <= 0 means no limit on the number of keys, an idle <= 0 means keys never expire.
+func NewKeyed[K comparable](size int, idle time.Duration, newLimiter func(key K) Limiter) *Keyed[K] {
+	return &Keyed[K]{
+		newLimiter: newLimiter,
+		size:       size,
+		idle:       idle,
+		ll:         list.New(),
+		items:      make(map[K]*list.Element),
+		now:        time.Now,
+	}
+}
+
+// Get returns the limiter of the key, creating it if needed.
+func (k *Keyed[K]) Get(key K) Limiter {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	now := k.now()
+	k.evictIdle(now)
+	if e, ok := k.items[key]; ok {
+		entry := e.Value.(*keyedEntry[K])
+		entry.lastUsed = now
+		k.ll.MoveToFront(e)
+		return entry.limiter
+	}
+
+	entry := &keyedEntry[K]{key: key, limiter: k.newLimiter(key), lastUsed: now}
+	k.items[key] = k.ll.PushFront(entry)
+	if k.size > 0 && k.ll.Len() > k.size {
+		k.remove(k.ll.Back())
+	}
+	return entry.limiter
+}
+
+// Allow reports whether an event of the key may happen now.
+func (k *Keyed[K]) Allow(key K) bool {
+	return k.Get(key).Allow()
+}
+
+// AllowN reports whether n events of the key may happen now.
+func (k *Keyed[K]) AllowN(key K, n int) bool {
+	return k.Get(key).AllowN(n)
+}
+
+// Wait blocks until an event of the key is allowed or ctx is done.
+func (k *Keyed[K]) Wait(ctx context.Context, key K) error {
+	return k.Get(key).Wait(ctx)
+}
+
+// WaitN blocks until n events of the key are allowed or ctx is done.
+func (k *Keyed[K]) WaitN(ctx context.Context, key K, n int) error {
+	return k.Get(key).WaitN(ctx, n)
+}
+
+// Remove drops the limiter of the key.
+func (k *Keyed[K]) Remove(key K) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if e, ok := k.items[key]; ok {
+		k.remove(e)
+	}
+}
+
+// Len returns the number of keys held.
+func (k *Keyed[K]) Len() int {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.evictIdle(k.now())
+	return k.ll.Len()
+}
+
+// evictIdle drops the keys idle for longer than the idle timeout, it must be called with mu held.
+func (k *Keyed[K]) evictIdle(now time.Time) {
+	if k.idle <= 0 {
+		return
+	}
+	expiredAt := now.Add(-k.idle)
+	for e := k.ll.Back(); e != nil && e.Value.(*keyedEntry[K]).lastUsed.Before(expiredAt); e = k.ll.Back() {
+		k.remove(e)
+	}
+}
+
+func (k *Keyed[K]) remove(e *list.Element) {
+	k.ll.Remove(e)
+	delete(k.items, e.Value.(*keyedEntry[K]).key)
+}
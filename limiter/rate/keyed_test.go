@@ -0,0 +1,40 @@
+package rate
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyed(t *testing.T) {
+	clock := newFakeClock()
+	var created []string
+	k := NewKeyed[string](2, time.Minute, func(key string) Limiter {
+		created = append(created, key)
+		tb := NewTokenBucket(1, 1)
+		tb.now = clock.now
+		return tb
+	})
+	k.now = clock.now
+
+	require.True(t, k.Allow("a"))
+	require.False(t, k.Allow("a"))
+	require.True(t, k.Allow("b"))
+	require.Equal(t, 2, k.Len())
+
+	// "a" is the least recently used key and gets evicted by "c".
+	require.False(t, k.Allow("b"))
+	require.True(t, k.Allow("c"))
+	require.Equal(t, 2, k.Len())
+	require.True(t, k.Allow("a"))
+	require.Equal(t, []string{"a", "b", "c", "a"}, created)
+
+	clock.advance(30 * time.Second)
+	k.Get("a")
+	clock.advance(45 * time.Second)
+	require.Equal(t, 1, k.Len())
+
+	k.Remove("a")
+	require.Zero(t, k.Len())
+}
@@ -0,0 +1,128 @@
+package rate
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// LeakyBucket is a Limiter letting events through at a constant pace of rate events per second,
+// without bursts. Up to capacity events may queue in WaitN for their turn, further ones are refused.
+type LeakyBucket struct {
+	mu       sync.Mutex
+	interval time.Duration // time between two events
+	never    bool          // the rate is <= 0, no event is allowed
+	capacity int
+	next     time.Time // earliest time the next event may happen
+	now      func() time.Time
+}
+
+// NewLeakyBucket returns an empty LeakyBucket allowing rate events per second with up to capacity queued events.
+// A rate <= 0 allows no event, WaitN returns ErrExceedsBurst.
+func NewLeakyBucket(rate float64, capacity int) *LeakyBucket {
+	lb := &LeakyBucket{
+		capacity: capacity,
+		now:      time.Now,
+	}
+	switch {
+	case rate <= 0:
+		lb.never = true
+	case rate != Inf:
+		lb.interval = durationFromTokens(1, rate)
+	}
+	return lb
+}
+
+// Allow is shorthand for AllowN(1).
+func (lb *LeakyBucket) Allow() bool {
+	return lb.AllowN(1)
+}
+
+// AllowN reports whether n events may happen now, i.e. no event is pending.
+func (lb *LeakyBucket) AllowN(n int) bool {
+	_, ok := lb.reserveN(lb.now(), n, 0)
+	return ok
+}
+
+// Wait is shorthand for WaitN(ctx, 1).
+func (lb *LeakyBucket) Wait(ctx context.Context) error {
+	return lb.WaitN(ctx, 1)
+}
+
+// WaitN blocks until the turn of the n events, it returns ErrExceedsBurst if the bucket would overflow
+// and ErrWouldExceedDeadline if the turn won't come before the ctx deadline.
+func (lb *LeakyBucket) WaitN(ctx context.Context, n int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	now := lb.now()
+	delay, ok := lb.reserveN(now, n, maxWait(ctx, now))
+	if !ok {
+		if lb.overflows(now, n) {
+			return ErrExceedsBurst
+		}
+		return ErrWouldExceedDeadline
+	}
+	if err := sleep(ctx, delay); err != nil {
+		lb.cancel(now.Add(delay), n)
+		return err
+	}
+	return nil
+}
+
+// Pending returns the number of events queued ahead of a new one.
+func (lb *LeakyBucket) Pending() int {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	return lb.pending(lb.now())
+}
+
+// reserveN books the slots of n events and returns how long the caller must wait for them,
+// it books nothing and returns false if that is longer than maxWait or the bucket would overflow.
+func (lb *LeakyBucket) reserveN(now time.Time, n int, maxWait time.Duration) (time.Duration, bool) {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	if lb.never {
+		return 0, false
+	}
+	if lb.interval == 0 {
+		return 0, true
+	}
+	if lb.pending(now)+n-1 > lb.capacity {
+		return 0, false
+	}
+
+	start := lb.next
+	if start.Before(now) {
+		start = now
+	}
+	delay := start.Sub(now)
+	if delay > maxWait {
+		return 0, false
+	}
+	lb.next = start.Add(time.Duration(n) * lb.interval)
+	return delay, true
+}
+
+func (lb *LeakyBucket) overflows(now time.Time, n int) bool {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	return lb.never || lb.pending(now)+n-1 > lb.capacity
+}
+
+// cancel gives back the slots of a canceled wait if no event has been booked after them.
+func (lb *LeakyBucket) cancel(start time.Time, n int) {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	if end := start.Add(time.Duration(n) * lb.interval); lb.next.Equal(end) {
+		lb.next = start
+	}
+}
+
+// pending returns the number of events booked after now, it must be called with mu held.
+func (lb *LeakyBucket) pending(now time.Time) int {
+	if !lb.next.After(now) {
+		return 0
+	}
+	return int((lb.next.Sub(now) + lb.interval - 1) / lb.interval)
+}
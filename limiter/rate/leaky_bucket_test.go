@@ -0,0 +1,65 @@
+package rate
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLeakyBucket_AllowN(t *testing.T) {
+	clock := newFakeClock()
+	lb := NewLeakyBucket(10, 2)
+	lb.now = clock.now
+
+	require.True(t, lb.Allow())
+	require.False(t, lb.Allow())
+	require.Equal(t, 1, lb.Pending())
+
+	clock.advance(100 * time.Millisecond)
+	require.True(t, lb.AllowN(3))
+	clock.advance(250 * time.Millisecond)
+	require.False(t, lb.Allow())
+	clock.advance(50 * time.Millisecond)
+	require.True(t, lb.Allow())
+}
+
+func TestLeakyBucket_ZeroRate(t *testing.T) {
+	for _, r := range []float64{0, -1} {
+		lb := NewLeakyBucket(r, 2)
+		require.False(t, lb.Allow())
+		require.False(t, lb.Allow())
+		require.ErrorIs(t, lb.Wait(context.Background()), ErrExceedsBurst)
+		require.Zero(t, lb.Pending())
+	}
+}
+
+func TestLeakyBucket_WaitN(t *testing.T) {
+	lb := NewLeakyBucket(100, 4)
+	ctx := context.Background()
+
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		times []time.Time
+	)
+	start := time.Now()
+	wg.Add(5)
+	for i := 0; i < 5; i++ {
+		go func() {
+			defer wg.Done()
+			if lb.Wait(ctx) == nil {
+				mu.Lock()
+				times = append(times, time.Now())
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	require.Len(t, times, 5)
+	require.GreaterOrEqual(t, time.Since(start), 40*time.Millisecond)
+
+	require.ErrorIs(t, lb.WaitN(ctx, 10), ErrExceedsBurst)
+}
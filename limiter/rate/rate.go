@@ -0,0 +1,68 @@
+// Package rate provides in-process rate limiters: a token bucket allowing bursts,
+// a leaky bucket smoothing events at a constant pace and a sliding window counter,
+// along with byte-rate io.Reader/io.Writer wrappers and per-key limiters.
+package rate
+
+import (
+	"context"
+	"errors"
+	"math"
+	"time"
+)
+
+// Inf is the infinite rate limit, it allows all events.
+const Inf = math.MaxFloat64
+
+var (
+	// ErrExceedsBurst will be returned by WaitN if n exceeds the number of events the limiter can ever allow at once.
+	ErrExceedsBurst = errors.New("requested events exceed the limiter burst")
+	// ErrWouldExceedDeadline will be returned by WaitN if the events can't be allowed before the context deadline.
+	ErrWouldExceedDeadline = errors.New("waiting would exceed the context deadline")
+)
+
+// Limiter controls how frequently events are allowed to happen.
+type Limiter interface {
+	// Allow reports whether an event may happen now.
+	Allow() bool
+	// AllowN reports whether n events may happen now.
+	AllowN(n int) bool
+	// Wait blocks until an event is allowed or ctx is done.
+	Wait(ctx context.Context) error
+	// WaitN blocks until n events are allowed or ctx is done.
+	WaitN(ctx context.Context, n int) error
+}
+
+// durationFromTokens returns the time needed to accumulate the tokens at the given rate per second.
+func durationFromTokens(tokens, rate float64) time.Duration {
+	if rate <= 0 {
+		return math.MaxInt64
+	}
+	seconds := tokens / rate
+	if seconds >= float64(math.MaxInt64)/float64(time.Second) {
+		return math.MaxInt64
+	}
+	return time.Duration(math.Ceil(seconds * float64(time.Second)))
+}
+
+// maxWait returns how long the caller may wait before the ctx deadline.
+func maxWait(ctx context.Context, now time.Time) time.Duration {
+	if deadline, ok := ctx.Deadline(); ok {
+		return deadline.Sub(now)
+	}
+	return math.MaxInt64
+}
+
+// sleep waits for d, it returns ctx.Err() if ctx is done first.
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,134 @@
+package rate
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// SlidingWindow is a Limiter allowing up to limit events within any window of time.
+// It approximates a sliding log with two fixed windows: the count of the previous window is
+// weighted by how much of it still overlaps the sliding window.
+type SlidingWindow struct {
+	mu     sync.Mutex
+	limit  int
+	window time.Duration
+	start  time.Time // start of the current fixed window
+	prev   int       // events of the previous fixed window
+	cur    int       // events of the current fixed window
+	now    func() time.Time
+}
+
+// NewSlidingWindow returns a SlidingWindow allowing limit events per window.
+func NewSlidingWindow(limit int, window time.Duration) *SlidingWindow {
+	return &SlidingWindow{
+		limit:  limit,
+		window: window,
+		now:    time.Now,
+	}
+}
+
+// Allow is shorthand for AllowN(1).
+func (sw *SlidingWindow) Allow() bool {
+	return sw.AllowN(1)
+}
+
+// AllowN reports whether n events may happen now, they are only counted if it returns true.
+func (sw *SlidingWindow) AllowN(n int) bool {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	return sw.delay(sw.now(), n) == 0
+}
+
+// Wait is shorthand for WaitN(ctx, 1).
+func (sw *SlidingWindow) Wait(ctx context.Context) error {
+	return sw.WaitN(ctx, 1)
+}
+
+// WaitN blocks until n events fit in the window, it returns ErrExceedsBurst if n exceeds the limit
+// and ErrWouldExceedDeadline if they won't fit before the ctx deadline.
+func (sw *SlidingWindow) WaitN(ctx context.Context, n int) error {
+	if n > sw.limit {
+		return ErrExceedsBurst
+	}
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		now := sw.now()
+		sw.mu.Lock()
+		delay := sw.delay(now, n)
+		sw.mu.Unlock()
+		if delay == 0 {
+			return nil
+		}
+		if delay > maxWait(ctx, now) {
+			return ErrWouldExceedDeadline
+		}
+		if err := sleep(ctx, delay); err != nil {
+			return err
+		}
+	}
+}
+
+// Limit returns the number of events allowed per window.
+func (sw *SlidingWindow) Limit() int {
+	return sw.limit
+}
+
+// Count returns the estimated number of events within the sliding window.
+func (sw *SlidingWindow) Count() float64 {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	now := sw.now()
+	sw.advance(now)
+	return sw.count(now)
+}
+
+// delay counts the n events and returns 0 if they fit in the window, otherwise it returns
+// how long until they may fit. It must be called with mu held.
+func (sw *SlidingWindow) delay(now time.Time, n int) time.Duration {
+	if n > sw.limit {
+		return sw.window
+	}
+	sw.advance(now)
+	if sw.count(now)+float64(n) <= float64(sw.limit) {
+		sw.cur += n
+		return 0
+	}
+
+	end := sw.start.Add(sw.window)
+	if sw.cur+n > sw.limit || sw.prev == 0 {
+		return end.Sub(now)
+	}
+	// prev * (1 - elapsed/window) + cur + n <= limit
+	elapsed := float64(sw.window) * (1 - float64(sw.limit-sw.cur-n)/float64(sw.prev))
+	delay := sw.start.Add(time.Duration(elapsed)).Sub(now)
+	if delay < time.Millisecond {
+		delay = time.Millisecond
+	}
+	return delay
+}
+
+// advance moves the fixed windows forward to now, it must be called with mu held.
+func (sw *SlidingWindow) advance(now time.Time) {
+	if sw.start.IsZero() {
+		sw.start = now
+		return
+	}
+	switch elapsed := now.Sub(sw.start) / sw.window; {
+	case elapsed <= 0:
+	case elapsed == 1:
+		sw.prev, sw.cur = sw.cur, 0
+		sw.start = sw.start.Add(sw.window)
+	default:
+		sw.prev, sw.cur = 0, 0
+		sw.start = sw.start.Add(elapsed * sw.window)
+	}
+}
+
+// count returns the estimated number of events within the sliding window ending at now.
+func (sw *SlidingWindow) count(now time.Time) float64 {
+	overlap := 1 - float64(now.Sub(sw.start))/float64(sw.window)
+	return float64(sw.prev)*overlap + float64(sw.cur)
+}
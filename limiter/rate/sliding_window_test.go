@@ -0,0 +1,43 @@
+package rate
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSlidingWindow_AllowN(t *testing.T) {
+	clock := newFakeClock()
+	sw := NewSlidingWindow(10, time.Second)
+	sw.now = clock.now
+
+	require.True(t, sw.AllowN(10))
+	require.False(t, sw.Allow())
+
+	// Half of the previous window still overlaps the sliding window.
+	clock.advance(1500 * time.Millisecond)
+	require.EqualValues(t, 5, sw.Count())
+	require.True(t, sw.AllowN(5))
+	require.False(t, sw.Allow())
+
+	clock.advance(3 * time.Second)
+	require.Zero(t, sw.Count())
+	require.False(t, sw.AllowN(11))
+}
+
+func TestSlidingWindow_WaitN(t *testing.T) {
+	sw := NewSlidingWindow(5, 100*time.Millisecond)
+	ctx := context.Background()
+	require.True(t, sw.AllowN(5))
+
+	start := time.Now()
+	require.NoError(t, sw.WaitN(ctx, 2))
+	require.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+
+	require.ErrorIs(t, sw.WaitN(ctx, 6), ErrExceedsBurst)
+	short, cancel := context.WithTimeout(ctx, time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, sw.WaitN(short, 5), ErrWouldExceedDeadline)
+}
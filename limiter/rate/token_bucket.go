@@ -0,0 +1,153 @@
+package rate
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// TokenBucket is a Limiter filled with rate tokens per second up to burst tokens, every event takes one token.
+// It allows bursts of up to burst events and a sustained rate of rate events per second.
+type TokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  int
+	tokens float64
+	last   time.Time // last time tokens was updated
+	now    func() time.Time
+}
+
+// NewTokenBucket returns a full TokenBucket allowing rate events per second with bursts of up to burst events.
+func NewTokenBucket(rate float64, burst int) *TokenBucket {
+	return &TokenBucket{
+		rate:   rate,
+		burst:  burst,
+		tokens: float64(burst),
+		now:    time.Now,
+	}
+}
+
+// Allow is shorthand for AllowN(1).
+func (tb *TokenBucket) Allow() bool {
+	return tb.AllowN(1)
+}
+
+// AllowN reports whether n events may happen now, the tokens are only taken if it returns true.
+func (tb *TokenBucket) AllowN(n int) bool {
+	_, ok := tb.reserveN(tb.now(), n, 0)
+	return ok
+}
+
+// Wait is shorthand for WaitN(ctx, 1).
+func (tb *TokenBucket) Wait(ctx context.Context) error {
+	return tb.WaitN(ctx, 1)
+}
+
+// WaitN blocks until n tokens are available, it returns ErrExceedsBurst if n exceeds the burst
+// and ErrWouldExceedDeadline if the tokens won't be available before the ctx deadline.
+// The tokens are given back if ctx is done while waiting.
+func (tb *TokenBucket) WaitN(ctx context.Context, n int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	now := tb.now()
+	delay, ok := tb.reserveN(now, n, maxWait(ctx, now))
+	if !ok {
+		tb.mu.Lock()
+		burst := tb.burst
+		tb.mu.Unlock()
+		if n > burst {
+			return ErrExceedsBurst
+		}
+		return ErrWouldExceedDeadline
+	}
+	if err := sleep(ctx, delay); err != nil {
+		tb.cancel(n)
+		return err
+	}
+	return nil
+}
+
+// SetRate changes the number of tokens added per second.
+func (tb *TokenBucket) SetRate(rate float64) {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	tb.advance(tb.now())
+	tb.rate = rate
+}
+
+// SetBurst changes the capacity of the bucket.
+func (tb *TokenBucket) SetBurst(burst int) {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	tb.advance(tb.now())
+	tb.burst = burst
+	tb.tokens = math.Min(tb.tokens, float64(burst))
+}
+
+// Rate returns the number of tokens added per second.
+func (tb *TokenBucket) Rate() float64 {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	return tb.rate
+}
+
+// Burst returns the capacity of the bucket.
+func (tb *TokenBucket) Burst() int {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	return tb.burst
+}
+
+// Tokens returns the number of tokens available now, it is negative while waiters are pending.
+func (tb *TokenBucket) Tokens() float64 {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	tb.advance(tb.now())
+	return tb.tokens
+}
+
+// reserveN takes n tokens and returns how long the caller must wait for them,
+// it takes nothing and returns false if that is longer than maxWait.
+func (tb *TokenBucket) reserveN(now time.Time, n int, maxWait time.Duration) (time.Duration, bool) {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	if tb.rate == Inf {
+		return 0, true
+	}
+	if n > tb.burst {
+		return 0, false
+	}
+
+	tb.advance(now)
+	tokens := tb.tokens - float64(n)
+	var delay time.Duration
+	if tokens < 0 {
+		delay = durationFromTokens(-tokens, tb.rate)
+	}
+	if delay > maxWait {
+		return 0, false
+	}
+	tb.tokens = tokens
+	return delay, true
+}
+
+// cancel gives back the tokens of a canceled wait.
+func (tb *TokenBucket) cancel(n int) {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	tb.advance(tb.now())
+	tb.tokens = math.Min(tb.tokens+float64(n), float64(tb.burst))
+}
+
+// advance adds the tokens accumulated since the last update, it must be called with mu held.
+func (tb *TokenBucket) advance(now time.Time) {
+	if now.After(tb.last) {
+		if !tb.last.IsZero() {
+			tb.tokens += now.Sub(tb.last).Seconds() * tb.rate
+			tb.tokens = math.Min(tb.tokens, float64(tb.burst))
+		}
+		tb.last = now
+	}
+}
@@ -0,0 +1,56 @@
+package rate
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenBucket_AllowN(t *testing.T) {
+	clock := newFakeClock()
+	tb := NewTokenBucket(10, 5)
+	tb.now = clock.now
+
+	require.True(t, tb.AllowN(5))
+	require.False(t, tb.Allow())
+	require.False(t, tb.AllowN(6))
+
+	clock.advance(100 * time.Millisecond)
+	require.True(t, tb.Allow())
+	require.False(t, tb.Allow())
+
+	clock.advance(time.Hour)
+	require.EqualValues(t, 5, tb.Tokens())
+
+	tb.SetBurst(2)
+	require.EqualValues(t, 2, tb.Tokens())
+	tb.SetRate(Inf)
+	require.True(t, tb.AllowN(100))
+}
+
+func TestTokenBucket_WaitN(t *testing.T) {
+	tb := NewTokenBucket(100, 10)
+	ctx := context.Background()
+	require.True(t, tb.AllowN(10))
+
+	start := time.Now()
+	require.NoError(t, tb.WaitN(ctx, 5))
+	require.GreaterOrEqual(t, time.Since(start), 40*time.Millisecond)
+
+	require.ErrorIs(t, tb.WaitN(ctx, 11), ErrExceedsBurst)
+
+	short, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, tb.WaitN(short, 10), ErrWouldExceedDeadline)
+
+	canceled, cancel := context.WithCancel(ctx)
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	before := tb.Tokens()
+	require.ErrorIs(t, tb.WaitN(canceled, 10), context.Canceled)
+	require.Greater(t, tb.Tokens(), before)
+}
@@ -0,0 +1,152 @@
+// Package redis_rate provides cluster-wide rate limiters whose state lives in Redis.
+// Every decision is made by an atomic Lua script using the Redis server time, so the
+// instances sharing a Redis don't depend on their own clocks.
+// When Redis is unreachable, the limiters can fall back to an in-process limiter per key.
+package redis_rate
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"go-pkg/limiter/rate"
+	"go-pkg/redis"
+
+	goredis "github.com/redis/go-redis/v9"
+)
+
+// DefaultFallbackCooldown is how long a limiter keeps using its local fallback after a Redis error.
+const DefaultFallbackCooldown = time.Second
+
+// ErrUnexpectedReply will be returned if the reply of a limiter script can't be parsed.
+var ErrUnexpectedReply = errors.New("unexpected rate limiter script reply")
+
+// Result is the outcome of a rate limiting decision.
+type Result struct {
+	Allowed    bool
+	Remaining  int           // events still allowed right now
+	RetryAfter time.Duration // when not allowed, how long until the events may be allowed
+	Local      bool          // whether the decision was made by the local fallback
+}
+
+type options struct {
+	instances  int
+	cooldown   time.Duration
+	onFallback func(err error)
+}
+
+// Option configures a limiter.
+type Option func(opts *options)
+
+// WithLocalFallback makes the limiter decide locally while Redis is unreachable instead of returning the error.
+// The quota is split evenly across the given number of instances.
+func WithLocalFallback(instances int) Option {
+	return func(opts *options) {
+		if instances < 1 {
+			instances = 1
+		}
+		opts.instances = instances
+	}
+}
+
+// WithFallbackCooldown sets how long the limiter keeps using its local fallback after a Redis error
+// before trying Redis again, it defaults to DefaultFallbackCooldown.
+func WithFallbackCooldown(cooldown time.Duration) Option {
+	return func(opts *options) {
+		opts.cooldown = cooldown
+	}
+}
+
+// WithFallbackHandler sets the handler receiving the Redis errors that triggered the local fallback.
+func WithFallbackHandler(handler func(err error)) Option {
+	return func(opts *options) {
+		opts.onFallback = handler
+	}
+}
+
+// limiter runs a limiter script against Redis and falls back to local limiters on errors.
+type limiter struct {
+	store     redis.Cache
+	prefix    string
+	script    *goredis.Script
+	opts      options
+	local     *rate.Keyed[string]
+	downUntil atomic.Int64 // unix nanoseconds until which Redis is skipped
+}
+
+func newLimiter(store redis.Cache, prefix string, script *goredis.Script, opts []Option,
+	newLocal func(instances int) rate.Limiter) *limiter {
+	l := &limiter{store: store, prefix: prefix, script: script}
+	l.opts.cooldown = DefaultFallbackCooldown
+	for _, opt := range opts {
+		opt(&l.opts)
+	}
+	if l.opts.instances > 0 {
+		l.local = rate.NewKeyed[string](0, time.Minute, func(string) rate.Limiter {
+			return newLocal(l.opts.instances)
+		})
+	}
+	return l
+}
+
+// run runs the script for the key, localResult decides with the local limiter of the key on fallback.
+func (l *limiter) run(ctx context.Context, key string, args []any,
+	localResult func(local rate.Limiter) Result) (Result, error) {
+	if l.local != nil && time.Now().UnixNano() < l.downUntil.Load() {
+		return localResult(l.local.Get(key)), nil
+	}
+
+	reply, err := l.store.ScriptRun(ctx, l.script, []string{l.prefix + key}, args...)
+	if err == nil {
+		return parseResult(reply)
+	}
+	if l.local == nil || ctx.Err() != nil {
+		return Result{}, err
+	}
+	l.downUntil.Store(time.Now().Add(l.opts.cooldown).UnixNano())
+	if l.opts.onFallback != nil {
+		l.opts.onFallback(err)
+	}
+	return localResult(l.local.Get(key)), nil
+}
+
+func parseResult(reply any) (Result, error) {
+	values, ok := reply.([]any)
+	if !ok || len(values) != 3 {
+		return Result{}, ErrUnexpectedReply
+	}
+	var ints [3]int64
+	for i, v := range values {
+		if ints[i], ok = v.(int64); !ok {
+			return Result{}, ErrUnexpectedReply
+		}
+	}
+	return Result{
+		Allowed:    ints[0] == 1,
+		Remaining:  int(ints[1]),
+		RetryAfter: time.Duration(ints[2]) * time.Millisecond,
+	}, nil
+}
+
+// share returns the part of the quota granted to one of the instances, at least 1.
+func share(quota float64, instances int) float64 {
+	if s := quota / float64(instances); s > 1 {
+		return s
+	}
+	return 1
+}
+
+// uniqueID returns a random identifier of the process, used to build unique sorted set members.
+func uniqueID() string {
+	var b [8]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
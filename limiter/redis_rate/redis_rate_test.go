@@ -0,0 +1,131 @@
+package redis_rate
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go-pkg/redis"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestRedis(t *testing.T) (*miniredis.Miniredis, redis.Cache) {
+	mr := miniredis.RunT(t)
+	mr.SetTime(time.Unix(1700000000, 0))
+	return mr, redis.New("redis://" + mr.Addr())
+}
+
+func TestTokenBucket(t *testing.T) {
+	mr, store := newTestRedis(t)
+	ctx := context.Background()
+	// Two instances share the same quota.
+	a := NewTokenBucket(store, "quota:", 1, 3)
+	b := NewTokenBucket(store, "quota:", 1, 3)
+
+	for i := 0; i < 3; i++ {
+		res, err := []*TokenBucket{a, b, a}[i].Allow(ctx, "user-1")
+		require.NoError(t, err)
+		require.True(t, res.Allowed)
+		require.Equal(t, 2-i, res.Remaining)
+	}
+	res, err := b.Allow(ctx, "user-1")
+	require.NoError(t, err)
+	require.False(t, res.Allowed)
+	require.Equal(t, time.Second, res.RetryAfter)
+
+	res, err = a.Allow(ctx, "user-2")
+	require.NoError(t, err)
+	require.True(t, res.Allowed)
+
+	mr.SetTime(time.Unix(1700000000, 0).Add(1500 * time.Millisecond))
+	res, err = a.AllowN(ctx, "user-1", 2)
+	require.NoError(t, err)
+	require.False(t, res.Allowed)
+	require.Equal(t, 500*time.Millisecond, res.RetryAfter)
+	res, err = a.Allow(ctx, "user-1")
+	require.NoError(t, err)
+	require.True(t, res.Allowed)
+	require.Zero(t, res.Remaining)
+	require.True(t, mr.Exists("quota:user-1"))
+
+	res, err = NewTokenBucket(store, "zero:", 0, 3).Allow(ctx, "user-1")
+	require.NoError(t, err)
+	require.False(t, res.Allowed)
+}
+
+func TestSlidingWindow(t *testing.T) {
+	mr, store := newTestRedis(t)
+	ctx := context.Background()
+	start := time.Unix(1700000000, 0)
+	sw := NewSlidingWindow(store, "api:", 3, time.Second)
+
+	res, err := sw.AllowN(ctx, "key", 2)
+	require.NoError(t, err)
+	require.True(t, res.Allowed)
+	require.Equal(t, 1, res.Remaining)
+
+	mr.SetTime(start.Add(400 * time.Millisecond))
+	res, err = sw.Allow(ctx, "key")
+	require.NoError(t, err)
+	require.True(t, res.Allowed)
+	require.Zero(t, res.Remaining)
+
+	mr.SetTime(start.Add(800 * time.Millisecond))
+	res, err = sw.AllowN(ctx, "key", 3)
+	require.NoError(t, err)
+	require.False(t, res.Allowed)
+	require.Equal(t, 600*time.Millisecond, res.RetryAfter)
+
+	mr.SetTime(start.Add(1001 * time.Millisecond))
+	res, err = sw.AllowN(ctx, "key", 2)
+	require.NoError(t, err)
+	require.True(t, res.Allowed)
+	require.Zero(t, res.Remaining)
+	members, err := mr.ZMembers("api:key")
+	require.NoError(t, err)
+	require.Len(t, members, 3)
+}
+
+func TestLocalFallback(t *testing.T) {
+	mr, store := newTestRedis(t)
+	ctx := context.Background()
+
+	var fallbacks int
+	tb := NewTokenBucket(store, "quota:", 10, 4, WithLocalFallback(2),
+		WithFallbackCooldown(time.Hour), WithFallbackHandler(func(err error) {
+			require.Error(t, err)
+			fallbacks++
+		}))
+	strict := NewSlidingWindow(store, "api:", 10, time.Second)
+
+	res, err := tb.Allow(ctx, "user")
+	require.NoError(t, err)
+	require.False(t, res.Local)
+
+	mr.Close()
+	_, err = strict.Allow(ctx, "user")
+	require.Error(t, err)
+
+	// The local bucket holds half of the burst.
+	for i := 0; i < 2; i++ {
+		res, err = tb.Allow(ctx, "user")
+		require.NoError(t, err)
+		require.True(t, res.Local)
+		require.True(t, res.Allowed)
+	}
+	res, err = tb.Allow(ctx, "user")
+	require.NoError(t, err)
+	require.False(t, res.Allowed)
+	require.Equal(t, 1, fallbacks)
+
+	sw := NewSlidingWindow(store, "api:", 4, time.Second, WithLocalFallback(4))
+	res, err = sw.Allow(ctx, "user")
+	require.NoError(t, err)
+	require.True(t, res.Local)
+	require.True(t, res.Allowed)
+	res, err = sw.Allow(ctx, "user")
+	require.NoError(t, err)
+	require.False(t, res.Allowed)
+}
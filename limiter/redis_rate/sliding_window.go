@@ -0,0 +1,53 @@
+package redis_rate
+
+import (
+	"context"
+	_ "embed"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"go-pkg/limiter/rate"
+	"go-pkg/redis"
+)
+
+var (
+	//go:embed sliding_window.lua
+	slidingWindowLuaScript string
+	slidingWindowScript    = redis.NewScript(slidingWindowLuaScript)
+)
+
+// SlidingWindow is a cluster-wide sliding window log per key, allowing up to limit events within any window.
+// Every allowed event is recorded in a sorted set, so it is exact but costs memory per event.
+type SlidingWindow struct {
+	limiter *limiter
+	limit   int
+	window  time.Duration
+	id      string
+	seq     atomic.Uint64
+}
+
+// NewSlidingWindow returns a SlidingWindow storing the log of every key under prefix+key.
+func NewSlidingWindow(store redis.Cache, prefix string, limit int, window time.Duration, opts ...Option) *SlidingWindow {
+	sw := &SlidingWindow{limit: limit, window: window, id: uniqueID()}
+	sw.limiter = newLimiter(store, prefix, slidingWindowScript, opts, func(instances int) rate.Limiter {
+		return rate.NewSlidingWindow(int(share(float64(limit), instances)), window)
+	})
+	return sw
+}
+
+// Allow is shorthand for AllowN(ctx, key, 1).
+func (sw *SlidingWindow) Allow(ctx context.Context, key string) (Result, error) {
+	return sw.AllowN(ctx, key, 1)
+}
+
+// AllowN reports whether n events of the key may happen now, they are only recorded if they are allowed.
+func (sw *SlidingWindow) AllowN(ctx context.Context, key string, n int) (Result, error) {
+	member := sw.id + ":" + strconv.FormatUint(sw.seq.Add(1), 10)
+	args := []any{sw.limit, sw.window.Microseconds(), n, member}
+	return sw.limiter.run(ctx, key, args, func(local rate.Limiter) Result {
+		window := local.(*rate.SlidingWindow)
+		allowed := window.AllowN(n)
+		return Result{Allowed: allowed, Remaining: max(int(float64(window.Limit())-window.Count()), 0), Local: true}
+	})
+}
@@ -0,0 +1,33 @@
+-- KEYS[1]: log key
+-- ARGV: limit, window in microseconds, n, unique member prefix
+-- returns {allowed, remaining events, retry after in milliseconds}
+if redis.replicate_commands then
+    redis.replicate_commands()
+end
+
+local limit = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local n = tonumber(ARGV[3])
+
+local t = redis.call("TIME")
+local now = tonumber(t[1]) * 1000000 + tonumber(t[2])
+
+redis.call("ZREMRANGEBYSCORE", KEYS[1], "-inf", now - window)
+local count = redis.call("ZCARD", KEYS[1])
+
+if count + n <= limit then
+    for i = 1, n do
+        redis.call("ZADD", KEYS[1], now, ARGV[4] .. ":" .. i)
+    end
+    redis.call("PEXPIRE", KEYS[1], math.ceil(window / 1000))
+    return {1, limit - count - n, 0}
+end
+
+-- the events fit once the (count + n - limit) oldest ones leave the window.
+local retry = math.ceil(window / 1000)
+local idx = count + n - limit - 1
+if idx < count then
+    local oldest = redis.call("ZRANGE", KEYS[1], idx, idx, "WITHSCORES")
+    retry = math.ceil((tonumber(oldest[2]) + window - now) / 1000)
+end
+return {0, limit - count, retry}
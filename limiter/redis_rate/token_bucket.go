@@ -0,0 +1,50 @@
+package redis_rate
+
+import (
+	"context"
+	_ "embed"
+
+	"go-pkg/limiter/rate"
+	"go-pkg/redis"
+)
+
+var (
+	//go:embed token_bucket.lua
+	tokenBucketLuaScript string
+	tokenBucketScript    = redis.NewScript(tokenBucketLuaScript)
+)
+
+// TokenBucket is a cluster-wide token bucket per key, filled with rate tokens per second up to burst tokens.
+type TokenBucket struct {
+	limiter *limiter
+	rate    float64
+	burst   int
+}
+
+// NewTokenBucket returns a TokenBucket storing the bucket of every key under prefix+key.
+// A rate <= 0 denies every event, with a zero RetryAfter.
+func NewTokenBucket(store redis.Cache, prefix string, r float64, burst int, opts ...Option) *TokenBucket {
+	tb := &TokenBucket{rate: r, burst: burst}
+	tb.limiter = newLimiter(store, prefix, tokenBucketScript, opts, func(instances int) rate.Limiter {
+		if r <= 0 {
+			return rate.NewTokenBucket(0, 0)
+		}
+		return rate.NewTokenBucket(share(r, instances), int(share(float64(burst), instances)))
+	})
+	return tb
+}
+
+// Allow is shorthand for AllowN(ctx, key, 1).
+func (tb *TokenBucket) Allow(ctx context.Context, key string) (Result, error) {
+	return tb.AllowN(ctx, key, 1)
+}
+
+// AllowN reports whether n events of the key may happen now, the tokens are only taken if they are allowed.
+func (tb *TokenBucket) AllowN(ctx context.Context, key string, n int) (Result, error) {
+	args := []any{formatFloat(tb.rate), tb.burst, n}
+	return tb.limiter.run(ctx, key, args, func(local rate.Limiter) Result {
+		bucket := local.(*rate.TokenBucket)
+		allowed := bucket.AllowN(n)
+		return Result{Allowed: allowed, Remaining: max(int(bucket.Tokens()), 0), Local: true}
+	})
+}
@@ -0,0 +1,43 @@
+-- KEYS[1]: bucket key
+-- ARGV: rate (tokens per second), burst, n
+-- returns {allowed, remaining tokens, retry after in milliseconds}
+if redis.replicate_commands then
+    redis.replicate_commands()
+end
+
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local n = tonumber(ARGV[3])
+
+-- A bucket which never refills denies every event.
+if rate <= 0 then
+    return {0, 0, 0}
+end
+
+local t = redis.call("TIME")
+local now = tonumber(t[1]) * 1000000 + tonumber(t[2])
+
+local state = redis.call("HMGET", KEYS[1], "tokens", "ts")
+local tokens = tonumber(state[1])
+local ts = tonumber(state[2])
+if tokens == nil or ts == nil then
+    tokens = burst
+    ts = now
+end
+if now > ts then
+    tokens = math.min(burst, tokens + (now - ts) * rate / 1000000)
+    ts = now
+end
+
+local allowed = 0
+local retry = 0
+if tokens >= n then
+    tokens = tokens - n
+    allowed = 1
+else
+    retry = math.ceil((n - tokens) * 1000 / rate)
+end
+
+redis.call("HSET", KEYS[1], "tokens", tostring(tokens), "ts", tostring(ts))
+redis.call("PEXPIRE", KEYS[1], math.ceil(burst * 1000 / rate) + 1000)
+return {allowed, math.floor(tokens), retry}
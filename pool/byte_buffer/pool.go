@@ -29,9 +29,32 @@ type Pool struct {
 	defaultSize uint64
 	maxSize     uint64
 
+	// cumulative counters reported by Stats, calls is reset by every calibration.
+	totalCalls   [steps]uint64
+	totalSize    uint64
+	calibrations uint64
+	discards     uint64
+
 	pool sync.Pool
 }
 
+// PoolStats is a snapshot of the calibration state of a Pool.
+type PoolStats struct {
+	DefaultSize  uint64 // calibrated size of new buffers
+	MaxSize      uint64 // calibrated size above which buffers are discarded
+	Calibrations uint64 // number of calibrations so far
+	Discards     uint64 // number of buffers discarded by Put for exceeding MaxSize
+	// Calls holds the number of Put calls per size bucket, bucket i counts the buffers
+	// up to BucketSize(i) bytes and the last bucket counts all larger ones too.
+	Calls    [steps]uint64
+	CallsSum uint64 // total size of the buffers passed to Put
+}
+
+// BucketSize returns the upper bound in bytes of the i-th bucket of PoolStats.Calls.
+func BucketSize(i int) uint64 {
+	return minSize << i
+}
+
 var defaultPool Pool
 
 // Get returns an empty byte buffer from the pool.
@@ -66,6 +89,8 @@ func Put(b *ByteBuffer) { defaultPool.Put(b) }
 // The buffer mustn't be accessed after returning to the pool.
 func (p *Pool) Put(b *ByteBuffer) {
 	idx := index(len(b.B))
+	atomic.AddUint64(&p.totalCalls[idx], 1)
+	atomic.AddUint64(&p.totalSize, uint64(len(b.B)))
 
 	if atomic.AddUint64(&p.calls[idx], 1) > calibrateCallsThreshold {
 		p.calibrate()
@@ -75,7 +100,27 @@ func (p *Pool) Put(b *ByteBuffer) {
 	if maxSize == 0 || cap(b.B) <= maxSize {
 		b.Reset()
 		p.pool.Put(b)
+	} else {
+		atomic.AddUint64(&p.discards, 1)
+	}
+}
+
+// Stats returns a snapshot of the calibration state of the built-in pool.
+func Stats() PoolStats { return defaultPool.Stats() }
+
+// Stats returns a snapshot of the calibration state of the pool.
+func (p *Pool) Stats() PoolStats {
+	s := PoolStats{
+		DefaultSize:  atomic.LoadUint64(&p.defaultSize),
+		MaxSize:      atomic.LoadUint64(&p.maxSize),
+		Calibrations: atomic.LoadUint64(&p.calibrations),
+		Discards:     atomic.LoadUint64(&p.discards),
+		CallsSum:     atomic.LoadUint64(&p.totalSize),
+	}
+	for i := range s.Calls {
+		s.Calls[i] = atomic.LoadUint64(&p.totalCalls[i])
 	}
+	return s
 }
 
 func (p *Pool) calibrate() {
@@ -113,6 +158,7 @@ func (p *Pool) calibrate() {
 
 	atomic.StoreUint64(&p.defaultSize, defaultSize)
 	atomic.StoreUint64(&p.maxSize, maxSize)
+	atomic.AddUint64(&p.calibrations, 1)
 
 	atomic.StoreUint64(&p.calibrating, 0)
 }
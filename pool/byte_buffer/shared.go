@@ -0,0 +1,111 @@
+package byte_buffer
+
+import (
+	"io"
+	"sync/atomic"
+)
+
+// SharedBuffer is a reference-counted ByteBuffer which can be handed to several
+// owners, e.g. one encoded message fanned out to many connections.
+// Every owner calls Release once done with it and the underlying ByteBuffer goes back
+// to its pool when the last reference is released.
+//
+// The content must only be written before the buffer is shared.
+// Built with the pooldebug tag, using a SharedBuffer after its last Release panics.
+type SharedBuffer struct {
+	b     *ByteBuffer
+	pool  *Pool
+	refs  atomic.Int32
+	guard releaseGuard
+}
+
+// GetShared returns an empty SharedBuffer holding one reference, backed by the built-in pool.
+func GetShared() *SharedBuffer { return defaultPool.GetShared() }
+
+// GetShared returns an empty SharedBuffer holding one reference, backed by the pool.
+func (p *Pool) GetShared() *SharedBuffer {
+	return p.Share(p.Get())
+}
+
+// Share wraps the byte buffer obtained via Get into a SharedBuffer holding one reference,
+// b is put back to the pool by the last Release and mustn't be used directly anymore.
+func (p *Pool) Share(b *ByteBuffer) *SharedBuffer {
+	s := &SharedBuffer{b: b, pool: p}
+	s.refs.Store(1)
+	return s
+}
+
+// Retain adds a reference to the buffer and returns it.
+// It panics if the last reference has already been released.
+func (s *SharedBuffer) Retain() *SharedBuffer {
+	for {
+		refs := s.refs.Load()
+		if refs <= 0 {
+			s.guard.panicReleased("Retain")
+			panic("byte_buffer: SharedBuffer retained after release")
+		}
+		if s.refs.CompareAndSwap(refs, refs+1) {
+			return s
+		}
+	}
+}
+
+// Release drops a reference to the buffer, it reports whether it was the last one
+// and the buffer has gone back to the pool.
+func (s *SharedBuffer) Release() bool {
+	refs := s.refs.Add(-1)
+	if refs > 0 {
+		return false
+	}
+	if refs < 0 {
+		s.guard.panicReleased("Release")
+		panic("byte_buffer: SharedBuffer released more times than retained")
+	}
+
+	b := s.b
+	if s.guard.release(b) {
+		s.pool.Put(b)
+	}
+	return true
+}
+
+// Refs returns the number of references currently held.
+func (s *SharedBuffer) Refs() int32 {
+	return s.refs.Load()
+}
+
+// Bytes returns the content of the buffer, it is valid until the caller's reference is released.
+func (s *SharedBuffer) Bytes() []byte {
+	s.check("Bytes")
+	return s.b.B
+}
+
+// Len returns the size of the buffer.
+func (s *SharedBuffer) Len() int {
+	s.check("Len")
+	return len(s.b.B)
+}
+
+// Write implements io.Writer - it appends p to the buffer.
+func (s *SharedBuffer) Write(p []byte) (int, error) {
+	s.check("Write")
+	return s.b.Write(p)
+}
+
+// WriteString appends str to the buffer.
+func (s *SharedBuffer) WriteString(str string) (int, error) {
+	s.check("WriteString")
+	return s.b.WriteString(str)
+}
+
+// WriteTo implements io.WriterTo.
+func (s *SharedBuffer) WriteTo(w io.Writer) (int64, error) {
+	s.check("WriteTo")
+	return s.b.WriteTo(w)
+}
+
+func (s *SharedBuffer) check(op string) {
+	if s.refs.Load() <= 0 {
+		s.guard.panicReleased(op)
+	}
+}
@@ -0,0 +1,27 @@
+//go:build pooldebug
+
+package byte_buffer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSharedBuffer_UseAfterRelease(t *testing.T) {
+	s := GetShared()
+	_, _ = s.WriteString("secret")
+	b := s.Bytes()
+	require.True(t, s.Release())
+
+	require.Equal(t, []byte{poison, poison, poison, poison, poison, poison}, b)
+	for name, use := range map[string]func(){
+		"Bytes":   func() { s.Bytes() },
+		"Len":     func() { s.Len() },
+		"Write":   func() { _, _ = s.Write([]byte("x")) },
+		"Retain":  func() { s.Retain() },
+		"Release": func() { s.Release() },
+	} {
+		require.Panics(t, use, name)
+	}
+}
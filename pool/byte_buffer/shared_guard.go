@@ -0,0 +1,11 @@
+//go:build !pooldebug
+
+package byte_buffer
+
+// releaseGuard is a no-op unless built with the pooldebug tag.
+type releaseGuard struct{}
+
+// release reports whether the buffer can go back to the pool.
+func (*releaseGuard) release(*ByteBuffer) bool { return true }
+
+func (*releaseGuard) panicReleased(string) {}
@@ -0,0 +1,38 @@
+//go:build pooldebug
+
+package byte_buffer
+
+import (
+	"fmt"
+	"runtime/debug"
+	"sync/atomic"
+)
+
+// poison is written over the content of released buffers.
+const poison = 0xdd
+
+// releaseGuard records where the last reference of a SharedBuffer was released, and keeps
+// the released ByteBuffer out of the pool so that a late access can't observe another
+// owner's data. The state is only accessed atomically, so the checks themselves don't
+// trip the race detector.
+type releaseGuard struct {
+	stack atomic.Pointer[string]
+}
+
+// release poisons the buffer and reports that it must not go back to the pool.
+func (g *releaseGuard) release(b *ByteBuffer) bool {
+	stack := string(debug.Stack())
+	g.stack.Store(&stack)
+	for i := range b.B {
+		b.B[i] = poison
+	}
+	return false
+}
+
+func (g *releaseGuard) panicReleased(op string) {
+	stack := "unknown"
+	if s := g.stack.Load(); s != nil {
+		stack = *s
+	}
+	panic(fmt.Sprintf("byte_buffer: SharedBuffer.%s called after release, released at:\n%s", op, stack))
+}
@@ -0,0 +1,61 @@
+package byte_buffer
+
+import (
+	"bytes"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSharedBuffer(t *testing.T) {
+	s := GetShared()
+	_, _ = s.WriteString("hello ")
+	_, _ = s.Write([]byte("world"))
+	require.EqualValues(t, 1, s.Refs())
+	require.Equal(t, 11, s.Len())
+
+	const owners = 16
+	for i := 0; i < owners; i++ {
+		s.Retain()
+	}
+	require.EqualValues(t, owners+1, s.Refs())
+
+	var (
+		wg   sync.WaitGroup
+		last atomic.Int32
+	)
+	wg.Add(owners)
+	for i := 0; i < owners; i++ {
+		go func() {
+			defer wg.Done()
+			var w bytes.Buffer
+			_, err := s.WriteTo(&w)
+			require.NoError(t, err)
+			require.Equal(t, "hello world", w.String())
+			if s.Release() {
+				last.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	require.Zero(t, last.Load())
+	require.EqualValues(t, 1, s.Refs())
+
+	require.True(t, s.Release())
+	require.Zero(t, s.Refs())
+	require.Panics(t, func() { s.Release() })
+}
+
+func TestPool_Share(t *testing.T) {
+	var p Pool
+	b := p.Get()
+	b.SetString("payload")
+
+	s := p.Share(b).Retain()
+	require.Equal(t, "payload", string(s.Bytes()))
+	require.False(t, s.Release())
+	require.True(t, s.Release())
+	require.Panics(t, func() { s.Retain() })
+}
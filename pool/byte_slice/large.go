@@ -0,0 +1,331 @@
+package byte_slice
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"math/bits"
+	"slices"
+	"sync"
+	"unsafe"
+)
+
+const (
+	// LargeMinSize is the smallest size served by the large-buffer tier.
+	LargeMinSize = 64 << 10 // 64KB
+	// LargeMaxSize is the largest size served by the large-buffer tier.
+	LargeMaxSize = 16 << 20 // 16MB
+	// DefaultLargeBudget is the memory budget of the built-in large pool.
+	DefaultLargeBudget = 512 << 20 // 512MB
+
+	largeMinBits   = 16 // log2(LargeMinSize)
+	largeClasses   = 9  // 64KB, 128KB, ..., 16MB
+	largeArenaSize = 4 << 20
+)
+
+// ErrLargeBudgetExceeded will be returned by GetCtx if the requested size can never fit in the budget.
+var ErrLargeBudgetExceeded = errors.New("requested size exceeds the large pool budget")
+
+var builtinLargePool = NewLargePool(DefaultLargeBudget)
+
+// LargePool hands out page-aligned byte slices of LargeMinSize to LargeMaxSize bytes, carved from
+// mmap'd arenas outside of the Go heap, and bounded by a global memory budget.
+// Smaller sizes are served by the built-in Pool and larger ones by the Go heap, so a LargePool
+// can replace Get/Put for every size.
+//
+// Slices from the large tier are never garbage collected, they must be returned with Put.
+type LargePool struct {
+	mu       sync.Mutex
+	budget   int64
+	mapped   int64
+	inUse    int64
+	free     [largeClasses][][]byte
+	arenas   []*arena      // ordered by address
+	released chan struct{} // closed and replaced every time memory is given back
+}
+
+type arena struct {
+	mem   []byte
+	class int
+	used  []bool // slots handed out
+	free  int    // number of slots of this arena in the free list
+}
+
+func (a *arena) start() uintptr {
+	return uintptr(unsafe.Pointer(unsafe.SliceData(a.mem)))
+}
+
+// slot returns the index of the slot holding the address.
+func (a *arena) slot(ptr uintptr) int {
+	return int(ptr-a.start()) >> (a.class + largeMinBits)
+}
+
+// slotBuf returns the empty slice of the i-th slot.
+func (a *arena) slotBuf(i int) []byte {
+	off := i << (a.class + largeMinBits)
+	return a.mem[off : off : off+1<<(a.class+largeMinBits)]
+}
+
+// NewLargePool returns a LargePool mapping at most budget bytes.
+func NewLargePool(budget int64) *LargePool {
+	return &LargePool{
+		budget:   budget,
+		released: make(chan struct{}),
+	}
+}
+
+// GetLarge returns a byte slice with given length from the built-in large pool.
+func GetLarge(size int) []byte {
+	return builtinLargePool.Get(size)
+}
+
+// GetLargeCtx returns a byte slice with given length from the built-in large pool,
+// blocking while the budget is exhausted.
+func GetLargeCtx(ctx context.Context, size int) ([]byte, error) {
+	return builtinLargePool.GetCtx(ctx, size)
+}
+
+// PutLarge returns the byte slice to the built-in large pool.
+func PutLarge(buf []byte) {
+	builtinLargePool.Put(buf)
+}
+
+// SetLargeBudget changes the memory budget of the built-in large pool.
+func SetLargeBudget(budget int64) {
+	builtinLargePool.SetBudget(budget)
+}
+
+// DefaultLargePool returns the built-in large pool.
+func DefaultLargePool() *LargePool {
+	return builtinLargePool
+}
+
+// Get retrieves a byte slice of the length requested by the caller.
+// If the budget is exhausted, it falls back to a page-aligned slice allocated from the Go heap
+// instead of blocking.
+func (p *LargePool) Get(size int) []byte {
+	if size < LargeMinSize || size > LargeMaxSize {
+		return Get(size)
+	}
+	if buf := p.tryGet(size); buf != nil {
+		return buf
+	}
+	return heapAligned(size, 1<<largeClass(size))
+}
+
+// GetCtx is like Get but blocks while the budget is exhausted until enough memory is put back or ctx is done.
+func (p *LargePool) GetCtx(ctx context.Context, size int) ([]byte, error) {
+	if size < LargeMinSize || size > LargeMaxSize {
+		return Get(size), nil
+	}
+	for {
+		p.mu.Lock()
+		if arenaBytes(largeClass(size)-largeMinBits) > p.budget {
+			p.mu.Unlock()
+			return nil, ErrLargeBudgetExceeded
+		}
+		buf := p.getLocked(size)
+		released := p.released
+		p.mu.Unlock()
+		if buf != nil {
+			return buf, nil
+		}
+
+		select {
+		case <-released:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Put returns the byte slice to the pool, slices that don't come from the large tier go to the built-in Pool.
+// A slice of the large tier may have been resliced, and putting it twice is ignored.
+func (p *LargePool) Put(buf []byte) {
+	if cap(buf) == 0 {
+		return
+	}
+
+	ptr := uintptr(unsafe.Pointer(unsafe.SliceData(buf)))
+	p.mu.Lock()
+	a := p.arenaLocked(ptr)
+	if a == nil {
+		p.mu.Unlock()
+		if cap(buf) >= LargeMinSize && cap(buf) <= LargeMaxSize {
+			return // heap fallback of Get, leave it to the GC
+		}
+		Put(buf)
+		return
+	}
+	i := a.slot(ptr)
+	if !a.used[i] {
+		p.mu.Unlock()
+		return
+	}
+	a.used[i] = false
+	p.free[a.class] = append(p.free[a.class], a.slotBuf(i))
+	a.free++
+	p.inUse -= 1 << (a.class + largeMinBits)
+	if p.mapped > p.budget {
+		p.reclaimLocked(p.mapped - p.budget)
+	}
+	p.notifyLocked()
+	p.mu.Unlock()
+}
+
+// SetBudget changes the memory budget, unused arenas are unmapped if the pool is over the new budget.
+func (p *LargePool) SetBudget(budget int64) {
+	p.mu.Lock()
+	p.budget = budget
+	if p.mapped > budget {
+		p.reclaimLocked(p.mapped - budget)
+	}
+	p.notifyLocked()
+	p.mu.Unlock()
+}
+
+// Mapped returns the number of bytes currently mapped by the pool.
+func (p *LargePool) Mapped() int64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.mapped
+}
+
+// InUse returns the number of bytes of the large tier currently handed out.
+func (p *LargePool) InUse() int64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.inUse
+}
+
+func (p *LargePool) tryGet(size int) []byte {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.getLocked(size)
+}
+
+// getLocked pops a free slice of the size class or maps a new arena, it returns nil if
+// the budget is exhausted. It must be called with mu held.
+func (p *LargePool) getLocked(size int) []byte {
+	class := largeClass(size) - largeMinBits
+	classSize := 1 << (class + largeMinBits)
+	if n := len(p.free[class]); n == 0 {
+		need := arenaBytes(class)
+		if p.mapped+need > p.budget {
+			p.reclaimLocked(p.mapped + need - p.budget)
+		}
+		if p.mapped+need > p.budget || !p.mapLocked(class) {
+			return nil
+		}
+	}
+
+	n := len(p.free[class])
+	buf := p.free[class][n-1]
+	p.free[class] = p.free[class][:n-1]
+	ptr := uintptr(unsafe.Pointer(unsafe.SliceData(buf)))
+	a := p.arenaLocked(ptr)
+	a.used[a.slot(ptr)] = true
+	a.free--
+	p.inUse += int64(classSize)
+	return buf[:size]
+}
+
+// arenaLocked returns the arena holding the address, nil if there is none. It must be called with mu held.
+func (p *LargePool) arenaLocked(ptr uintptr) *arena {
+	i, found := slices.BinarySearchFunc(p.arenas, ptr, func(a *arena, ptr uintptr) int {
+		switch start := a.start(); {
+		case ptr < start:
+			return 1
+		case ptr >= start+uintptr(len(a.mem)):
+			return -1
+		}
+		return 0
+	})
+	if !found {
+		return nil
+	}
+	return p.arenas[i]
+}
+
+// mapLocked maps a new arena for the size class and pushes its slices to the free list.
+func (p *LargePool) mapLocked(class int) bool {
+	classSize := 1 << (class + largeMinBits)
+	mem, err := mmap(int(arenaBytes(class)))
+	if err != nil {
+		return false
+	}
+	a := &arena{mem: mem, class: class, used: make([]bool, len(mem)/classSize)}
+	for i := range a.used {
+		p.free[class] = append(p.free[class], a.slotBuf(i))
+		a.free++
+	}
+	i, _ := slices.BinarySearchFunc(p.arenas, a.start(), func(a *arena, start uintptr) int {
+		return cmp.Compare(a.start(), start)
+	})
+	p.arenas = slices.Insert(p.arenas, i, a)
+	p.mapped += int64(len(mem))
+	return true
+}
+
+// reclaimLocked unmaps fully free arenas until at least n bytes are released or none is left.
+func (p *LargePool) reclaimLocked(n int64) {
+	var released int64
+	for class := range p.free {
+		if released >= n {
+			return
+		}
+		kept := p.free[class][:0]
+		var unmapped map[*arena]bool
+		for _, buf := range p.free[class] {
+			a := p.arenaLocked(uintptr(unsafe.Pointer(unsafe.SliceData(buf[:1]))))
+			if unmapped[a] || (released < n && a.free == len(a.used)) {
+				if unmapped == nil {
+					unmapped = make(map[*arena]bool)
+				}
+				if !unmapped[a] {
+					unmapped[a] = true
+					released += int64(len(a.mem))
+				}
+				continue
+			}
+			kept = append(kept, buf)
+		}
+		p.free[class] = kept
+		p.arenas = slices.DeleteFunc(p.arenas, func(a *arena) bool { return unmapped[a] })
+		for a := range unmapped {
+			p.mapped -= int64(len(a.mem))
+			_ = munmap(a.mem)
+		}
+	}
+}
+
+// notifyLocked wakes up the callers blocked in GetCtx.
+func (p *LargePool) notifyLocked() {
+	close(p.released)
+	p.released = make(chan struct{})
+}
+
+// largeClass returns log2 of the power-of-two size class serving size.
+func largeClass(size int) int {
+	return bits.Len(uint(size - 1))
+}
+
+// arenaBytes returns the size of the arenas of the class, an arena holds at least one slice.
+func arenaBytes(class int) int64 {
+	classSize := int64(1) << (class + largeMinBits)
+	if classSize > largeArenaSize {
+		return classSize
+	}
+	return largeArenaSize
+}
+
+// heapAligned allocates a slice of the given length and capacity from the Go heap, aligned to the page size.
+func heapAligned(size, capacity int) []byte {
+	pageSize := pageSize()
+	buf := make([]byte, capacity+pageSize)
+	off := 0
+	if rem := int(uintptr(unsafe.Pointer(unsafe.SliceData(buf))) & uintptr(pageSize-1)); rem != 0 {
+		off = pageSize - rem
+	}
+	return buf[off : off+size : off+capacity]
+}
@@ -0,0 +1,105 @@
+package byte_slice
+
+import (
+	"context"
+	"testing"
+	"time"
+	"unsafe"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLargePool(t *testing.T) {
+	p := NewLargePool(8 << 20)
+
+	small := p.Get(1024)
+	require.Len(t, small, 1024)
+	p.Put(small)
+	require.Zero(t, p.Mapped())
+
+	buf := p.Get(100 << 10)
+	require.Len(t, buf, 100<<10)
+	require.EqualValues(t, 128<<10, cap(buf))
+	require.Zero(t, uintptr(unsafe.Pointer(&buf[0]))%uintptr(pageSize()))
+	require.EqualValues(t, largeArenaSize, p.Mapped())
+	require.EqualValues(t, 128<<10, p.InUse())
+	copy(buf, "hello")
+
+	p.Put(buf)
+	require.Zero(t, p.InUse())
+	again := p.Get(128 << 10)
+	require.Equal(t, &buf[0], &again[0])
+	require.EqualValues(t, "hello", again[:5])
+	p.Put(again)
+
+	// Mapping a 4MB arena of another class reclaims nothing but fits the budget,
+	// the third class forces the free arenas to be unmapped.
+	a := p.Get(1 << 20)
+	require.EqualValues(t, 2*largeArenaSize, p.Mapped())
+	b := p.Get(2 << 20)
+	require.EqualValues(t, 2*largeArenaSize, p.Mapped())
+	require.EqualValues(t, 3<<20, p.InUse())
+	p.Put(a)
+	p.Put(b)
+
+	p.SetBudget(0)
+	require.Zero(t, p.Mapped())
+	fallback := p.Get(LargeMinSize)
+	require.Len(t, fallback, LargeMinSize)
+	require.Zero(t, uintptr(unsafe.Pointer(&fallback[0]))%uintptr(pageSize()))
+	p.Put(fallback)
+	require.Zero(t, p.Mapped())
+
+	huge := p.Get(LargeMaxSize + 1)
+	require.Len(t, huge, LargeMaxSize+1)
+	p.Put(huge)
+}
+
+func TestLargePool_Reslice(t *testing.T) {
+	p := NewLargePool(8 << 20)
+	buf := p.Get(100 << 10)
+	other := p.Get(100 << 10)
+	require.EqualValues(t, 256<<10, p.InUse())
+
+	// A resliced slice gives its slot back, putting it again does nothing.
+	p.Put(buf[4096:])
+	require.EqualValues(t, 128<<10, p.InUse())
+	p.Put(buf)
+	require.EqualValues(t, 128<<10, p.InUse())
+	again := p.Get(128 << 10)
+	require.Equal(t, &buf[0], &again[0])
+
+	p.Put(other[len(other)-1:])
+	p.Put(other)
+	p.Put(again)
+	require.Zero(t, p.InUse())
+}
+
+func TestLargePool_GetCtx(t *testing.T) {
+	p := NewLargePool(largeArenaSize)
+	ctx := context.Background()
+
+	_, err := p.GetCtx(ctx, LargeMaxSize)
+	require.ErrorIs(t, err, ErrLargeBudgetExceeded)
+
+	held, err := p.GetCtx(ctx, largeArenaSize)
+	require.NoError(t, err)
+
+	timeout, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	_, err = p.GetCtx(timeout, LargeMinSize)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	got := make(chan []byte, 1)
+	go func() {
+		buf, _ := p.GetCtx(ctx, LargeMinSize)
+		got <- buf
+	}()
+	time.Sleep(10 * time.Millisecond)
+	p.Put(held)
+	buf := <-got
+	require.Len(t, buf, LargeMinSize)
+	require.EqualValues(t, largeArenaSize, p.Mapped())
+	p.Put(buf)
+	require.Zero(t, p.InUse())
+}
@@ -0,0 +1,18 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly)
+
+package byte_slice
+
+import "os"
+
+// mmap falls back to the Go heap on platforms without anonymous mappings.
+func mmap(size int) ([]byte, error) {
+	return heapAligned(size, size), nil
+}
+
+func munmap([]byte) error {
+	return nil
+}
+
+func pageSize() int {
+	return os.Getpagesize()
+}
@@ -0,0 +1,20 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+
+package byte_slice
+
+import (
+	"os"
+	"syscall"
+)
+
+func mmap(size int) ([]byte, error) {
+	return syscall.Mmap(-1, 0, size, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_ANON|syscall.MAP_PRIVATE)
+}
+
+func munmap(mem []byte) error {
+	return syscall.Munmap(mem)
+}
+
+func pageSize() int {
+	return os.Getpagesize()
+}
@@ -1 +1,350 @@
+// Package goroutine implements a bounded goroutine pool.
 package goroutine
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go-pkg/pool/queue"
+	"go-pkg/rec"
+)
+
+var (
+	// ErrPoolClosed will be returned when submitting a task to a released pool.
+	ErrPoolClosed = errors.New("goroutine pool is closed")
+	// ErrPoolOverload will be returned when submitting a task to a non-blocking pool whose backlog is full.
+	ErrPoolOverload = errors.New("goroutine pool is overloaded")
+	// ErrInvalidCapacity will be returned when creating a pool with a non-positive capacity.
+	ErrInvalidCapacity = errors.New("goroutine pool capacity must be positive")
+)
+
+// Pool runs submitted functions on a bounded number of worker goroutines.
+// Tasks that can't be picked up by a worker right away wait in the backlog queue.
+type Pool struct {
+	capacity atomic.Int32
+	running  atomic.Int32
+	blocked  atomic.Int32 // submitters waiting for backlog space
+	waiting  atomic.Int32 // backlog slots reserved by submitters, released once their tasks are dequeued
+	// closeMu is read-locked by submitters around the closed check and the enqueue, so that Release
+	// never misses a task.
+	closeMu sync.RWMutex
+	closed  atomic.Bool
+
+	mu   sync.Mutex
+	idle []*worker // guarded by mu
+
+	space   chan struct{} // wakes up a blocked submitter
+	closing chan struct{}
+	wg      sync.WaitGroup
+
+	opts options
+}
+
+type worker struct {
+	wake     chan bool // true asks the worker to exit
+	lastUsed time.Time
+}
+
+// New returns a Pool running at most size workers.
+func New(size int, opts ...Option) (*Pool, error) {
+	if size <= 0 {
+		return nil, ErrInvalidCapacity
+	}
+	p := &Pool{
+		space:   make(chan struct{}, 1),
+		closing: make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(&p.opts)
+	}
+	if p.opts.queue == nil {
+		p.opts.queue = queue.NewLockFreeQueue()
+	}
+	if p.opts.expiry <= 0 {
+		p.opts.expiry = DefaultExpiry
+	}
+	p.capacity.Store(int32(size))
+
+	if p.opts.fixed {
+		p.mu.Lock()
+		for i := 0; i < size; i++ {
+			p.spawn()
+		}
+		p.mu.Unlock()
+	} else {
+		go p.purge()
+	}
+	return p, nil
+}
+
+// Submit runs fn on a worker, it blocks while the backlog is full unless the pool is non-blocking.
+func (p *Pool) Submit(fn func()) error {
+	return p.SubmitCtx(context.Background(), fn)
+}
+
+// SubmitCtx is like Submit but gives up with ctx.Err() when ctx is done while blocking.
+func (p *Pool) SubmitCtx(ctx context.Context, fn func()) error {
+	if p.closed.Load() {
+		return ErrPoolClosed
+	}
+	if err := p.waitForSpace(ctx); err != nil {
+		return err
+	}
+
+	task := queue.GetTask()
+	task.Exec, task.Param = runFunc, fn
+	p.closeMu.RLock()
+	if p.closed.Load() {
+		p.closeMu.RUnlock()
+		p.waiting.Add(-1)
+		queue.PutTask(task)
+		return ErrPoolClosed
+	}
+	p.opts.queue.Enqueue(task)
+	p.closeMu.RUnlock()
+	p.dispatch()
+	return nil
+}
+
+// Running returns the number of live workers.
+func (p *Pool) Running() int {
+	return int(p.running.Load())
+}
+
+// Waiting returns the number of tasks waiting in the backlog.
+func (p *Pool) Waiting() int {
+	return int(p.opts.queue.Length())
+}
+
+// Capacity returns the maximum number of workers.
+func (p *Pool) Capacity() int {
+	return int(p.capacity.Load())
+}
+
+// Idle returns the number of workers waiting for tasks.
+func (p *Pool) Idle() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.idle)
+}
+
+// Tune changes the maximum number of workers at runtime, it does nothing if size <= 0.
+// Extra workers exit once they finish their current task.
+func (p *Pool) Tune(size int) {
+	if size <= 0 {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed.Load() {
+		return
+	}
+	p.capacity.Store(int32(size))
+	for len(p.idle) > 0 && p.running.Load() > int32(size) {
+		p.stopIdle(len(p.idle) - 1)
+	}
+	for n := p.opts.queue.Length(); n > 0 && p.running.Load() < int32(size); n-- {
+		p.spawn()
+	}
+	if p.opts.fixed {
+		for p.running.Load() < int32(size) {
+			p.spawn()
+		}
+	}
+}
+
+// Release closes the pool and waits until the backlog is drained and all workers exit,
+// it returns ctx.Err() if ctx is done first.
+func (p *Pool) Release(ctx context.Context) error {
+	p.closeMu.Lock()
+	closing := p.closed.CompareAndSwap(false, true)
+	p.closeMu.Unlock()
+
+	p.mu.Lock()
+	if closing {
+		close(p.closing)
+		for len(p.idle) > 0 {
+			w := p.idle[len(p.idle)-1]
+			p.idle = p.idle[:len(p.idle)-1]
+			w.wake <- false
+		}
+		if p.running.Load() == 0 && !p.opts.queue.IsEmpty() {
+			p.spawn()
+		}
+	}
+	p.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// waitForSpace blocks until it reserves a slot of the backlog for one more task.
+func (p *Pool) waitForSpace(ctx context.Context) error {
+	maxWaiting := int32(p.opts.maxWaiting)
+	if maxWaiting <= 0 {
+		p.waiting.Add(1)
+		return nil
+	}
+	if p.reserve(maxWaiting) {
+		return nil
+	}
+	if p.opts.nonBlocking {
+		return ErrPoolOverload
+	}
+
+	p.blocked.Add(1)
+	defer p.blocked.Add(-1)
+	for !p.reserve(maxWaiting) {
+		select {
+		case <-p.space:
+		case <-p.closing:
+			return ErrPoolClosed
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// reserve takes a slot of the backlog, it returns false if the maxWaiting slots are taken.
+func (p *Pool) reserve(maxWaiting int32) bool {
+	for {
+		n := p.waiting.Load()
+		if n >= maxWaiting {
+			return false
+		}
+		if p.waiting.CompareAndSwap(n, n+1) {
+			return true
+		}
+	}
+}
+
+// dispatch hands the backlog to an idle worker, or spawns a new one if the pool isn't full.
+// Once the pool is closed, Release takes care of the backlog.
+func (p *Pool) dispatch() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed.Load() {
+		return
+	}
+	if n := len(p.idle); n > 0 {
+		w := p.idle[n-1]
+		p.idle = p.idle[:n-1]
+		w.wake <- false
+		return
+	}
+	if p.running.Load() < p.capacity.Load() {
+		p.spawn()
+	}
+}
+
+// spawn starts a new worker, it must be called with mu held.
+func (p *Pool) spawn() {
+	p.running.Add(1)
+	p.wg.Add(1)
+	w := &worker{wake: make(chan bool, 1)}
+	go p.work(w)
+}
+
+// stopIdle asks the i-th idle worker to exit, it must be called with mu held.
+func (p *Pool) stopIdle(i int) {
+	w := p.idle[i]
+	p.idle = append(p.idle[:i], p.idle[i+1:]...)
+	p.running.Add(-1)
+	w.wake <- true
+}
+
+func (p *Pool) work(w *worker) {
+	defer p.wg.Done()
+	for {
+		if p.running.Load() > p.capacity.Load() && p.retire() {
+			return
+		}
+		if task := p.opts.queue.Dequeue(); task != nil {
+			p.waiting.Add(-1)
+			if p.blocked.Load() > 0 {
+				select {
+				case p.space <- struct{}{}:
+				default:
+				}
+			}
+			p.run(task)
+			continue
+		}
+
+		p.mu.Lock()
+		if !p.opts.queue.IsEmpty() {
+			p.mu.Unlock()
+			continue
+		}
+		if p.closed.Load() || p.running.Load() > p.capacity.Load() {
+			p.running.Add(-1)
+			p.mu.Unlock()
+			return
+		}
+		w.lastUsed = time.Now()
+		p.idle = append(p.idle, w)
+		p.mu.Unlock()
+
+		if exit := <-w.wake; exit {
+			return
+		}
+	}
+}
+
+// retire lets the worker exit if the pool has been tuned down below the number of running workers.
+func (p *Pool) retire() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.running.Load() > p.capacity.Load() {
+		p.running.Add(-1)
+		return true
+	}
+	return false
+}
+
+func (p *Pool) run(task *queue.Task) {
+	defer queue.PutTask(task)
+	defer rec.RecoverWith(p.opts.panicHandler)
+
+	_ = task.Exec(task.Param)
+}
+
+// purge periodically stops the workers that have been idle for longer than the expiry.
+func (p *Pool) purge() {
+	ticker := time.NewTicker(p.opts.expiry)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-p.closing:
+			return
+		}
+
+		expiredAt := time.Now().Add(-p.opts.expiry)
+		p.mu.Lock()
+		// idle is ordered by lastUsed, the least recently used workers come first.
+		for len(p.idle) > 0 && p.idle[0].lastUsed.Before(expiredAt) {
+			p.stopIdle(0)
+		}
+		p.mu.Unlock()
+	}
+}
+
+func runFunc(param any) error {
+	param.(func())()
+	return nil
+}
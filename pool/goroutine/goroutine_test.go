@@ -0,0 +1,188 @@
+package goroutine_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go-pkg/pool/goroutine"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPool_Submit(t *testing.T) {
+	const taskNum = 10000
+	p, err := goroutine.New(8)
+	require.NoError(t, err)
+
+	var (
+		counter int32
+		maxRun  int32
+		wg      sync.WaitGroup
+	)
+	wg.Add(taskNum)
+	for i := 0; i < taskNum; i++ {
+		require.NoError(t, p.Submit(func() {
+			defer wg.Done()
+			atomic.AddInt32(&counter, 1)
+			if n := int32(p.Running()); n > atomic.LoadInt32(&maxRun) {
+				atomic.StoreInt32(&maxRun, n)
+			}
+		}))
+	}
+	wg.Wait()
+	require.EqualValues(t, taskNum, atomic.LoadInt32(&counter))
+	require.LessOrEqual(t, atomic.LoadInt32(&maxRun), int32(8))
+	require.EqualValues(t, 8, p.Capacity())
+
+	require.NoError(t, p.Release(context.Background()))
+	require.Zero(t, p.Running())
+	require.ErrorIs(t, p.Submit(func() {}), goroutine.ErrPoolClosed)
+}
+
+func TestPool_ReleaseDrainsBacklog(t *testing.T) {
+	p, err := goroutine.New(1, goroutine.WithFixedWorkers())
+	require.NoError(t, err)
+	require.EqualValues(t, 1, p.Running())
+
+	var counter int32
+	block := make(chan struct{})
+	require.NoError(t, p.Submit(func() { <-block }))
+	for i := 0; i < 100; i++ {
+		require.NoError(t, p.Submit(func() { atomic.AddInt32(&counter, 1) }))
+	}
+	require.Eventually(t, func() bool { return p.Waiting() == 100 }, time.Second, time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, p.Release(ctx), context.DeadlineExceeded)
+
+	close(block)
+	require.NoError(t, p.Release(context.Background()))
+	require.EqualValues(t, 100, atomic.LoadInt32(&counter))
+	require.Zero(t, p.Waiting())
+}
+
+func TestPool_SubmitDuringRelease(t *testing.T) {
+	for i := 0; i < 500; i++ {
+		p, err := goroutine.New(4, goroutine.WithMaxWaiting(64))
+		require.NoError(t, err)
+
+		var accepted, ran atomic.Int32
+		var wg sync.WaitGroup
+		for j := 0; j < 8; j++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for p.Submit(func() { ran.Add(1) }) == nil {
+					accepted.Add(1)
+				}
+			}()
+		}
+		time.Sleep(100 * time.Microsecond)
+		require.NoError(t, p.Release(context.Background()))
+		wg.Wait()
+		// Every task accepted before Release ran before it returned.
+		require.Equal(t, accepted.Load(), ran.Load())
+	}
+}
+
+func TestPool_Backpressure(t *testing.T) {
+	block := make(chan struct{})
+	p, err := goroutine.New(1, goroutine.WithMaxWaiting(2), goroutine.WithNonBlocking())
+	require.NoError(t, err)
+	require.NoError(t, p.Submit(func() { <-block }))
+	require.Eventually(t, func() bool { return p.Waiting() == 0 }, time.Second, time.Millisecond)
+	require.NoError(t, p.Submit(func() {}))
+	require.NoError(t, p.Submit(func() {}))
+	require.ErrorIs(t, p.Submit(func() {}), goroutine.ErrPoolOverload)
+	close(block)
+	require.NoError(t, p.Release(context.Background()))
+
+	block = make(chan struct{})
+	p, err = goroutine.New(1, goroutine.WithMaxWaiting(1))
+	require.NoError(t, err)
+	require.NoError(t, p.Submit(func() { <-block }))
+	require.Eventually(t, func() bool { return p.Waiting() == 0 }, time.Second, time.Millisecond)
+	require.NoError(t, p.Submit(func() {}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, p.SubmitCtx(ctx, func() {}), context.DeadlineExceeded)
+
+	submitted := make(chan error, 1)
+	go func() { submitted <- p.Submit(func() {}) }()
+	close(block)
+	require.NoError(t, <-submitted)
+	require.NoError(t, p.Release(context.Background()))
+}
+
+func TestPool_BackpressureConcurrent(t *testing.T) {
+	block := make(chan struct{})
+	p, err := goroutine.New(1, goroutine.WithMaxWaiting(4), goroutine.WithNonBlocking())
+	require.NoError(t, err)
+	require.NoError(t, p.Submit(func() { <-block }))
+	require.Eventually(t, func() bool { return p.Waiting() == 0 }, time.Second, time.Millisecond)
+
+	// Concurrent submitters never overshoot the backlog.
+	var accepted atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 32; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if p.Submit(func() {}) == nil {
+				accepted.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	require.EqualValues(t, 4, accepted.Load())
+	require.Equal(t, 4, p.Waiting())
+	close(block)
+	require.NoError(t, p.Release(context.Background()))
+}
+
+func TestPool_PanicHandler(t *testing.T) {
+	panics := make(chan error, 2)
+	p, err := goroutine.New(1, goroutine.WithPanicHandler(func(err error) { panics <- err }))
+	require.NoError(t, err)
+
+	require.NoError(t, p.Submit(func() { panic("boom") }))
+	require.NoError(t, p.Submit(func() { panic(errors.New("bang")) }))
+	require.ErrorContains(t, <-panics, "boom")
+	require.ErrorContains(t, <-panics, "bang")
+
+	done := make(chan struct{})
+	require.NoError(t, p.Submit(func() { close(done) }))
+	<-done
+	require.NoError(t, p.Release(context.Background()))
+}
+
+func TestPool_ExpiryAndTune(t *testing.T) {
+	p, err := goroutine.New(4, goroutine.WithExpiry(20*time.Millisecond))
+	require.NoError(t, err)
+	require.Zero(t, p.Running())
+
+	var wg sync.WaitGroup
+	block := make(chan struct{})
+	wg.Add(4)
+	for i := 0; i < 4; i++ {
+		require.NoError(t, p.Submit(func() { defer wg.Done(); <-block }))
+	}
+	require.Eventually(t, func() bool { return p.Running() == 4 }, time.Second, time.Millisecond)
+
+	p.Tune(2)
+	require.EqualValues(t, 2, p.Capacity())
+	close(block)
+	wg.Wait()
+	require.Eventually(t, func() bool { return p.Running() <= 2 }, time.Second, time.Millisecond)
+	require.Eventually(t, func() bool { return p.Running() == 0 }, time.Second, 5*time.Millisecond)
+
+	p.Tune(0)
+	require.EqualValues(t, 2, p.Capacity())
+	require.NoError(t, p.Release(context.Background()))
+}
@@ -0,0 +1,66 @@
+package goroutine
+
+import (
+	"time"
+
+	"go-pkg/pool/queue"
+)
+
+// DefaultExpiry is how long an idle worker of an elastic pool lives before it exits.
+const DefaultExpiry = 10 * time.Second
+
+type options struct {
+	fixed        bool
+	expiry       time.Duration
+	nonBlocking  bool
+	maxWaiting   int
+	panicHandler func(err error)
+	queue        queue.AsyncTaskQueue
+}
+
+// Option configures a Pool.
+type Option func(opts *options)
+
+// WithFixedWorkers starts all workers up-front and keeps them alive until the pool is released,
+// instead of spawning them on demand and expiring the idle ones.
+func WithFixedWorkers() Option {
+	return func(opts *options) {
+		opts.fixed = true
+	}
+}
+
+// WithExpiry sets how long an idle worker of an elastic pool lives before it exits.
+func WithExpiry(expiry time.Duration) Option {
+	return func(opts *options) {
+		opts.expiry = expiry
+	}
+}
+
+// WithNonBlocking makes Submit return ErrPoolOverload instead of blocking when the backlog is full.
+func WithNonBlocking() Option {
+	return func(opts *options) {
+		opts.nonBlocking = true
+	}
+}
+
+// WithMaxWaiting limits the number of tasks waiting in the backlog for a free worker,
+// a value <= 0 means unlimited.
+func WithMaxWaiting(maxWaiting int) Option {
+	return func(opts *options) {
+		opts.maxWaiting = maxWaiting
+	}
+}
+
+// WithPanicHandler sets the handler receiving the panics recovered from tasks.
+func WithPanicHandler(handler func(err error)) Option {
+	return func(opts *options) {
+		opts.panicHandler = handler
+	}
+}
+
+// WithQueue sets the queue used as backlog, it defaults to queue.NewLockFreeQueue().
+func WithQueue(q queue.AsyncTaskQueue) Option {
+	return func(opts *options) {
+		opts.queue = q
+	}
+}
@@ -0,0 +1,99 @@
+// Package object implements a generic typed object pool on top of sync.Pool.
+package object
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Config configures a Pool.
+type Config[T any] struct {
+	// New allocates a new object when the pool is empty, it is required.
+	New func() T
+	// Reset clears an object before it is put back into the pool.
+	Reset func(T)
+	// Size measures an object, objects larger than MaxSize are dropped instead of being pooled.
+	Size func(T) int
+	// MaxSize is the largest size of the objects kept in the pool, 0 means unlimited.
+	MaxSize int
+	// OnLeak is called with the Get call stack of an object that is garbage collected without
+	// having been put back, it is only used when built with the pooldebug tag.
+	// It defaults to printing the stack to os.Stderr.
+	OnLeak func(stack string)
+}
+
+// Stats holds the counters of a Pool.
+type Stats struct {
+	Gets     uint64 // objects got from the pool
+	Puts     uint64 // objects put back into the pool
+	Misses   uint64 // objects allocated by New because the pool was empty
+	Discards uint64 // objects dropped because they are larger than MaxSize
+}
+
+// Pool is a typed wrapper of sync.Pool.
+// T should be a pointer type, otherwise every Put allocates to box the value.
+type Pool[T any] struct {
+	cfg  Config[T]
+	pool sync.Pool
+
+	gets     atomic.Uint64
+	puts     atomic.Uint64
+	misses   atomic.Uint64
+	discards atomic.Uint64
+
+	tracker tracker
+}
+
+// New returns a Pool configured with cfg, it panics if cfg.New is nil.
+func New[T any](cfg Config[T]) *Pool[T] {
+	if cfg.New == nil {
+		panic("object: Config.New is required")
+	}
+	p := &Pool[T]{cfg: cfg}
+	p.tracker.init(cfg.OnLeak)
+	return p
+}
+
+// Get returns an object from the pool or allocates a new one.
+func (p *Pool[T]) Get() T {
+	p.gets.Add(1)
+	v, ok := p.pool.Get().(T)
+	if !ok {
+		p.misses.Add(1)
+		v = p.cfg.New()
+	}
+	p.tracker.get(v)
+	return v
+}
+
+// Put resets the object and puts it back into the pool, or drops it if it is larger than MaxSize.
+//
+// The object mustn't be accessed after returning to the pool.
+func (p *Pool[T]) Put(v T) {
+	p.tracker.put(v)
+	if p.cfg.MaxSize > 0 && p.cfg.Size != nil && p.cfg.Size(v) > p.cfg.MaxSize {
+		p.discards.Add(1)
+		return
+	}
+	if p.cfg.Reset != nil {
+		p.cfg.Reset(v)
+	}
+	p.puts.Add(1)
+	p.pool.Put(v)
+}
+
+// Stats returns a snapshot of the counters.
+func (p *Pool[T]) Stats() Stats {
+	return Stats{
+		Gets:     p.gets.Load(),
+		Puts:     p.puts.Load(),
+		Misses:   p.misses.Load(),
+		Discards: p.discards.Load(),
+	}
+}
+
+// Leaks returns the Get call stacks of the objects that have been got but not put back yet,
+// it always returns nil unless built with the pooldebug tag.
+func (p *Pool[T]) Leaks() []string {
+	return p.tracker.leaks()
+}
@@ -0,0 +1,50 @@
+//go:build pooldebug
+
+package object_test
+
+import (
+	"runtime"
+	"testing"
+	"time"
+
+	"go-pkg/pool/object"
+
+	"github.com/stretchr/testify/require"
+)
+
+type item struct {
+	buf [64]byte
+}
+
+func TestPool_Leaks(t *testing.T) {
+	leaks := make(chan string, 1)
+	p := object.New(object.Config[*item]{
+		New:    func() *item { return new(item) },
+		OnLeak: func(stack string) { leaks <- stack },
+	})
+
+	v := p.Get()
+	require.Len(t, p.Leaks(), 1)
+	require.Contains(t, p.Leaks()[0], "TestPool_Leaks")
+	p.Put(v)
+	require.Empty(t, p.Leaks())
+
+	getAndDrop(p)
+	require.Len(t, p.Leaks(), 1)
+	require.Eventually(t, func() bool {
+		runtime.GC()
+		select {
+		case stack := <-leaks:
+			require.Contains(t, stack, "getAndDrop")
+			return true
+		default:
+			return false
+		}
+	}, time.Second, 10*time.Millisecond)
+	require.Empty(t, p.Leaks())
+}
+
+//go:noinline
+func getAndDrop(p *object.Pool[*item]) {
+	_ = p.Get()
+}
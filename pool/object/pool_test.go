@@ -0,0 +1,40 @@
+package object_test
+
+import (
+	"bytes"
+	"testing"
+
+	"go-pkg/pool/object"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPool(t *testing.T) {
+	p := object.New(object.Config[*bytes.Buffer]{
+		New:     func() *bytes.Buffer { return new(bytes.Buffer) },
+		Reset:   (*bytes.Buffer).Reset,
+		Size:    (*bytes.Buffer).Cap,
+		MaxSize: 1024,
+	})
+
+	b := p.Get()
+	require.NotNil(t, b)
+	b.WriteString("hello")
+	p.Put(b)
+
+	b = p.Get()
+	require.Zero(t, b.Len())
+	b.Write(make([]byte, 2048))
+	p.Put(b)
+
+	stats := p.Stats()
+	require.EqualValues(t, 2, stats.Gets)
+	require.EqualValues(t, 1, stats.Puts)
+	require.EqualValues(t, 1, stats.Discards)
+	require.GreaterOrEqual(t, stats.Misses, uint64(1))
+	require.LessOrEqual(t, stats.Misses, stats.Gets)
+}
+
+func TestPool_RequiresNew(t *testing.T) {
+	require.Panics(t, func() { object.New(object.Config[*bytes.Buffer]{}) })
+}
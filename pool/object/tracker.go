@@ -0,0 +1,14 @@
+//go:build !pooldebug
+
+package object
+
+// tracker is a no-op unless built with the pooldebug tag.
+type tracker struct{}
+
+func (*tracker) init(func(stack string)) {}
+
+func (*tracker) get(any) {}
+
+func (*tracker) put(any) {}
+
+func (*tracker) leaks() []string { return nil }
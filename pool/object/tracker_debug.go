@@ -0,0 +1,97 @@
+//go:build pooldebug
+
+package object
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"runtime"
+	"runtime/debug"
+	"sync"
+)
+
+// tracker records the Get call stack of every object handed out by the pool,
+// and reports the objects garbage collected without having been put back.
+// Only pointer objects are tracked, a finalizer is set on them while they are out of the pool.
+type tracker struct {
+	mu      sync.Mutex
+	seq     uint64
+	objects map[uintptr]trackedObject
+	onLeak  func(stack string)
+}
+
+type trackedObject struct {
+	id    uint64
+	stack string
+}
+
+func (t *tracker) init(onLeak func(stack string)) {
+	if onLeak == nil {
+		onLeak = func(stack string) {
+			_, _ = fmt.Fprintf(os.Stderr, "object: pooled object leaked, got at:\n%s\n", stack)
+		}
+	}
+	t.objects = make(map[uintptr]trackedObject)
+	t.onLeak = onLeak
+}
+
+func (t *tracker) get(v any) {
+	ptr, ok := pointerOf(v)
+	if !ok {
+		return
+	}
+
+	stack := string(debug.Stack())
+	t.mu.Lock()
+	t.seq++
+	id := t.seq
+	t.objects[ptr] = trackedObject{id: id, stack: stack}
+	t.mu.Unlock()
+
+	runtime.SetFinalizer(v, func(any) { t.leaked(ptr, id) })
+}
+
+func (t *tracker) put(v any) {
+	ptr, ok := pointerOf(v)
+	if !ok {
+		return
+	}
+
+	t.mu.Lock()
+	delete(t.objects, ptr)
+	t.mu.Unlock()
+
+	runtime.SetFinalizer(v, nil)
+}
+
+func (t *tracker) leaked(ptr uintptr, id uint64) {
+	t.mu.Lock()
+	obj, ok := t.objects[ptr]
+	if ok && obj.id == id {
+		delete(t.objects, ptr)
+	}
+	t.mu.Unlock()
+
+	if ok && obj.id == id {
+		t.onLeak(obj.stack)
+	}
+}
+
+func (t *tracker) leaks() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	stacks := make([]string, 0, len(t.objects))
+	for _, obj := range t.objects {
+		stacks = append(stacks, obj.stack)
+	}
+	return stacks
+}
+
+func pointerOf(v any) (uintptr, bool) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return 0, false
+	}
+	return rv.Pointer(), true
+}
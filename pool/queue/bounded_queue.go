@@ -0,0 +1,141 @@
+package queue
+
+import (
+	"runtime"
+	"sync/atomic"
+
+	"go-pkg/math"
+)
+
+// cacheLinePadSize keeps the hot fields on separate cache lines to avoid false sharing.
+const cacheLinePadSize = 64
+
+// BoundedTaskQueue is an AsyncTaskQueue with a fixed capacity.
+type BoundedTaskQueue interface {
+	AsyncTaskQueue
+	// TryEnqueue puts the given task at the tail of the queue, it returns false if the queue is full.
+	TryEnqueue(*Task) bool
+	// Cap returns the capacity of the queue.
+	Cap() int32
+}
+
+// boundedQueue is a bounded multi-producer/multi-consumer queue backed by a ring of cells,
+// based on Dmitry Vyukov's algorithm.
+// Each cell carries a sequence number telling whether it is ready to be written or read
+// at a given position, so producers and consumers only contend on their own cursor and
+// no memory is allocated per operation.
+type boundedQueue struct {
+	_     [cacheLinePadSize]byte
+	head  atomic.Uint64 // next position to dequeue
+	_     [cacheLinePadSize - 8]byte
+	tail  atomic.Uint64 // next position to enqueue
+	_     [cacheLinePadSize - 8]byte
+	mask  uint64
+	cells []cell
+}
+
+type cell struct {
+	seq  atomic.Uint64
+	task *Task
+	_    [cacheLinePadSize - 16]byte
+}
+
+// NewBoundedQueue instantiates and returns a boundedQueue whose capacity is the given capacity
+// rounded up to a power of two.
+func NewBoundedQueue(capacity int) BoundedTaskQueue {
+	capacity = math.CeilToPowerOfTwo(capacity)
+	q := &boundedQueue{
+		mask:  uint64(capacity - 1),
+		cells: make([]cell, capacity),
+	}
+	for i := range q.cells {
+		q.cells[i].seq.Store(uint64(i))
+	}
+	return q
+}
+
+// Enqueue puts the given task at the tail of the queue, it yields the processor
+// until there is room if the queue is full.
+func (q *boundedQueue) Enqueue(task *Task) {
+	for !q.TryEnqueue(task) {
+		runtime.Gosched()
+	}
+}
+
+// TryEnqueue puts the given task at the tail of the queue, it returns false if the queue is full.
+func (q *boundedQueue) TryEnqueue(task *Task) bool {
+	pos := q.tail.Load()
+	for {
+		c := &q.cells[pos&q.mask]
+		seq := c.seq.Load()
+		switch dif := int64(seq - pos); {
+		case dif == 0:
+			if q.tail.CompareAndSwap(pos, pos+1) {
+				c.task = task
+				c.seq.Store(pos + 1)
+				return true
+			}
+			pos = q.tail.Load()
+		case dif < 0: // the cell still holds the task of the previous lap.
+			return false
+		default: // another producer took this position.
+			pos = q.tail.Load()
+		}
+	}
+}
+
+// Dequeue removes and returns the value at the head of the queue.
+// It returns nil if the queue is empty.
+func (q *boundedQueue) Dequeue() *Task {
+	pos := q.head.Load()
+	for {
+		c := &q.cells[pos&q.mask]
+		seq := c.seq.Load()
+		switch dif := int64(seq - (pos + 1)); {
+		case dif == 0:
+			if q.head.CompareAndSwap(pos, pos+1) {
+				task := c.task
+				c.task = nil
+				c.seq.Store(pos + q.mask + 1)
+				return task
+			}
+			pos = q.head.Load()
+		case dif < 0: // the cell hasn't been written in this lap.
+			return nil
+		default: // another consumer took this position.
+			pos = q.head.Load()
+		}
+	}
+}
+
+// IsEmpty indicates whether this queue is empty or not, it is true while the task at the head is still
+// being published by its producer, i.e. whenever Dequeue would return nil.
+func (q *boundedQueue) IsEmpty() bool {
+	pos := q.head.Load()
+	for {
+		switch dif := int64(q.cells[pos&q.mask].seq.Load() - (pos + 1)); {
+		case dif == 0:
+			return false
+		case dif < 0:
+			return true
+		}
+		// Another consumer took this position.
+		pos = q.head.Load()
+	}
+}
+
+// Length returns the number of elements in the queue. It counts the positions taken by producers which
+// are still publishing their tasks, so it may exceed the number of tasks Dequeue can return right now.
+func (q *boundedQueue) Length() int32 {
+	head := q.head.Load()
+	tail := q.tail.Load()
+	if tail <= head {
+		return 0
+	}
+	return int32(tail - head)
+}
+
+// Cap returns the capacity of the queue.
+func (q *boundedQueue) Cap() int32 {
+	return int32(len(q.cells))
+}
@@ -0,0 +1,95 @@
+package queue_test
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"go-pkg/pool/queue"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBoundedQueue(t *testing.T) {
+	q := queue.NewBoundedQueue(3)
+	require.EqualValues(t, 4, q.Cap())
+	require.True(t, q.IsEmpty())
+	require.Nil(t, q.Dequeue())
+
+	tasks := make([]*queue.Task, 5)
+	for i := range tasks {
+		tasks[i] = &queue.Task{Param: i}
+	}
+	for i := 0; i < 4; i++ {
+		require.True(t, q.TryEnqueue(tasks[i]))
+	}
+	require.False(t, q.TryEnqueue(tasks[4]))
+	require.EqualValues(t, 4, q.Length())
+
+	require.Same(t, tasks[0], q.Dequeue())
+	require.True(t, q.TryEnqueue(tasks[4]))
+	for i := 1; i < 5; i++ {
+		require.Same(t, tasks[i], q.Dequeue())
+	}
+	require.Nil(t, q.Dequeue())
+	require.True(t, q.IsEmpty())
+}
+
+func TestBoundedQueue_MPMC(t *testing.T) {
+	const (
+		producers = 4
+		taskNum   = 10000
+	)
+	q := queue.NewBoundedQueue(64)
+	var (
+		wg      sync.WaitGroup
+		counter int32
+		sum     int64
+	)
+	wg.Add(2 * producers)
+	for i := 0; i < producers; i++ {
+		go func() {
+			defer wg.Done()
+			for j := 0; j < taskNum; j++ {
+				q.Enqueue(&queue.Task{Param: j})
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for atomic.LoadInt32(&counter) < producers*taskNum {
+				task := q.Dequeue()
+				if task == nil {
+					runtime.Gosched()
+					continue
+				}
+				atomic.AddInt32(&counter, 1)
+				atomic.AddInt64(&sum, int64(task.Param.(int)))
+			}
+		}()
+	}
+	wg.Wait()
+	require.EqualValues(t, producers*taskNum, counter)
+	require.EqualValues(t, producers*taskNum*(taskNum-1)/2, sum)
+	require.True(t, q.IsEmpty())
+}
+
+func benchmarkQueue(b *testing.B, q queue.AsyncTaskQueue) {
+	task := &queue.Task{}
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			q.Enqueue(task)
+			for q.Dequeue() == nil {
+			}
+		}
+	})
+}
+
+func BenchmarkLockFreeQueue(b *testing.B) {
+	benchmarkQueue(b, queue.NewLockFreeQueue())
+}
+
+func BenchmarkBoundedQueue(b *testing.B) {
+	benchmarkQueue(b, queue.NewBoundedQueue(1024))
+}
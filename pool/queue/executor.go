@@ -0,0 +1,215 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+
+	"go-pkg/rec"
+)
+
+// DefaultFairness is the number of consecutive high-priority tasks after which
+// a pending low-priority task gets its turn.
+const DefaultFairness = 16
+
+// ErrExecutorClosed will be returned when submitting a task to a stopped executor.
+var ErrExecutorClosed = errors.New("executor is closed")
+
+// Executor runs asynchronous tasks on a fixed number of goroutines, it owns one lock-free queue
+// per priority and always drains HighPriority first.
+// To keep low-priority tasks from starving, a pending LowPriority task runs after every
+// fairness consecutive high-priority ones.
+type Executor struct {
+	queues     [LowPriority + 1]AsyncTaskQueue
+	workers    int
+	fairness   int
+	errHandler func(err error)
+
+	sleeping atomic.Int32
+	wake     chan struct{}
+	// closeMu is read-locked by submitters around the closed check and the enqueue, so that Stop
+	// can't return before a task it let in has run.
+	closeMu sync.RWMutex
+	closed  atomic.Bool
+	closing chan struct{}
+	wg      sync.WaitGroup
+}
+
+// ExecutorOption configures an Executor.
+type ExecutorOption func(e *Executor)
+
+// WithWorkers sets the number of goroutines running tasks, it defaults to 1 which
+// keeps the tasks of the same priority in order.
+func WithWorkers(workers int) ExecutorOption {
+	return func(e *Executor) {
+		if workers > 0 {
+			e.workers = workers
+		}
+	}
+}
+
+// WithFairness sets the number of consecutive high-priority tasks after which a pending
+// low-priority task runs, a value <= 0 drains HighPriority strictly first.
+func WithFairness(fairness int) ExecutorOption {
+	return func(e *Executor) {
+		e.fairness = fairness
+	}
+}
+
+// WithErrorHandler sets the handler receiving the errors returned by task functions
+// and the panics recovered from them.
+func WithErrorHandler(handler func(err error)) ExecutorOption {
+	return func(e *Executor) {
+		e.errHandler = handler
+	}
+}
+
+// NewExecutor instantiates an Executor and starts its goroutines.
+func NewExecutor(opts ...ExecutorOption) *Executor {
+	e := &Executor{
+		workers:  1,
+		fairness: DefaultFairness,
+		closing:  make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	e.queues[HighPriority] = NewLockFreeQueue()
+	e.queues[LowPriority] = NewLockFreeQueue()
+	e.wake = make(chan struct{}, e.workers)
+
+	e.wg.Add(e.workers)
+	for i := 0; i < e.workers; i++ {
+		go e.run()
+	}
+	return e
+}
+
+// Submit wraps fn and param in a pooled Task and enqueues it with the given priority.
+func (e *Executor) Submit(fn Func, param any, priority EventPriority) error {
+	e.closeMu.RLock()
+	defer e.closeMu.RUnlock()
+	if e.closed.Load() {
+		return ErrExecutorClosed
+	}
+	task := GetTask()
+	task.Exec, task.Param = fn, param
+	e.enqueue(task, priority)
+	return nil
+}
+
+// Enqueue puts the given task into the queue of the given priority, the task is returned to the pool
+// via PutTask once it has run.
+func (e *Executor) Enqueue(task *Task, priority EventPriority) error {
+	e.closeMu.RLock()
+	defer e.closeMu.RUnlock()
+	if e.closed.Load() {
+		return ErrExecutorClosed
+	}
+	e.enqueue(task, priority)
+	return nil
+}
+
+// Length returns the number of tasks waiting in the queue of the given priority.
+func (e *Executor) Length(priority EventPriority) int32 {
+	return e.queue(priority).Length()
+}
+
+// Stop stops accepting tasks and waits until the queued ones have run,
+// it returns ctx.Err() if ctx is done first.
+func (e *Executor) Stop(ctx context.Context) error {
+	e.closeMu.Lock()
+	if e.closed.CompareAndSwap(false, true) {
+		close(e.closing)
+	}
+	e.closeMu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		e.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (e *Executor) queue(priority EventPriority) AsyncTaskQueue {
+	if priority == HighPriority {
+		return e.queues[HighPriority]
+	}
+	return e.queues[LowPriority]
+}
+
+func (e *Executor) enqueue(task *Task, priority EventPriority) {
+	e.queue(priority).Enqueue(task)
+	if e.sleeping.Load() > 0 {
+		select {
+		case e.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (e *Executor) isEmpty() bool {
+	return e.queues[HighPriority].IsEmpty() && e.queues[LowPriority].IsEmpty()
+}
+
+// next returns the next task to run, highRun counts the consecutive high-priority tasks run so far.
+func (e *Executor) next(highRun *int) *Task {
+	if e.fairness <= 0 || *highRun < e.fairness {
+		if task := e.queues[HighPriority].Dequeue(); task != nil {
+			*highRun++
+			return task
+		}
+	}
+	*highRun = 0
+	if task := e.queues[LowPriority].Dequeue(); task != nil {
+		return task
+	}
+	if task := e.queues[HighPriority].Dequeue(); task != nil {
+		*highRun++
+		return task
+	}
+	return nil
+}
+
+func (e *Executor) run() {
+	defer e.wg.Done()
+	var highRun int
+	for {
+		if task := e.next(&highRun); task != nil {
+			e.exec(task)
+			continue
+		}
+
+		// Publish sleeping before checking the queues again, so an enqueue can't be missed.
+		e.sleeping.Add(1)
+		if !e.isEmpty() {
+			e.sleeping.Add(-1)
+			continue
+		}
+		select {
+		case <-e.wake:
+		case <-e.closing:
+			if e.isEmpty() {
+				e.sleeping.Add(-1)
+				return
+			}
+		}
+		e.sleeping.Add(-1)
+	}
+}
+
+func (e *Executor) exec(task *Task) {
+	defer PutTask(task)
+	defer rec.RecoverWith(e.errHandler)
+
+	if err := task.Exec(task.Param); err != nil && e.errHandler != nil {
+		e.errHandler(err)
+	}
+}
@@ -0,0 +1,133 @@
+package queue_test
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"go-pkg/pool/queue"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecutor_Fairness(t *testing.T) {
+	e := queue.NewExecutor(queue.WithFairness(3))
+
+	var (
+		mu    sync.Mutex
+		order strings.Builder
+	)
+	record := func(p any) error {
+		mu.Lock()
+		order.WriteString(p.(string))
+		mu.Unlock()
+		return nil
+	}
+
+	block := make(chan struct{})
+	require.NoError(t, e.Submit(func(any) error { <-block; return nil }, nil, queue.HighPriority))
+	for i := 0; i < 3; i++ {
+		require.NoError(t, e.Submit(record, "L", queue.LowPriority))
+	}
+	for i := 0; i < 7; i++ {
+		require.NoError(t, e.Submit(record, "H", queue.HighPriority))
+	}
+	require.EqualValues(t, 3, e.Length(queue.LowPriority))
+	close(block)
+	require.NoError(t, e.Stop(context.Background()))
+	// The blocking task counts as the first high-priority one.
+	require.EqualValues(t, "HHLHHHLHHL", order.String())
+
+	require.ErrorIs(t, e.Submit(record, "H", queue.HighPriority), queue.ErrExecutorClosed)
+}
+
+func TestExecutor_StrictPriority(t *testing.T) {
+	e := queue.NewExecutor(queue.WithFairness(0))
+	var order []string
+	block := make(chan struct{})
+	require.NoError(t, e.Submit(func(any) error { <-block; return nil }, nil, queue.LowPriority))
+	for _, p := range []queue.EventPriority{queue.LowPriority, queue.HighPriority, queue.LowPriority, queue.HighPriority} {
+		name := "H"
+		if p == queue.LowPriority {
+			name = "L"
+		}
+		require.NoError(t, e.Submit(func(any) error { order = append(order, name); return nil }, nil, p))
+	}
+	close(block)
+	require.NoError(t, e.Stop(context.Background()))
+	require.EqualValues(t, []string{"H", "H", "L", "L"}, order)
+}
+
+func TestExecutor_ErrorHandler(t *testing.T) {
+	const taskNum = 1000
+	var (
+		mu   sync.Mutex
+		errs []error
+	)
+	e := queue.NewExecutor(queue.WithWorkers(4), queue.WithErrorHandler(func(err error) {
+		mu.Lock()
+		errs = append(errs, err)
+		mu.Unlock()
+	}))
+
+	errFailed := errors.New("failed")
+	for i := 0; i < taskNum; i++ {
+		task := queue.GetTask()
+		task.Param = i
+		task.Exec = func(p any) error {
+			switch p.(int) % 100 {
+			case 0:
+				return errFailed
+			case 1:
+				panic("boom")
+			}
+			return nil
+		}
+		require.NoError(t, e.Enqueue(task, queue.EventPriority(i%2)))
+	}
+	require.NoError(t, e.Stop(context.Background()))
+	require.Len(t, errs, 2*taskNum/100)
+	var failed, panicked int
+	for _, err := range errs {
+		if errors.Is(err, errFailed) {
+			failed++
+		} else if strings.Contains(err.Error(), "boom") {
+			panicked++
+		}
+	}
+	require.EqualValues(t, taskNum/100, failed)
+	require.EqualValues(t, taskNum/100, panicked)
+}
+
+func TestExecutor_SubmitDuringStop(t *testing.T) {
+	for i := 0; i < 500; i++ {
+		e := queue.NewExecutor(queue.WithWorkers(2))
+
+		var accepted, ran atomic.Int32
+		var wg sync.WaitGroup
+		start := make(chan struct{})
+		for j := 0; j < 4; j++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				<-start
+				for k := 0; k < 200 && e.Submit(func(any) error { ran.Add(1); return nil }, nil, queue.HighPriority) == nil; k++ {
+					accepted.Add(1)
+					runtime.Gosched()
+				}
+			}()
+		}
+		close(start)
+		for accepted.Load() == 0 {
+			runtime.Gosched()
+		}
+		require.NoError(t, e.Stop(context.Background()))
+		wg.Wait()
+		// Every task accepted before Stop ran before it returned.
+		require.Equal(t, accepted.Load(), ran.Load())
+	}
+}
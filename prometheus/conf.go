@@ -1,7 +1,7 @@
 package prometheus
 
 type PrometheusConf struct {
-	Host string `json:"host",optional"`
-	Path string `json:"path",default=/metrics"`
-	Port int    `json:"port",default=9101"`
+	Host string `json:"host,optional"`
+	Path string `json:"path,default=/metrics"`
+	Port int    `json:"port,default=9101"`
 }
@@ -0,0 +1,143 @@
+package prometheus
+
+import (
+	"time"
+
+	"go-pkg/transport/kcp"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+	kcpgo "github.com/xtaci/kcp-go/v5"
+)
+
+// kcpServerCollector exports the statistics of a kcp.Server, labeled with the server name.
+type kcpServerCollector struct {
+	server *kcp.Server
+
+	sessions       *prom.Desc
+	sessionsOpened *prom.Desc
+	sessionsClosed *prom.Desc
+	messages       *prom.Desc
+	bytes          *prom.Desc
+	srttAvg        *prom.Desc
+	srttMax        *prom.Desc
+}
+
+// NewKCPServerCollector returns a collector exporting the statistics of a kcp.Server,
+// every metric carries a server label set to name.
+func NewKCPServerCollector(name string, server *kcp.Server) prom.Collector {
+	labels := prom.Labels{"server": name}
+	return &kcpServerCollector{
+		server: server,
+		sessions: prom.NewDesc("kcp_server_sessions",
+			"Number of open sessions.", nil, labels),
+		sessionsOpened: prom.NewDesc("kcp_server_sessions_opened_total",
+			"Number of sessions opened.", nil, labels),
+		sessionsClosed: prom.NewDesc("kcp_server_sessions_closed_total",
+			"Number of sessions closed, by reason.", []string{"reason"}, labels),
+		messages: prom.NewDesc("kcp_server_messages_total",
+			"Number of messages received (in) and sent (out), by type, unknown types as \"other\".", []string{"direction", "type"}, labels),
+		bytes: prom.NewDesc("kcp_server_bytes_total",
+			"Bytes received (in) and sent (out) by the application, without the kcp overhead.", []string{"direction"}, labels),
+		srttAvg: prom.NewDesc("kcp_server_srtt_avg_seconds",
+			"Average smoothed round trip of the open sessions.", nil, labels),
+		srttMax: prom.NewDesc("kcp_server_srtt_max_seconds",
+			"Largest smoothed round trip of the open sessions.", nil, labels),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *kcpServerCollector) Describe(ch chan<- *prom.Desc) {
+	ch <- c.sessions
+	ch <- c.sessionsOpened
+	ch <- c.sessionsClosed
+	ch <- c.messages
+	ch <- c.bytes
+	ch <- c.srttAvg
+	ch <- c.srttMax
+}
+
+// Collect implements prometheus.Collector.
+func (c *kcpServerCollector) Collect(ch chan<- prom.Metric) {
+	s := c.server.Stats()
+	ch <- prom.MustNewConstMetric(c.sessions, prom.GaugeValue, float64(s.Sessions))
+	ch <- prom.MustNewConstMetric(c.sessionsOpened, prom.CounterValue, float64(s.SessionsOpened))
+	for reason, n := range s.SessionsClosed {
+		ch <- prom.MustNewConstMetric(c.sessionsClosed, prom.CounterValue, float64(n), reason.String())
+	}
+	for msgType, n := range s.MsgsReceived {
+		ch <- prom.MustNewConstMetric(c.messages, prom.CounterValue, float64(n), "in", kcp.MsgTypeName(msgType))
+	}
+	for msgType, n := range s.MsgsSent {
+		ch <- prom.MustNewConstMetric(c.messages, prom.CounterValue, float64(n), "out", kcp.MsgTypeName(msgType))
+	}
+	ch <- prom.MustNewConstMetric(c.bytes, prom.CounterValue, float64(s.BytesReceived), "in")
+	ch <- prom.MustNewConstMetric(c.bytes, prom.CounterValue, float64(s.BytesSent), "out")
+
+	var sum, maxSRTT time.Duration
+	for _, srtt := range s.SRTT {
+		sum += srtt
+		maxSRTT = max(maxSRTT, srtt)
+	}
+	var avg float64
+	if len(s.SRTT) > 0 {
+		avg = sum.Seconds() / float64(len(s.SRTT))
+	}
+	ch <- prom.MustNewConstMetric(c.srttAvg, prom.GaugeValue, avg)
+	ch <- prom.MustNewConstMetric(c.srttMax, prom.GaugeValue, maxSRTT.Seconds())
+}
+
+// RegisterKCPServer registers a collector exporting the statistics of the server.
+func RegisterKCPServer(name string, server *kcp.Server) error {
+	return prom.Register(NewKCPServerCollector(name, server))
+}
+
+// kcpSnmpCollector exports the counters kcp-go keeps for the whole process.
+type kcpSnmpCollector struct {
+	retransSegs  *prom.Desc
+	lostSegs     *prom.Desc
+	fecRecovered *prom.Desc
+	csumErrors   *prom.Desc
+	bytes        *prom.Desc
+}
+
+// NewKCPSnmpCollector returns a collector exporting the counters kcp-go keeps for the whole process,
+// such as the retransmissions, which it doesn't count per connection or server.
+func NewKCPSnmpCollector() prom.Collector {
+	return &kcpSnmpCollector{
+		retransSegs: prom.NewDesc("kcp_retransmitted_segments_total",
+			"Number of kcp segments retransmitted, including the fast and early retransmissions.", nil, nil),
+		lostSegs: prom.NewDesc("kcp_lost_segments_total",
+			"Number of kcp segments inferred as lost.", nil, nil),
+		fecRecovered: prom.NewDesc("kcp_fec_recovered_total",
+			"Number of packets recovered by the forward error correction.", nil, nil),
+		csumErrors: prom.NewDesc("kcp_checksum_errors_total",
+			"Number of packets dropped for a checksum error, e.g. sent with another key.", nil, nil),
+		bytes: prom.NewDesc("kcp_udp_bytes_total",
+			"UDP bytes received (in) and sent (out).", []string{"direction"}, nil),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *kcpSnmpCollector) Describe(ch chan<- *prom.Desc) {
+	ch <- c.retransSegs
+	ch <- c.lostSegs
+	ch <- c.fecRecovered
+	ch <- c.csumErrors
+	ch <- c.bytes
+}
+
+// Collect implements prometheus.Collector.
+func (c *kcpSnmpCollector) Collect(ch chan<- prom.Metric) {
+	s := kcpgo.DefaultSnmp.Copy()
+	ch <- prom.MustNewConstMetric(c.retransSegs, prom.CounterValue, float64(s.RetransSegs))
+	ch <- prom.MustNewConstMetric(c.lostSegs, prom.CounterValue, float64(s.LostSegs))
+	ch <- prom.MustNewConstMetric(c.fecRecovered, prom.CounterValue, float64(s.FECRecovered))
+	ch <- prom.MustNewConstMetric(c.csumErrors, prom.CounterValue, float64(s.InCsumErrors))
+	ch <- prom.MustNewConstMetric(c.bytes, prom.CounterValue, float64(s.InBytes), "in")
+	ch <- prom.MustNewConstMetric(c.bytes, prom.CounterValue, float64(s.OutBytes), "out")
+}
+
+// RegisterKCPSnmp registers a collector exporting the counters kcp-go keeps for the whole process.
+func RegisterKCPSnmp() error {
+	return prom.Register(NewKCPSnmpCollector())
+}
@@ -0,0 +1,56 @@
+package prometheus
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go-pkg/transport/kcp"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKCPServerCollector(t *testing.T) {
+	s := kcp.NewServer(nil)
+	require.NoError(t, s.Listen("127.0.0.1:0"))
+	go func() { _ = s.Serve(kcp.NewRouter()) }()
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		_ = s.Stop(ctx)
+	}()
+
+	conn, err := kcp.Dial(s.Addr().String(), nil)
+	require.NoError(t, err)
+	defer conn.Close()
+	require.NoError(t, conn.SendMsg(1000, nil))
+	_, err = conn.Ping(time.Second)
+	require.NoError(t, err)
+
+	reg := prom.NewPedanticRegistry()
+	require.NoError(t, reg.Register(NewKCPServerCollector("test", s)))
+	require.NoError(t, reg.Register(NewKCPSnmpCollector()))
+
+	mfs, err := reg.Gather()
+	require.NoError(t, err)
+	values := make(map[string]float64)
+	for _, mf := range mfs {
+		for _, m := range mf.GetMetric() {
+			key := mf.GetName()
+			for _, l := range m.GetLabel() {
+				if l.GetName() != "server" {
+					key += "," + l.GetValue()
+				}
+			}
+			values[key] = m.GetGauge().GetValue() + m.GetCounter().GetValue()
+		}
+	}
+	require.EqualValues(t, 1, values["kcp_server_sessions"])
+	require.EqualValues(t, 1, values["kcp_server_sessions_opened_total"])
+	require.EqualValues(t, 1, values["kcp_server_messages_total,in,ping"])
+	require.EqualValues(t, 1, values["kcp_server_messages_total,out,pong"])
+	require.EqualValues(t, 1, values["kcp_server_messages_total,in,other"])
+	require.Positive(t, values["kcp_server_bytes_total,in"])
+	require.Positive(t, values["kcp_udp_bytes_total,out"])
+}
@@ -0,0 +1,152 @@
+package prometheus
+
+import (
+	"math"
+	"sort"
+
+	"go-pkg/pool/byte_buffer"
+	"go-pkg/pool/ring_buffer"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+)
+
+// PoolStats is a snapshot of the calibration state of a size-calibrating pool.
+type PoolStats struct {
+	DefaultSize  uint64
+	MaxSize      uint64
+	Calibrations uint64
+	Discards     uint64
+	// Buckets maps the upper bound in bytes of every size bucket to its number of Put calls, not cumulative.
+	// A bucket without an upper bound, e.g. one also counting all larger sizes, goes under math.Inf(1).
+	Buckets  map[float64]uint64
+	CallsSum uint64
+}
+
+// poolCollector exports the calibration state of a pool, labeled with the pool name.
+type poolCollector struct {
+	stats func() PoolStats
+
+	defaultSize  *prom.Desc
+	maxSize      *prom.Desc
+	calibrations *prom.Desc
+	discards     *prom.Desc
+	putSize      *prom.Desc
+}
+
+// NewPoolCollector returns a collector exporting the stats of a size-calibrating pool,
+// every metric carries a pool label set to name.
+func NewPoolCollector(name string, stats func() PoolStats) prom.Collector {
+	labels := prom.Labels{"pool": name}
+	return &poolCollector{
+		stats: stats,
+		defaultSize: prom.NewDesc("pool_default_size_bytes",
+			"Calibrated size of the buffers allocated by the pool.", nil, labels),
+		maxSize: prom.NewDesc("pool_max_size_bytes",
+			"Calibrated size above which buffers are discarded by the pool.", nil, labels),
+		calibrations: prom.NewDesc("pool_calibrations_total",
+			"Number of size calibrations of the pool.", nil, labels),
+		discards: prom.NewDesc("pool_discards_total",
+			"Number of buffers discarded by the pool for exceeding the max size.", nil, labels),
+		putSize: prom.NewDesc("pool_put_size_bytes",
+			"Size of the buffers put back into the pool.", nil, labels),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *poolCollector) Describe(ch chan<- *prom.Desc) {
+	ch <- c.defaultSize
+	ch <- c.maxSize
+	ch <- c.calibrations
+	ch <- c.discards
+	ch <- c.putSize
+}
+
+// Collect implements prometheus.Collector.
+func (c *poolCollector) Collect(ch chan<- prom.Metric) {
+	s := c.stats()
+	ch <- prom.MustNewConstMetric(c.defaultSize, prom.GaugeValue, float64(s.DefaultSize))
+	ch <- prom.MustNewConstMetric(c.maxSize, prom.GaugeValue, float64(s.MaxSize))
+	ch <- prom.MustNewConstMetric(c.calibrations, prom.CounterValue, float64(s.Calibrations))
+	ch <- prom.MustNewConstMetric(c.discards, prom.CounterValue, float64(s.Discards))
+
+	bounds := make([]float64, 0, len(s.Buckets))
+	for bound := range s.Buckets {
+		bounds = append(bounds, bound)
+	}
+	sort.Float64s(bounds)
+	buckets := make(map[float64]uint64, len(bounds))
+	var count uint64
+	for _, bound := range bounds {
+		count += s.Buckets[bound]
+		// The +Inf bucket is implicit, it is only counted in the total.
+		if !math.IsInf(bound, 1) {
+			buckets[bound] = count
+		}
+	}
+	ch <- prom.MustNewConstHistogram(c.putSize, count, float64(s.CallsSum), buckets)
+}
+
+// RegisterByteBufferPool registers a collector exporting the stats of p, or of the built-in
+// byte_buffer pool if p is nil.
+func RegisterByteBufferPool(name string, p *byte_buffer.Pool) error {
+	stats := byte_buffer.Stats
+	if p != nil {
+		stats = p.Stats
+	}
+	return prom.Register(NewPoolCollector(name, func() PoolStats {
+		s := stats()
+		ps := PoolStats{
+			DefaultSize:  s.DefaultSize,
+			MaxSize:      s.MaxSize,
+			Calibrations: s.Calibrations,
+			Discards:     s.Discards,
+			Buckets:      make(map[float64]uint64, len(s.Calls)),
+			CallsSum:     s.CallsSum,
+		}
+		for i, calls := range s.Calls {
+			ps.Buckets[bucketBound(i, len(s.Calls), byte_buffer.BucketSize)] += calls
+		}
+		return ps
+	}))
+}
+
+// RegisterRingBufferPool registers a collector exporting the stats of p, or of the built-in
+// ring_buffer pool if p is nil.
+func RegisterRingBufferPool(name string, p *ring_buffer.Pool) error {
+	stats := ring_buffer.Stats
+	if p != nil {
+		stats = p.Stats
+	}
+	return prom.Register(NewPoolCollector(name, func() PoolStats {
+		s := stats()
+		ps := PoolStats{
+			DefaultSize:  s.DefaultSize,
+			MaxSize:      s.MaxSize,
+			Calibrations: s.Calibrations,
+			Discards:     s.Discards,
+			Buckets:      make(map[float64]uint64, len(s.Calls)),
+			CallsSum:     s.CallsSum,
+		}
+		for i, calls := range s.Calls {
+			ps.Buckets[bucketBound(i, len(s.Calls), ring_buffer.BucketSize)] += calls
+		}
+		return ps
+	}))
+}
+
+// bucketBound returns the upper bound of the i-th of n pool buckets, the last one also counts
+// all larger sizes so it has none.
+func bucketBound(i, n int, size func(int) uint64) float64 {
+	if i == n-1 {
+		return math.Inf(1)
+	}
+	return float64(size(i))
+}
+
+// RegisterBuiltinPools registers collectors for the built-in byte_buffer and ring_buffer pools.
+func RegisterBuiltinPools() error {
+	if err := RegisterByteBufferPool("byte_buffer", nil); err != nil {
+		return err
+	}
+	return RegisterRingBufferPool("ring_buffer", nil)
+}
@@ -0,0 +1,69 @@
+package prometheus
+
+import (
+	"math"
+	"testing"
+
+	"go-pkg/pool/byte_buffer"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPoolCollector(t *testing.T) {
+	var p byte_buffer.Pool
+	for i := 0; i < 3; i++ {
+		b := p.Get()
+		b.B = append(b.B, make([]byte, 100*i)...)
+		p.Put(b)
+	}
+
+	c := NewPoolCollector("test", func() PoolStats {
+		s := p.Stats()
+		ps := PoolStats{Buckets: map[float64]uint64{}, CallsSum: s.CallsSum, Discards: s.Discards}
+		for i, calls := range s.Calls {
+			ps.Buckets[bucketBound(i, len(s.Calls), byte_buffer.BucketSize)] += calls
+		}
+		return ps
+	})
+	reg := prom.NewPedanticRegistry()
+	require.NoError(t, reg.Register(c))
+
+	mfs, err := reg.Gather()
+	require.NoError(t, err)
+	require.Len(t, mfs, 5)
+	for _, mf := range mfs {
+		require.EqualValues(t, "test", mf.GetMetric()[0].GetLabel()[0].GetValue())
+		if mf.GetName() != "pool_put_size_bytes" {
+			continue
+		}
+		h := mf.GetMetric()[0].GetHistogram()
+		require.EqualValues(t, 3, h.GetSampleCount())
+		require.EqualValues(t, 300, h.GetSampleSum())
+		require.EqualValues(t, 1, h.GetBucket()[0].GetCumulativeCount())
+		require.EqualValues(t, 2, h.GetBucket()[1].GetCumulativeCount())
+		require.EqualValues(t, 3, h.GetBucket()[2].GetCumulativeCount())
+	}
+}
+
+func TestPoolCollector_Overflow(t *testing.T) {
+	c := NewPoolCollector("test", func() PoolStats {
+		return PoolStats{Buckets: map[float64]uint64{64: 1, 128: 2, math.Inf(1): 3}, CallsSum: 1000}
+	})
+	reg := prom.NewPedanticRegistry()
+	require.NoError(t, reg.Register(c))
+
+	mfs, err := reg.Gather()
+	require.NoError(t, err)
+	for _, mf := range mfs {
+		if mf.GetName() != "pool_put_size_bytes" {
+			continue
+		}
+		// Sizes beyond the last finite bound only show in the count.
+		h := mf.GetMetric()[0].GetHistogram()
+		require.EqualValues(t, 6, h.GetSampleCount())
+		require.Len(t, h.GetBucket(), 2)
+		require.EqualValues(t, 128, h.GetBucket()[1].GetUpperBound())
+		require.EqualValues(t, 3, h.GetBucket()[1].GetCumulativeCount())
+	}
+}
@@ -7,6 +7,24 @@ func Recover(cleanups ...func()) {
 		cleanup()
 	}
 	if p := recover(); p != nil {
-		errors.WithStack(p.(error))
+		toError(p)
 	}
 }
+
+// RecoverWith is like Recover but hands the recovered panic to handler as an error with stack trace.
+func RecoverWith(handler func(err error), cleanups ...func()) {
+	for _, cleanup := range cleanups {
+		cleanup()
+	}
+	if p := recover(); p != nil && handler != nil {
+		handler(toError(p))
+	}
+}
+
+// toError converts a recovered panic value to an error with stack trace.
+func toError(p any) error {
+	if err, ok := p.(error); ok {
+		return errors.WithStack(err)
+	}
+	return errors.Errorf("%v", p)
+}
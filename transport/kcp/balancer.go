@@ -0,0 +1,131 @@
+package kcp
+
+import (
+	"math/rand/v2"
+	"sync"
+
+	"go-pkg/hash"
+)
+
+// Balancer picks the connection of a Pool to use among the alive ones.
+type Balancer interface {
+	// Pick returns one of conns, which is never empty. The key is only used by key-aware balancers.
+	Pick(conns []*PoolConn, key string) *PoolConn
+}
+
+// BalancerFunc is an adapter to allow the use of ordinary functions as balancers.
+type BalancerFunc func(conns []*PoolConn, key string) *PoolConn
+
+// Pick implements Balancer.
+func (f BalancerFunc) Pick(conns []*PoolConn, key string) *PoolConn {
+	return f(conns, key)
+}
+
+// LeastLatency returns a Balancer picking the connection with the lowest latency measured by the
+// last health check.
+func LeastLatency() Balancer {
+	return BalancerFunc(func(conns []*PoolConn, _ string) *PoolConn {
+		var (
+			best    *PoolConn
+			latency int64
+		)
+		for _, pc := range conns {
+			if l := int64(pc.latency()); best == nil || l < latency {
+				best, latency = pc, l
+			}
+		}
+		return best
+	})
+}
+
+// RoundRobin returns a Balancer picking the connections in turn in proportion to their weight,
+// spreading the picks of a connection evenly instead of in bursts.
+func RoundRobin() Balancer {
+	return &roundRobin{current: make(map[*PoolConn]int)}
+}
+
+// roundRobin is the smooth weighted round-robin of nginx.
+type roundRobin struct {
+	mu      sync.Mutex
+	current map[*PoolConn]int
+}
+
+func (b *roundRobin) Pick(conns []*PoolConn, _ string) *PoolConn {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	current := make(map[*PoolConn]int, len(conns))
+	var (
+		best  *PoolConn
+		total int
+	)
+	for _, pc := range conns {
+		w := pc.Weight()
+		current[pc] = b.current[pc] + w
+		total += w
+		if best == nil || current[pc] > current[best] {
+			best = pc
+		}
+	}
+	current[best] -= total
+	b.current = current
+	return best
+}
+
+// P2C returns a Balancer picking the connection with the lowest EWMA latency out of two random ones,
+// which avoids sending all the traffic to the fastest connection while mostly avoiding the slow ones.
+func P2C() Balancer {
+	return BalancerFunc(func(conns []*PoolConn, _ string) *PoolConn {
+		if len(conns) == 1 {
+			return conns[0]
+		}
+		i := rand.IntN(len(conns))
+		j := rand.IntN(len(conns) - 1)
+		if j >= i {
+			j++
+		}
+		a, b := conns[i], conns[j]
+		if b.EWMA() < a.EWMA() {
+			return b
+		}
+		return a
+	})
+}
+
+// ConsistentHash returns a Balancer picking the connection of a key on a consistent hash ring,
+// so the same key goes to the same server as long as it is alive and only the keys of a server
+// going down move.
+func ConsistentHash(opts ...hash.ConsistentHashOption) Balancer {
+	return &consistentHash{
+		ring:    hash.NewConsistentHash(opts...),
+		members: make(map[string]*PoolConn),
+	}
+}
+
+type consistentHash struct {
+	mu      sync.Mutex
+	ring    *hash.ConsistentHash
+	members map[string]*PoolConn // by address
+}
+
+func (b *consistentHash) Pick(conns []*PoolConn, key string) *PoolConn {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	alive := make(map[string]*PoolConn, len(conns))
+	for _, pc := range conns {
+		alive[pc.Addr] = pc
+		if _, ok := b.members[pc.Addr]; !ok {
+			b.ring.Add(pc.Addr)
+		}
+	}
+	for addr := range b.members {
+		if _, ok := alive[addr]; !ok {
+			b.ring.Remove(addr)
+		}
+	}
+	b.members = alive
+
+	if addr, ok := b.ring.Get(key); ok {
+		return alive[addr.(string)]
+	}
+	return conns[0]
+}
@@ -3,30 +3,46 @@ package kcp
 import "time"
 
 const (
-	_defaultSendWindowSize   = 1024
-	_defaultRecvWindowSize   = 1024
-	_defaultNoDelay          = 1
-	_defaultInterval         = 10
-	_defaultResend           = 2
-	_defaultNoCongestion     = 1
-	_defaultMTU              = 1400
-	_defaultRateLimit        = 0 // unlimited
-	_defaultMaxRetries       = 3
-	_defaultRetryDelay       = 2 * time.Second
-	_defaultConnTimeout      = 10 * time.Second
-	_defaultReadTimeout      = 30 * time.Second
-	_defaultWriteTimeout     = 30 * time.Second
-	_defaultHeartbeatTimeout = 10 * time.Second
-	_defaultACKNoDelay       = true
-	_defaultWriteDelay       = false
+	_defaultSendWindowSize    = 1024
+	_defaultRecvWindowSize    = 1024
+	_defaultNoDelay           = 1
+	_defaultInterval          = 10
+	_defaultResend            = 2
+	_defaultNoCongestion      = 1
+	_defaultMTU               = 1400
+	_defaultRateLimit         = 0 // unlimited
+	_defaultMaxRetries        = 3
+	_defaultRetryDelay        = 2 * time.Second
+	_defaultConnTimeout       = 10 * time.Second
+	_defaultReadTimeout       = 30 * time.Second
+	_defaultWriteTimeout      = 30 * time.Second
+	_defaultHeartbeatTimeout  = 0 // disabled
+	_defaultHeartbeatInterval = 0 // disabled
+	_defaultACKNoDelay        = true
+	_defaultWriteDelay        = false
+	_defaultCrypt             = CryptNone
+	_defaultDataShards        = 10
+	_defaultParityShards      = 3
+	_defaultSendQueueSize     = 256
+	_defaultSendQueuePolicy   = QueueFullDrop
+	_defaultMaxMsgSize        = 32 << 20 // 32MB, above MaxChunkSize
 )
 
 type Config struct {
-	ConnTimeout      time.Duration
-	ReadTimeout      time.Duration
-	WriteTimeout     time.Duration
+	ConnTimeout  time.Duration
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	// HeartbeatTimeout closes the sessions of a Server which received no frame for that long, 0 disables it.
+	// The clients have to send frames more often, e.g. with HeartbeatInterval.
 	HeartbeatTimeout time.Duration
-	RetryDelay       time.Duration
+	// HeartbeatInterval makes a dialed Conn send a MsgTypeHeartbeat message at that interval until it is
+	// closed, 0 disables it. It is meant for the connections exchanging messages only: the heartbeats
+	// would corrupt a raw byte stream such as a mux session or a file transfer.
+	HeartbeatInterval time.Duration
+	RetryDelay        time.Duration
+	// IdleTimeout closes the sessions of a Server which received no message but pings, pongs and
+	// heartbeats for that long, 0 disables it.
+	IdleTimeout time.Duration
 
 	SendWindowSize int
 	RecvWindowSize int
@@ -40,16 +56,37 @@ type Config struct {
 
 	ACKNoDelay bool
 	WriteDelay bool
+
+	// Crypt is the block cipher encrypting the packets, the key is derived from the pre-shared Key and Salt.
+	// Client and server must use the same Crypt, Key, Salt, DataShards and ParityShards,
+	// otherwise the packets fail the checksum and are silently dropped.
+	Crypt CryptMode
+	Key   string
+	Salt  string
+	// DataShards and ParityShards configure the Reed-Solomon forward error correction,
+	// ParityShards lost packets out of every DataShards+ParityShards can be recovered. 0 disables it.
+	DataShards   int
+	ParityShards int
+
+	// SendQueueSize is the number of messages pushed by the server, with SendTo, SendGroup or Broadcast,
+	// which can wait for a session to write them. SendQueuePolicy tells what to do once it is full.
+	SendQueueSize   int
+	SendQueuePolicy QueueFullPolicy
+
+	// MaxMsgSize is the largest payload RecvMsg accepts, as the length of a message is sent by the peer.
+	// 0 disables the limit.
+	MaxMsgSize int
 }
 
 // DefaultConfig returns the default KCP configuration.
 func DefaultConfig() *Config {
 	return &Config{
-		ConnTimeout:      _defaultConnTimeout,
-		ReadTimeout:      _defaultReadTimeout,
-		WriteTimeout:     _defaultWriteTimeout,
-		HeartbeatTimeout: _defaultHeartbeatTimeout,
-		RetryDelay:       _defaultRetryDelay,
+		ConnTimeout:       _defaultConnTimeout,
+		ReadTimeout:       _defaultReadTimeout,
+		WriteTimeout:      _defaultWriteTimeout,
+		HeartbeatTimeout:  _defaultHeartbeatTimeout,
+		HeartbeatInterval: _defaultHeartbeatInterval,
+		RetryDelay:        _defaultRetryDelay,
 
 		SendWindowSize: _defaultSendWindowSize,
 		RecvWindowSize: _defaultRecvWindowSize,
@@ -63,6 +100,15 @@ func DefaultConfig() *Config {
 
 		ACKNoDelay: _defaultACKNoDelay,
 		WriteDelay: _defaultWriteDelay,
+
+		Crypt:        _defaultCrypt,
+		DataShards:   _defaultDataShards,
+		ParityShards: _defaultParityShards,
+
+		SendQueueSize:   _defaultSendQueueSize,
+		SendQueuePolicy: _defaultSendQueuePolicy,
+
+		MaxMsgSize: _defaultMaxMsgSize,
 	}
 }
 
@@ -8,6 +8,7 @@ import (
 	"io"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/xtaci/kcp-go/v5"
@@ -15,12 +16,22 @@ import (
 
 var (
 	ErrExpectedPong = fmt.Errorf("expected pong message")
+	ErrMsgTooLarge  = fmt.Errorf("message larger than the max message size")
 )
 
 type Conn struct {
 	mu   sync.Mutex
 	conn *kcp.UDPSession
 	cfg  *Config
+
+	// Set by the server, onRecv is called for every frame and every raw read, with frame false,
+	// received, and onSend for every frame sent.
+	onRecv func(msgType uint32, frame bool)
+	onSend func(msgType uint32)
+
+	bytesSent     atomic.Uint64
+	bytesReceived atomic.Uint64
+	rtt           atomic.Int64 // of the last Ping
 }
 
 type DialFunc func(addr string) (net.Conn, error)
@@ -36,10 +47,11 @@ func DialWithContext(ctx context.Context, addr string, cfg *Config) (*Conn, erro
 	if cfg == nil {
 		cfg = DefaultConfig()
 	}
-	var (
-		conn *kcp.UDPSession
-		err  error
-	)
+	block, err := cfg.blockCrypt()
+	if err != nil {
+		return nil, err
+	}
+	var conn *kcp.UDPSession
 	for i := 0; i <= cfg.MaxRetries; i++ {
 		select {
 		case <-ctx.Done():
@@ -47,7 +59,7 @@ func DialWithContext(ctx context.Context, addr string, cfg *Config) (*Conn, erro
 		default:
 
 		}
-		conn, err = kcp.DialWithOptions(addr, nil, 10, 3)
+		conn, err = kcp.DialWithOptions(addr, block, cfg.DataShards, cfg.ParityShards)
 		if err == nil {
 			break
 		}
@@ -64,10 +76,25 @@ func DialWithContext(ctx context.Context, addr string, cfg *Config) (*Conn, erro
 		cfg:  cfg,
 	}
 	kcpConn.applyConfig()
+	if cfg.HeartbeatInterval > 0 {
+		go kcpConn.keepalive()
+	}
 	return kcpConn, nil
 
 }
 
+// keepalive sends a MsgTypeHeartbeat message every HeartbeatInterval, it stops once a send fails,
+// e.g. because the connection is closed.
+func (c *Conn) keepalive() {
+	ticker := time.NewTicker(c.cfg.HeartbeatInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if err := c.SendMsg(MsgTypeHeartbeat, nil); err != nil {
+			return
+		}
+	}
+}
+
 // applyConfig applies the configuration settings to the KCP connection.
 func (c *Conn) applyConfig() {
 	c.conn.SetNoDelay(c.cfg.NoDelay, c.cfg.Interval, c.cfg.Resend, c.cfg.NoCongestion)
@@ -118,11 +145,19 @@ func (c *Conn) SendMsgWithTimeout(msgType uint32, payload []byte, timeout time.D
 	binary.BigEndian.PutUint32(msg[0:4], uint32(len(payload)))
 	binary.BigEndian.PutUint32(msg[4:8], msgType)
 	copy(msg[8:], payload)
+	// A previous deadline mustn't apply to a message without timeout.
+	var deadline time.Time
 	if timeout > 0 {
-		c.conn.SetWriteDeadline(time.Now().Add(timeout))
+		deadline = time.Now().Add(timeout)
 	}
-	_, err := c.conn.Write(msg)
-	return err
+	c.conn.SetWriteDeadline(deadline)
+	if _, err := c.Write(msg); err != nil {
+		return err
+	}
+	if c.onSend != nil {
+		c.onSend(msgType)
+	}
+	return nil
 }
 
 // RecvMsg receives a message using the default read timeout.
@@ -131,6 +166,8 @@ func (c *Conn) RecvMsg() (msgType uint32, payload []byte, err error) {
 }
 
 // RecvMsgWithTimeout receives a message, applying the given timeout.
+// A message larger than Config.MaxMsgSize fails with ErrMsgTooLarge before its payload is read,
+// the connection is then out of sync and must be closed.
 func (c *Conn) RecvMsgWithTimeout(timeout time.Duration) (msgType uint32, payload []byte, err error) {
 	if timeout > 0 {
 		c.conn.SetReadDeadline(time.Now().Add(timeout))
@@ -138,16 +175,22 @@ func (c *Conn) RecvMsgWithTimeout(timeout time.Duration) (msgType uint32, payloa
 	// Read header
 	var header [8]byte
 	// read full 8 bytes for header
-	if _, err := io.ReadFull(c.conn, header[:]); err != nil {
+	if _, err := io.ReadFull(readerFunc(c.read), header[:]); err != nil {
 		return 0, nil, err
 	}
 	msgLen := binary.BigEndian.Uint32(header[0:4])
 	msgType = binary.BigEndian.Uint32(header[4:8])
+	if c.onRecv != nil {
+		c.onRecv(msgType, true)
+	}
+	if c.cfg.MaxMsgSize > 0 && int64(msgLen) > int64(c.cfg.MaxMsgSize) {
+		return msgType, nil, fmt.Errorf("%w: %d bytes", ErrMsgTooLarge, msgLen)
+	}
 
 	// Read payload
 	payload = make([]byte, msgLen)
 	// read full payload
-	_, err = io.ReadFull(c.conn, payload)
+	_, err = io.ReadFull(readerFunc(c.read), payload)
 	if err != nil {
 		return msgType, nil, err
 	}
@@ -180,7 +223,7 @@ func (c *Conn) WriteInt64(v int64) error {
 	if c.cfg.WriteTimeout > 0 {
 		c.conn.SetWriteDeadline(time.Now().Add(c.cfg.WriteTimeout))
 	}
-	return binary.Write(c.conn, binary.BigEndian, v)
+	return binary.Write(c, binary.BigEndian, v)
 }
 
 // ReadInt64 reads an int64 value from the connection using big-endian encoding.
@@ -189,18 +232,47 @@ func (c *Conn) ReadInt64() (int64, error) {
 		c.conn.SetReadDeadline(time.Now().Add(c.cfg.ReadTimeout))
 	}
 	var v int64
-	err := binary.Read(c.conn, binary.BigEndian, &v)
+	err := binary.Read(readerFunc(c.read), binary.BigEndian, &v)
+	if err == nil {
+		c.received()
+	}
 	return v, err
 }
 
 // Write writes data to the KCP connection.
 func (c *Conn) Write(data []byte) (int, error) {
-	return c.conn.Write(data)
+	n, err := c.conn.Write(data)
+	c.bytesSent.Add(uint64(n))
+	return n, err
 }
 
 // Read reads data from the KCP connection.
 func (c *Conn) Read(data []byte) (int, error) {
-	return c.conn.Read(data)
+	n, err := c.read(data)
+	if n > 0 {
+		c.received()
+	}
+	return n, err
+}
+
+// read reads from the KCP connection, counting the bytes received.
+func (c *Conn) read(data []byte) (int, error) {
+	n, err := c.conn.Read(data)
+	c.bytesReceived.Add(uint64(n))
+	return n, err
+}
+
+// received reports a raw read to the server.
+func (c *Conn) received() {
+	if c.onRecv != nil {
+		c.onRecv(0, false)
+	}
+}
+
+type readerFunc func(p []byte) (int, error)
+
+func (f readerFunc) Read(p []byte) (int, error) {
+	return f(p)
 }
 
 // CopyFrom copies data from the given reader to the KCP connection, reporting progress via the onProgress callback.
@@ -219,7 +291,7 @@ func (c *Conn) CopyFrom(r io.Reader, size int64, onProgress func(send int64)) er
 		if c.cfg.WriteTimeout > 0 {
 			c.conn.SetWriteDeadline(time.Now().Add(c.cfg.WriteTimeout))
 		}
-		w, err := c.conn.Write(buf[:n])
+		w, err := c.Write(buf[:n])
 		if err != nil {
 			return err
 		}
@@ -245,7 +317,7 @@ func (c *Conn) CopyTo(w io.Writer, size int64, onProgress func(receive int64)) e
 		if c.cfg.ReadTimeout > 0 {
 			c.conn.SetReadDeadline(time.Now().Add(c.cfg.ReadTimeout))
 		}
-		n, err := c.conn.Read(buf[:readSize])
+		n, err := c.Read(buf[:readSize])
 		if err != nil {
 			if err != io.EOF {
 				break
@@ -276,5 +348,7 @@ func (c *Conn) Ping(timeout time.Duration) (time.Duration, error) {
 	if msgType != MsgTypePong {
 		return 0, ErrExpectedPong
 	}
-	return time.Since(start), nil
+	rtt := time.Since(start)
+	c.rtt.Store(int64(rtt))
+	return rtt, nil
 }
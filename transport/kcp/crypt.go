@@ -0,0 +1,80 @@
+package kcp
+
+import (
+	"crypto/pbkdf2"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+
+	"github.com/xtaci/kcp-go/v5"
+)
+
+// CryptMode is the block cipher encrypting the KCP packets.
+type CryptMode string
+
+const (
+	CryptNone    CryptMode = "none"
+	CryptAES128  CryptMode = "aes-128"
+	CryptAES192  CryptMode = "aes-192"
+	CryptAES256  CryptMode = "aes-256"
+	CryptSalsa20 CryptMode = "salsa20"
+)
+
+const (
+	_defaultSalt    = "go-pkg/transport/kcp"
+	_keyIterations  = 4096
+	_maxTotalShards = 256
+)
+
+var (
+	ErrUnknownCryptMode = errors.New("unknown crypt mode")
+	ErrMissingKey       = errors.New("crypt mode requires a pre-shared key")
+	ErrInvalidShards    = errors.New("invalid FEC data/parity shards")
+)
+
+// keySize returns the size in bytes of the key of the mode, 0 for no encryption.
+func (m CryptMode) keySize() (int, error) {
+	switch m {
+	case "", CryptNone:
+		return 0, nil
+	case CryptAES128:
+		return 16, nil
+	case CryptAES192:
+		return 24, nil
+	case CryptAES256, CryptSalsa20:
+		return 32, nil
+	}
+	return 0, fmt.Errorf("%w: %q", ErrUnknownCryptMode, string(m))
+}
+
+// blockCrypt returns the block cipher configured by Crypt and Key, nil if encryption is disabled.
+func (c *Config) blockCrypt() (kcp.BlockCrypt, error) {
+	if c.DataShards < 0 || c.ParityShards < 0 || c.DataShards+c.ParityShards > _maxTotalShards ||
+		(c.ParityShards > 0 && c.DataShards == 0) {
+		return nil, ErrInvalidShards
+	}
+	size, err := c.Crypt.keySize()
+	if err != nil || size == 0 {
+		return nil, err
+	}
+	if c.Key == "" {
+		return nil, ErrMissingKey
+	}
+
+	key, err := deriveKey(c.Key, c.Salt, size)
+	if err != nil {
+		return nil, err
+	}
+	if c.Crypt == CryptSalsa20 {
+		return kcp.NewSalsa20BlockCrypt(key)
+	}
+	return kcp.NewAESBlockCrypt(key)
+}
+
+// deriveKey stretches the pre-shared key into a key of the given size with PBKDF2.
+func deriveKey(psk, salt string, size int) ([]byte, error) {
+	if salt == "" {
+		salt = _defaultSalt
+	}
+	return pbkdf2.Key(sha256.New, psk, []byte(salt), _keyIterations, size)
+}
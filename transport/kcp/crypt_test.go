@@ -0,0 +1,88 @@
+package kcp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// startPongServer starts a server answering every ping with a pong and returns its address.
+func startPongServer(t *testing.T, cfg *Config) string {
+	s := startServer(t, cfg, HandlerFunc(func(conn *Conn, session *Session) error {
+		for {
+			msgType, _, err := conn.RecvMsg()
+			if err != nil {
+				return err
+			}
+			if msgType == MsgTypePing {
+				if err := conn.SendMsg(MsgTypePong, nil); err != nil {
+					return err
+				}
+			}
+		}
+	}))
+	return s.Addr().String()
+}
+
+func TestConfig_Crypt(t *testing.T) {
+	for _, mode := range []CryptMode{CryptNone, CryptAES128, CryptAES192, CryptAES256, CryptSalsa20} {
+		t.Run(string(mode), func(t *testing.T) {
+			cfg := DefaultConfig()
+			cfg.Crypt = mode
+			cfg.Key = "secret"
+			cfg.DataShards, cfg.ParityShards = 4, 2
+			addr := startPongServer(t, cfg)
+
+			conn, err := Dial(addr, cfg)
+			require.NoError(t, err)
+			defer conn.Close()
+			_, err = conn.Ping(time.Second)
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestConfig_CryptMismatch(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Crypt = CryptAES256
+	cfg.Key = "secret"
+	addr := startPongServer(t, cfg)
+
+	other := DefaultConfig()
+	other.Crypt = CryptAES256
+	other.Key = "other secret"
+	conn, err := Dial(addr, other)
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Ping(300 * time.Millisecond)
+	require.Error(t, err)
+}
+
+func TestConfig_blockCrypt(t *testing.T) {
+	cfg := DefaultConfig()
+	block, err := cfg.blockCrypt()
+	require.NoError(t, err)
+	require.Nil(t, block)
+
+	cfg.Crypt = CryptAES128
+	_, err = cfg.blockCrypt()
+	require.ErrorIs(t, err, ErrMissingKey)
+
+	cfg.Crypt = "rot13"
+	cfg.Key = "secret"
+	_, err = cfg.blockCrypt()
+	require.ErrorIs(t, err, ErrUnknownCryptMode)
+
+	cfg.Crypt = CryptNone
+	cfg.DataShards, cfg.ParityShards = 0, 3
+	_, err = cfg.blockCrypt()
+	require.ErrorIs(t, err, ErrInvalidShards)
+
+	key1, err := deriveKey("secret", "", 32)
+	require.NoError(t, err)
+	key2, err := deriveKey("secret", "salt", 32)
+	require.NoError(t, err)
+	require.Len(t, key1, 32)
+	require.NotEqual(t, key1, key2)
+}
@@ -0,0 +1,62 @@
+package kcp
+
+import (
+	"errors"
+
+	"go-pkg/limiter/adaptive"
+)
+
+// Limit returns a Middleware handling the messages within the concurrency limit of l, the handling time
+// of every message is the sample of the limit algorithm. A message over the limit is answered with
+// MsgTypeError and dropped, the connection stays open. With adaptive.WithBlocking, the message waits
+// for a free slot until the session is closed.
+// Keepalive messages bypass the limit so that loaded sessions don't miss their heartbeats.
+func Limit(l *adaptive.Limiter) Middleware {
+	return func(next MsgHandlerFunc) MsgHandlerFunc {
+		return func(msg *Message) error {
+			if isKeepAlive(msg.Type) {
+				return next(msg)
+			}
+			release, err := l.Acquire(msg.Session.Context())
+			if err != nil {
+				if errors.Is(err, adaptive.ErrLimitExceeded) {
+					return msg.Reply(MsgTypeError, []byte(err.Error()))
+				}
+				return err
+			}
+			err = next(msg)
+			release(!isOverloaded(err))
+			return err
+		}
+	}
+}
+
+// LimitHandler wraps the handler so that it runs within the concurrency limit of l.
+// A Router is limited per message as with the Limit middleware, applied outside of its own middlewares.
+// Any other handler is limited per connection: a connection over the limit receives a MsgTypeError
+// message and is closed without reaching the handler, and the lifetime of every connection is the sample.
+func LimitHandler(l *adaptive.Limiter, handler Handler) Handler {
+	if r, ok := handler.(*Router); ok {
+		limit := Limit(l)
+		return HandlerFunc(func(conn *Conn, session *Session) error {
+			return r.serve(conn, session, limit)
+		})
+	}
+	return HandlerFunc(func(conn *Conn, session *Session) error {
+		release, err := l.Acquire(session.Context())
+		if err != nil {
+			if errors.Is(err, adaptive.ErrLimitExceeded) {
+				_ = conn.SendMsg(MsgTypeError, []byte(err.Error()))
+			}
+			return err
+		}
+		err = handler.HandleConn(conn, session)
+		release(!isOverloaded(err))
+		return err
+	})
+}
+
+// isOverloaded reports whether the error tells that the handler failed because of the load.
+func isOverloaded(err error) bool {
+	return adaptive.IsOverloaded(err) || errors.Is(err, ErrQueueFull)
+}
@@ -0,0 +1,105 @@
+package kcp
+
+import (
+	"testing"
+	"time"
+
+	"go-pkg/limiter/adaptive"
+
+	"github.com/stretchr/testify/require"
+)
+
+func startLimitServer(t *testing.T, l *adaptive.Limiter, block chan struct{}) string {
+	router := NewRouter()
+	router.Use(Limit(l))
+	router.Handle(MsgTypeData, func(msg *Message) error {
+		if string(msg.Payload) == "block" {
+			<-block
+		}
+		return msg.Reply(MsgTypeAck, msg.Payload)
+	})
+	cfg := DefaultConfig()
+	cfg.HeartbeatTimeout = 300 * time.Millisecond
+	return startServer(t, cfg, router).Addr().String()
+}
+
+func TestLimit(t *testing.T) {
+	l := adaptive.New(adaptive.NewVegas(adaptive.VegasConfig{InitialLimit: 1, MaxLimit: 1}))
+	block := make(chan struct{})
+	addr := startLimitServer(t, l, block)
+
+	busy, err := Dial(addr, nil)
+	require.NoError(t, err)
+	defer busy.Close()
+	require.NoError(t, busy.SendMsg(MsgTypeData, []byte("block")))
+	require.Eventually(t, func() bool { return l.Inflight() == 1 }, time.Second, time.Millisecond)
+
+	// A message over the limit is dropped, the connection and its keepalives go on.
+	conn, err := Dial(addr, nil)
+	require.NoError(t, err)
+	defer conn.Close()
+	require.NoError(t, conn.SendMsg(MsgTypeData, []byte("hello")))
+	msgType, payload, err := conn.RecvMsgWithTimeout(time.Second)
+	require.NoError(t, err)
+	require.Equal(t, MsgTypeError, msgType)
+	require.Equal(t, adaptive.ErrLimitExceeded.Error(), string(payload))
+	_, err = conn.Ping(time.Second)
+	require.NoError(t, err)
+
+	close(block)
+	msgType, _, err = busy.RecvMsgWithTimeout(time.Second)
+	require.NoError(t, err)
+	require.Equal(t, MsgTypeAck, msgType)
+	require.NoError(t, conn.SendMsg(MsgTypeData, []byte("hello")))
+	msgType, _, err = conn.RecvMsgWithTimeout(time.Second)
+	require.NoError(t, err)
+	require.Equal(t, MsgTypeAck, msgType)
+}
+
+func TestLimit_Blocking(t *testing.T) {
+	l := adaptive.New(adaptive.NewVegas(adaptive.VegasConfig{InitialLimit: 1, MaxLimit: 1}), adaptive.WithBlocking())
+	block := make(chan struct{})
+	defer close(block)
+	addr := startLimitServer(t, l, block)
+
+	busy, err := Dial(addr, nil)
+	require.NoError(t, err)
+	defer busy.Close()
+	require.NoError(t, busy.SendMsg(MsgTypeData, []byte("block")))
+	require.Eventually(t, func() bool { return l.Inflight() == 1 }, time.Second, time.Millisecond)
+
+	// A waiting message gives up once its session is closed, here by the heartbeat timeout.
+	conn, err := Dial(addr, nil)
+	require.NoError(t, err)
+	defer conn.Close()
+	require.NoError(t, conn.SendMsg(MsgTypeData, []byte("hello")))
+	require.Eventually(t, func() bool { return l.Rejected() == 1 }, 3*time.Second, 10*time.Millisecond)
+}
+
+func TestLimitHandler(t *testing.T) {
+	l := adaptive.New(adaptive.NewVegas(adaptive.VegasConfig{InitialLimit: 1, MaxLimit: 1}))
+	block := make(chan struct{})
+	defer close(block)
+	cfg := DefaultConfig()
+	cfg.HeartbeatTimeout = 300 * time.Millisecond
+	s := startServer(t, cfg, LimitHandler(l, HandlerFunc(func(conn *Conn, _ *Session) error {
+		<-block
+		return nil
+	})))
+
+	busy, err := Dial(s.Addr().String(), nil)
+	require.NoError(t, err)
+	defer busy.Close()
+	require.NoError(t, busy.SendMsg(MsgTypeHeartbeat, nil))
+	require.Eventually(t, func() bool { return l.Inflight() == 1 }, time.Second, time.Millisecond)
+
+	// A connection over the limit is refused.
+	conn, err := Dial(s.Addr().String(), nil)
+	require.NoError(t, err)
+	defer conn.Close()
+	require.NoError(t, conn.SendMsg(MsgTypeHeartbeat, nil))
+	msgType, payload, err := conn.RecvMsgWithTimeout(time.Second)
+	require.NoError(t, err)
+	require.Equal(t, MsgTypeError, msgType)
+	require.Equal(t, adaptive.ErrLimitExceeded.Error(), string(payload))
+}
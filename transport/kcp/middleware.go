@@ -0,0 +1,87 @@
+package kcp
+
+import (
+	"errors"
+	"time"
+
+	"go-pkg/logger"
+	"go-pkg/rec"
+)
+
+// ErrUnauthenticated will be returned by the Auth middleware for messages of unauthenticated sessions.
+var ErrUnauthenticated = errors.New("session is not authenticated")
+
+// Logging logs every handled message at debug level, and the failed ones at error level.
+func Logging(log logger.Logger) Middleware {
+	return func(next MsgHandlerFunc) MsgHandlerFunc {
+		return func(msg *Message) error {
+			start := time.Now()
+			err := next(msg)
+			// The remote address is logged rather than the session ID, which clients use to resume sessions.
+			if err != nil {
+				log.Errorf(err, "kcp: session from %s failed to handle %s message", msg.Conn.RemoteAddr(), MsgTypeName(msg.Type))
+				return err
+			}
+			log.Debugf("kcp: session from %s handled %s message of %d bytes in %s",
+				msg.Conn.RemoteAddr(), MsgTypeName(msg.Type), len(msg.Payload), time.Since(start))
+			return nil
+		}
+	}
+}
+
+// Recovery recovers the panics of the handlers, turning them into errors closing the connection.
+// onPanic, if not nil, receives the recovered panic.
+func Recovery(onPanic func(msg *Message, err error)) Middleware {
+	return func(next MsgHandlerFunc) MsgHandlerFunc {
+		return func(msg *Message) (err error) {
+			defer rec.RecoverWith(func(p error) {
+				if onPanic != nil {
+					onPanic(msg, p)
+				}
+				err = p
+			})
+			return next(msg)
+		}
+	}
+}
+
+// Auth requires the session to authenticate with a MsgTypeAuth message before any other message,
+// only pings and heartbeats are allowed before.
+// authenticate checks the payload of the auth message and returns the identity of the session,
+// it is answered with an empty MsgTypeAuth message on success. Failing to authenticate, or sending
+// other messages before, replies MsgTypeError and closes the connection with ErrUnauthenticated.
+func Auth(authenticate func(msg *Message) (identity any, err error)) Middleware {
+	return func(next MsgHandlerFunc) MsgHandlerFunc {
+		return func(msg *Message) error {
+			if _, ok := msg.Session.Identity(); ok {
+				return next(msg)
+			}
+			switch msg.Type {
+			case MsgTypePing, MsgTypeHeartbeat:
+				return next(msg)
+			case MsgTypeAuth:
+				identity, err := authenticate(msg)
+				if err != nil {
+					_ = msg.Reply(MsgTypeError, []byte(err.Error()))
+					return errors.Join(ErrUnauthenticated, err)
+				}
+				msg.Session.Authenticate(identity)
+				return msg.Reply(MsgTypeAuth, nil)
+			}
+			_ = msg.Reply(MsgTypeError, []byte(ErrUnauthenticated.Error()))
+			return ErrUnauthenticated
+		}
+	}
+}
+
+// Metrics reports the type, handling duration and error of every message to observe.
+func Metrics(observe func(msgType uint32, duration time.Duration, err error)) Middleware {
+	return func(next MsgHandlerFunc) MsgHandlerFunc {
+		return func(msg *Message) error {
+			start := time.Now()
+			err := next(msg)
+			observe(msg.Type, time.Since(start), err)
+			return err
+		}
+	}
+}
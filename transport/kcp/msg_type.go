@@ -1,5 +1,7 @@
 package kcp
 
+import "fmt"
+
 const (
 	MsgTypePing uint32 = iota + 1
 	MsgTypePong
@@ -7,4 +9,58 @@ const (
 	MsgTypeAck
 	MsgTypeError
 	MsgTypeHeartbeat
+	MsgTypeRequest
+	MsgTypeResponse
+	MsgTypeAuth
+	MsgTypeGoodbye
+	MsgTypeResume
 )
+
+// MsgTypeOther isn't sent, the statistics count the messages of the types not defined above under it,
+// so that the number of types counted stays bounded whatever the clients send.
+const MsgTypeOther uint32 = 0
+
+// MsgTypeName returns the name of the message type, as used by logs and metrics.
+func MsgTypeName(msgType uint32) string {
+	switch msgType {
+	case MsgTypeOther:
+		return "other"
+	case MsgTypePing:
+		return "ping"
+	case MsgTypePong:
+		return "pong"
+	case MsgTypeData:
+		return "data"
+	case MsgTypeAck:
+		return "ack"
+	case MsgTypeError:
+		return "error"
+	case MsgTypeHeartbeat:
+		return "heartbeat"
+	case MsgTypeRequest:
+		return "request"
+	case MsgTypeResponse:
+		return "response"
+	case MsgTypeAuth:
+		return "auth"
+	case MsgTypeGoodbye:
+		return "goodbye"
+	case MsgTypeResume:
+		return "resume"
+	}
+	return fmt.Sprintf("msg-%d", msgType)
+}
+
+// countedMsgType returns the message type under which the statistics count msgType.
+func countedMsgType(msgType uint32) uint32 {
+	if msgType > MsgTypeResume {
+		return MsgTypeOther
+	}
+	return msgType
+}
+
+// isKeepAlive tells whether the message type only keeps the connection alive, it doesn't count as
+// session activity.
+func isKeepAlive(msgType uint32) bool {
+	return msgType == MsgTypePing || msgType == MsgTypePong || msgType == MsgTypeHeartbeat
+}
@@ -0,0 +1,58 @@
+package mux
+
+import (
+	"errors"
+	"time"
+)
+
+const (
+	_defaultKeepAliveInterval = 5 * time.Second
+	_defaultKeepAliveTimeout  = 30 * time.Second
+	_defaultMaxFrameSize      = 32 * 1024
+	_defaultStreamWindow      = 256 * 1024
+	_defaultAcceptBacklog     = 1024
+)
+
+var ErrInvalidConfig = errors.New("invalid mux config")
+
+type Config struct {
+	// KeepAliveInterval is how often a keepalive frame is sent, 0 disables keepalive.
+	// Over a transport/kcp Conn, it should be lower than the HeartbeatTimeout of the server.
+	KeepAliveInterval time.Duration
+	// KeepAliveTimeout is how long the session lives without receiving any frame.
+	KeepAliveTimeout time.Duration
+
+	// MaxFrameSize is the maximum payload of a data frame, at most 65535.
+	MaxFrameSize int
+	// StreamWindow is the number of bytes a stream may receive before the reader consumes them,
+	// both ends of a session should use the same value.
+	StreamWindow int
+	// AcceptBacklog is the number of streams opened by the peer waiting for AcceptStream,
+	// further ones are refused.
+	AcceptBacklog int
+}
+
+// DefaultConfig returns the default mux configuration.
+func DefaultConfig() *Config {
+	return &Config{
+		KeepAliveInterval: _defaultKeepAliveInterval,
+		KeepAliveTimeout:  _defaultKeepAliveTimeout,
+		MaxFrameSize:      _defaultMaxFrameSize,
+		StreamWindow:      _defaultStreamWindow,
+		AcceptBacklog:     _defaultAcceptBacklog,
+	}
+}
+
+// validate checks that the configuration is usable.
+func (c *Config) validate() error {
+	if c.KeepAliveInterval < 0 || (c.KeepAliveInterval > 0 && c.KeepAliveTimeout < c.KeepAliveInterval) {
+		return ErrInvalidConfig
+	}
+	if c.MaxFrameSize <= 0 || c.MaxFrameSize > 65535 {
+		return ErrInvalidConfig
+	}
+	if c.StreamWindow <= 0 || c.AcceptBacklog < 0 {
+		return ErrInvalidConfig
+	}
+	return nil
+}
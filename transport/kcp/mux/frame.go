@@ -0,0 +1,45 @@
+package mux
+
+import "encoding/binary"
+
+const (
+	version = 1
+
+	// frame header: [version: 1 byte][cmd: 1 byte][length: 2 bytes][stream ID: 4 bytes]
+	headerSize = 8
+	// window update payload: [consumed: 4 bytes][window: 4 bytes]
+	updateSize = 8
+)
+
+const (
+	cmdSYN byte = iota // opens a stream
+	cmdFIN             // closes a stream
+	cmdPSH             // carries stream data
+	cmdNOP             // keepalive
+	cmdUPD             // updates the flow control window of a stream
+)
+
+type header [headerSize]byte
+
+func (h *header) encode(cmd byte, length int, id uint32) {
+	h[0] = version
+	h[1] = cmd
+	binary.BigEndian.PutUint16(h[2:4], uint16(length))
+	binary.BigEndian.PutUint32(h[4:8], id)
+}
+
+func (h *header) version() byte {
+	return h[0]
+}
+
+func (h *header) cmd() byte {
+	return h[1]
+}
+
+func (h *header) length() int {
+	return int(binary.BigEndian.Uint16(h[2:4]))
+}
+
+func (h *header) streamID() uint32 {
+	return binary.BigEndian.Uint32(h[4:8])
+}
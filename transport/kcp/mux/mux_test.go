@@ -0,0 +1,260 @@
+package mux
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"go-pkg/transport/kcp"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newPipeSessions(t *testing.T, cfg *Config) (client, server *Session) {
+	c, s := net.Pipe()
+	client, err := Client(c, cfg)
+	require.NoError(t, err)
+	server, err = Server(s, cfg)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = client.Close()
+		_ = server.Close()
+	})
+	return client, server
+}
+
+// echo copies back everything received on the accepted streams.
+func echo(sess *Session) {
+	for {
+		stream, err := sess.AcceptStream()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer stream.Close()
+			_, _ = io.Copy(stream, stream)
+		}()
+	}
+}
+
+func TestSession_Streams(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.StreamWindow = 16 * 1024
+	cfg.MaxFrameSize = 4096
+	client, server := newPipeSessions(t, cfg)
+	go echo(server)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			stream, err := client.OpenStream()
+			require.NoError(t, err)
+			defer stream.Close()
+
+			data := make([]byte, 200*1024)
+			_, _ = rand.Read(data)
+			go func() {
+				_, err := stream.Write(data)
+				require.NoError(t, err)
+			}()
+			got := make([]byte, len(data))
+			_, err = io.ReadFull(stream, got)
+			require.NoError(t, err)
+			require.True(t, bytes.Equal(data, got))
+		}()
+	}
+	wg.Wait()
+	require.Eventually(t, func() bool {
+		return client.NumStreams() == 0 && server.NumStreams() == 0
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestStream_Close(t *testing.T) {
+	client, server := newPipeSessions(t, nil)
+
+	stream, err := client.OpenStream()
+	require.NoError(t, err)
+	peer, err := server.AcceptStream()
+	require.NoError(t, err)
+	require.Equal(t, stream.ID(), peer.ID())
+
+	_, err = stream.Write([]byte("last words"))
+	require.NoError(t, err)
+	require.NoError(t, stream.Close())
+	require.ErrorIs(t, stream.Close(), io.ErrClosedPipe)
+	_, err = stream.Write([]byte("x"))
+	require.ErrorIs(t, err, io.ErrClosedPipe)
+
+	got, err := io.ReadAll(peer)
+	require.NoError(t, err)
+	require.Equal(t, "last words", string(got))
+	_, err = peer.Write([]byte("x"))
+	require.ErrorIs(t, err, io.ErrClosedPipe)
+	require.NoError(t, peer.Close())
+
+	require.NoError(t, client.Close())
+	_, err = client.OpenStream()
+	require.ErrorIs(t, err, ErrSessionClosed)
+	_, err = server.AcceptStream()
+	require.Error(t, err)
+}
+
+func TestStream_Deadline(t *testing.T) {
+	client, server := newPipeSessions(t, nil)
+	stream, err := client.OpenStream()
+	require.NoError(t, err)
+	_, err = server.AcceptStream()
+	require.NoError(t, err)
+
+	require.NoError(t, stream.SetReadDeadline(time.Now().Add(20*time.Millisecond)))
+	_, err = stream.Read(make([]byte, 1))
+	require.ErrorIs(t, err, os.ErrDeadlineExceeded)
+	var netErr net.Error
+	require.True(t, errors.As(err, &netErr) && netErr.Timeout())
+}
+
+func TestSession_KeepAlive(t *testing.T) {
+	c, s := net.Pipe()
+	go func() { _, _ = io.Copy(io.Discard, s) }() // a peer which never answers
+	defer s.Close()
+
+	cfg := DefaultConfig()
+	cfg.KeepAliveInterval = 10 * time.Millisecond
+	cfg.KeepAliveTimeout = 50 * time.Millisecond
+	sess, err := Client(c, cfg)
+	require.NoError(t, err)
+
+	select {
+	case <-sess.CloseChan():
+	case <-time.After(time.Second):
+		t.Fatal("session not closed by keepalive")
+	}
+	_, err = sess.AcceptStream()
+	require.ErrorIs(t, err, ErrKeepAliveTimeout)
+
+	cfg.KeepAliveTimeout = time.Millisecond
+	_, err = Client(c, cfg)
+	require.ErrorIs(t, err, ErrInvalidConfig)
+}
+
+func TestSession_HTTP(t *testing.T) {
+	client, server := newPipeSessions(t, nil)
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("hello " + r.URL.Path))
+	})}
+	go func() { _ = srv.Serve(server) }()
+	defer srv.Close()
+
+	httpClient := &http.Client{Transport: &http.Transport{
+		DialContext: func(context.Context, string, string) (net.Conn, error) {
+			return client.OpenStream()
+		},
+	}}
+	for i := 0; i < 3; i++ {
+		resp, err := httpClient.Get("http://mux/world")
+		require.NoError(t, err)
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+		require.Equal(t, "hello /world", string(body))
+	}
+}
+
+func TestSession_KCP(t *testing.T) {
+	srv := kcp.NewServer(nil)
+	require.NoError(t, srv.Listen("127.0.0.1:0"))
+	go func() {
+		_ = srv.ServeFunc(func(conn *kcp.Conn, session *kcp.Session) error {
+			sess, err := Server(conn, nil)
+			if err != nil {
+				return err
+			}
+			go echo(sess)
+			<-sess.CloseChan()
+			return nil
+		})
+	}()
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_ = srv.Stop(ctx)
+	}()
+
+	conn, err := kcp.Dial(srv.Addr().String(), nil)
+	require.NoError(t, err)
+	client, err := Client(conn, nil)
+	require.NoError(t, err)
+	defer client.Close()
+
+	for i := 0; i < 4; i++ {
+		stream, err := client.OpenStream()
+		require.NoError(t, err)
+		msg := []byte("stream over kcp")
+		_, err = stream.Write(msg)
+		require.NoError(t, err)
+		got := make([]byte, len(msg))
+		_, err = io.ReadFull(stream, got)
+		require.NoError(t, err)
+		require.Equal(t, msg, got)
+		require.NoError(t, stream.Close())
+	}
+}
+
+func TestSession_ProtocolViolations(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.StreamWindow = 1024
+	c, s := net.Pipe()
+	server, err := Server(s, cfg)
+	require.NoError(t, err)
+	defer server.Close()
+	defer c.Close()
+
+	frames := make(chan header, 4)
+	go func() {
+		var hdr header
+		for {
+			if _, err := io.ReadFull(c, hdr[:]); err != nil {
+				return
+			}
+			frames <- hdr
+		}
+	}()
+	write := func(cmd byte, id uint32, payload []byte) {
+		var hdr header
+		hdr.encode(cmd, len(payload), id)
+		_, err := c.Write(append(hdr[:], payload...))
+		require.NoError(t, err)
+	}
+
+	// A SYN with an ID of the server's parity is ignored.
+	write(cmdSYN, 2, nil)
+	write(cmdSYN, 1, nil)
+	stream, err := server.AcceptStream()
+	require.NoError(t, err)
+	require.Equal(t, uint32(1), stream.ID())
+	require.Equal(t, 1, server.NumStreams())
+
+	// Data beyond the window resets the stream.
+	write(cmdPSH, 1, make([]byte, 1000))
+	write(cmdPSH, 1, make([]byte, 100))
+	select {
+	case hdr := <-frames:
+		require.Equal(t, cmdFIN, hdr.cmd())
+		require.Equal(t, uint32(1), hdr.streamID())
+	case <-time.After(time.Second):
+		t.Fatal("the stream wasn't reset")
+	}
+	_, err = stream.Read(make([]byte, 10))
+	require.ErrorIs(t, err, ErrWindowExceeded)
+	require.Zero(t, server.NumStreams())
+}
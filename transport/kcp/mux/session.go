@@ -0,0 +1,342 @@
+// Package mux multiplexes many reliable, ordered streams over a single connection such as a
+// transport/kcp Conn, so that opening a logical stream costs neither a handshake nor a KCP
+// conversation. Every Stream is a net.Conn with its own flow control window, and a Session is
+// a net.Listener of the streams opened by the peer, so existing servers and gRPC can run over it.
+package mux
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	bsPool "go-pkg/pool/byte_slice"
+)
+
+var (
+	ErrSessionClosed    = errors.New("mux session is closed")
+	ErrStreamsExhausted = errors.New("mux stream IDs exhausted")
+	ErrKeepAliveTimeout = errors.New("mux keepalive timeout")
+	ErrInvalidFrame     = errors.New("invalid mux frame")
+	ErrWindowExceeded   = errors.New("mux stream window exceeded")
+)
+
+// Conn is the connection carrying the frames of a Session, e.g. a transport/kcp Conn.
+type Conn interface {
+	io.ReadWriteCloser
+	LocalAddr() net.Addr
+	RemoteAddr() net.Addr
+}
+
+// Session multiplexes streams over a Conn.
+type Session struct {
+	conn   Conn
+	cfg    *Config
+	nextID uint32 // odd on the client side, even on the server side
+
+	mu      sync.Mutex
+	streams map[uint32]*Stream
+
+	writeMu sync.Mutex
+	accepts chan *Stream
+
+	lastRecv  atomic.Int64 // unix nanoseconds of the last received frame
+	die       chan struct{}
+	closeOnce sync.Once
+	closeErr  error // cause of the close, set before die is closed
+}
+
+// Client returns the client side of a session over conn, it takes ownership of conn.
+func Client(conn Conn, cfg *Config) (*Session, error) {
+	return newSession(conn, cfg, 1)
+}
+
+// Server returns the server side of a session over conn, it takes ownership of conn.
+func Server(conn Conn, cfg *Config) (*Session, error) {
+	return newSession(conn, cfg, 2)
+}
+
+func newSession(conn Conn, cfg *Config, firstID uint32) (*Session, error) {
+	if cfg == nil {
+		cfg = DefaultConfig()
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	s := &Session{
+		conn:    conn,
+		cfg:     cfg,
+		nextID:  firstID,
+		streams: make(map[uint32]*Stream),
+		accepts: make(chan *Stream, cfg.AcceptBacklog),
+		die:     make(chan struct{}),
+	}
+	s.lastRecv.Store(time.Now().UnixNano())
+	go s.recvLoop()
+	if cfg.KeepAliveInterval > 0 {
+		go s.keepalive()
+	}
+	return s, nil
+}
+
+// OpenStream opens a new stream to the peer.
+func (s *Session) OpenStream() (*Stream, error) {
+	s.mu.Lock()
+	if s.IsClosed() {
+		s.mu.Unlock()
+		return nil, ErrSessionClosed
+	}
+	id := s.nextID
+	if id+2 < id {
+		s.mu.Unlock()
+		return nil, ErrStreamsExhausted
+	}
+	s.nextID += 2
+	stream := newStream(id, s)
+	s.streams[id] = stream
+	s.mu.Unlock()
+
+	if err := s.writeFrame(cmdSYN, id, nil); err != nil {
+		s.removeStream(id)
+		return nil, err
+	}
+	return stream, nil
+}
+
+// AcceptStream waits for the next stream opened by the peer.
+func (s *Session) AcceptStream() (*Stream, error) {
+	select {
+	case stream := <-s.accepts:
+		return stream, nil
+	case <-s.die:
+		return nil, s.err()
+	}
+}
+
+// Accept implements net.Listener, it is AcceptStream returning a net.Conn.
+func (s *Session) Accept() (net.Conn, error) {
+	return s.AcceptStream()
+}
+
+// Addr implements net.Listener, it returns the local address of the underlying connection.
+func (s *Session) Addr() net.Addr {
+	return s.conn.LocalAddr()
+}
+
+// LocalAddr returns the local address of the underlying connection.
+func (s *Session) LocalAddr() net.Addr {
+	return s.conn.LocalAddr()
+}
+
+// RemoteAddr returns the remote address of the underlying connection.
+func (s *Session) RemoteAddr() net.Addr {
+	return s.conn.RemoteAddr()
+}
+
+// NumStreams returns the number of open streams.
+func (s *Session) NumStreams() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.streams)
+}
+
+// Close closes the session, its streams and the underlying connection.
+func (s *Session) Close() error {
+	if !s.closeWithErr(ErrSessionClosed) {
+		return ErrSessionClosed
+	}
+	return nil
+}
+
+// IsClosed reports whether the session is closed.
+func (s *Session) IsClosed() bool {
+	select {
+	case <-s.die:
+		return true
+	default:
+		return false
+	}
+}
+
+// CloseChan returns a channel closed once the session is closed.
+func (s *Session) CloseChan() <-chan struct{} {
+	return s.die
+}
+
+// closeWithErr closes the session with the given cause, it reports whether it was still open.
+func (s *Session) closeWithErr(err error) bool {
+	closed := false
+	s.closeOnce.Do(func() {
+		closed = true
+		s.closeErr = err
+		close(s.die)
+		_ = s.conn.Close()
+
+		s.mu.Lock()
+		streams := s.streams
+		s.streams = make(map[uint32]*Stream)
+		s.mu.Unlock()
+		for _, stream := range streams {
+			stream.sessionClosed()
+		}
+	})
+	return closed
+}
+
+// err returns the cause of the close.
+func (s *Session) err() error {
+	<-s.die
+	return s.closeErr
+}
+
+func (s *Session) removeStream(id uint32) {
+	s.mu.Lock()
+	delete(s.streams, id)
+	s.mu.Unlock()
+}
+
+func (s *Session) stream(id uint32) *Stream {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.streams[id]
+}
+
+// writeFrame writes a frame as a single write on the connection.
+func (s *Session) writeFrame(cmd byte, id uint32, payload []byte) error {
+	if s.IsClosed() {
+		return s.err()
+	}
+	frame := bsPool.Get(headerSize + len(payload))
+	defer bsPool.Put(frame)
+	(*header)(frame[:headerSize]).encode(cmd, len(payload), id)
+	copy(frame[headerSize:], payload)
+
+	s.writeMu.Lock()
+	_, err := s.conn.Write(frame)
+	s.writeMu.Unlock()
+	if err != nil {
+		s.closeWithErr(err)
+		return err
+	}
+	return nil
+}
+
+// writeUpdate tells the peer how many bytes of the stream have been consumed.
+func (s *Session) writeUpdate(id uint32, consumed, window uint32) error {
+	var payload [updateSize]byte
+	binary.BigEndian.PutUint32(payload[0:4], consumed)
+	binary.BigEndian.PutUint32(payload[4:8], window)
+	return s.writeFrame(cmdUPD, id, payload[:])
+}
+
+func (s *Session) recvLoop() {
+	var (
+		hdr    header
+		update [updateSize]byte
+	)
+	for {
+		if _, err := io.ReadFull(s.conn, hdr[:]); err != nil {
+			s.closeWithErr(err)
+			return
+		}
+		s.lastRecv.Store(time.Now().UnixNano())
+		if hdr.version() != version {
+			s.closeWithErr(ErrInvalidFrame)
+			return
+		}
+
+		id, length := hdr.streamID(), hdr.length()
+		switch hdr.cmd() {
+		case cmdNOP:
+		case cmdSYN:
+			s.accept(id)
+		case cmdFIN:
+			if stream := s.stream(id); stream != nil {
+				stream.finReceived()
+			}
+		case cmdPSH:
+			if length == 0 {
+				continue
+			}
+			payload := bsPool.Get(length)
+			if _, err := io.ReadFull(s.conn, payload); err != nil {
+				bsPool.Put(payload)
+				s.closeWithErr(err)
+				return
+			}
+			if stream := s.stream(id); stream != nil {
+				stream.pushData(payload)
+			} else {
+				bsPool.Put(payload)
+			}
+			continue
+		case cmdUPD:
+			if length != updateSize {
+				s.closeWithErr(ErrInvalidFrame)
+				return
+			}
+			if _, err := io.ReadFull(s.conn, update[:]); err != nil {
+				s.closeWithErr(err)
+				return
+			}
+			if stream := s.stream(id); stream != nil {
+				stream.windowUpdate(binary.BigEndian.Uint32(update[0:4]), binary.BigEndian.Uint32(update[4:8]))
+			}
+			continue
+		default:
+			s.closeWithErr(ErrInvalidFrame)
+			return
+		}
+		if length > 0 {
+			// Control frames carry no payload, skip it for forward compatibility.
+			if _, err := io.CopyN(io.Discard, s.conn, int64(length)); err != nil {
+				s.closeWithErr(err)
+				return
+			}
+		}
+	}
+}
+
+// accept registers the stream opened by the peer, it is refused if the backlog is full.
+// IDs of the local parity belong to the streams opened by this side and are ignored.
+func (s *Session) accept(id uint32) {
+	if id == 0 || id%2 == s.nextID%2 {
+		return
+	}
+	stream := newStream(id, s)
+	s.mu.Lock()
+	if _, exists := s.streams[id]; exists || s.IsClosed() {
+		s.mu.Unlock()
+		return
+	}
+	s.streams[id] = stream
+	s.mu.Unlock()
+
+	select {
+	case s.accepts <- stream:
+	default:
+		s.removeStream(id)
+		_ = s.writeFrame(cmdFIN, id, nil)
+	}
+}
+
+// keepalive sends keepalive frames and closes the session once the peer has been silent for too long.
+func (s *Session) keepalive() {
+	ticker := time.NewTicker(s.cfg.KeepAliveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-s.die:
+			return
+		}
+		if time.Since(time.Unix(0, s.lastRecv.Load())) > s.cfg.KeepAliveTimeout {
+			s.closeWithErr(ErrKeepAliveTimeout)
+			return
+		}
+		_ = s.writeFrame(cmdNOP, 0, nil)
+	}
+}
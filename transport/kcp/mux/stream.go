@@ -0,0 +1,273 @@
+package mux
+
+import (
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"go-pkg/buffer/linked_list"
+)
+
+// Stream is a reliable, ordered and flow-controlled byte stream of a Session, it implements net.Conn.
+//
+// Close is graceful: the data written before it is delivered to the peer, which reads it before io.EOF.
+type Stream struct {
+	id   uint32
+	sess *Session
+
+	mu         sync.Mutex
+	buf        linked_list.Buffer // received data not read yet
+	consumed   uint32             // bytes read by the application
+	reported   uint32             // consumed last sent to the peer
+	sent       uint32             // bytes sent to the peer
+	peerRead   uint32             // bytes of ours the peer has consumed
+	peerWindow uint32
+	finRecv    bool  // the peer closed the stream
+	closeErr   error // set once the stream is closed locally or with the session
+
+	readDeadline  time.Time
+	writeDeadline time.Time
+
+	wmu      sync.Mutex    // keeps the chunks of a Write together
+	readable chan struct{} // signaled when data, FIN or a new read deadline arrives
+	writable chan struct{} // signaled when the window grows, FIN or a new write deadline arrives
+	die      chan struct{}
+}
+
+func newStream(id uint32, sess *Session) *Stream {
+	return &Stream{
+		id:         id,
+		sess:       sess,
+		peerWindow: uint32(sess.cfg.StreamWindow),
+		readable:   make(chan struct{}, 1),
+		writable:   make(chan struct{}, 1),
+		die:        make(chan struct{}),
+	}
+}
+
+// ID returns the identifier of the stream within its session.
+func (st *Stream) ID() uint32 {
+	return st.id
+}
+
+// Read reads the data received on the stream, it returns io.EOF once the peer closed the stream
+// and all its data has been read.
+func (st *Stream) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	for {
+		st.mu.Lock()
+		if err := st.closeErr; err != nil {
+			st.mu.Unlock()
+			return 0, err
+		}
+		if st.buf.Buffered() > 0 {
+			n, _ := st.buf.Read(p)
+			st.consumed += uint32(n)
+			var update bool
+			if st.consumed-st.reported >= uint32(st.sess.cfg.StreamWindow)/2 {
+				st.reported = st.consumed
+				update = true
+			}
+			consumed := st.consumed
+			st.mu.Unlock()
+
+			if update && !st.isFinRecv() {
+				_ = st.sess.writeUpdate(st.id, consumed, uint32(st.sess.cfg.StreamWindow))
+			}
+			return n, nil
+		}
+		if st.finRecv {
+			st.mu.Unlock()
+			return 0, io.EOF
+		}
+		deadline := st.readDeadline
+		st.mu.Unlock()
+
+		if err := st.wait(st.readable, deadline); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// Write writes p to the stream, it blocks while the peer's window is full.
+func (st *Stream) Write(p []byte) (int, error) {
+	st.wmu.Lock()
+	defer st.wmu.Unlock()
+
+	var written int
+	for len(p) > 0 {
+		st.mu.Lock()
+		if err := st.closeErr; err != nil {
+			st.mu.Unlock()
+			return written, err
+		}
+		if st.finRecv {
+			st.mu.Unlock()
+			return written, io.ErrClosedPipe
+		}
+		avail := int64(st.peerWindow) - int64(st.sent-st.peerRead)
+		if avail <= 0 {
+			deadline := st.writeDeadline
+			st.mu.Unlock()
+			if err := st.wait(st.writable, deadline); err != nil {
+				return written, err
+			}
+			continue
+		}
+		n := min(int64(len(p)), avail, int64(st.sess.cfg.MaxFrameSize))
+		st.sent += uint32(n)
+		st.mu.Unlock()
+
+		if err := st.sess.writeFrame(cmdPSH, st.id, p[:n]); err != nil {
+			return written, err
+		}
+		written += int(n)
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// Close closes the stream, the peer reads the data written so far and then io.EOF.
+func (st *Stream) Close() error {
+	st.mu.Lock()
+	if st.closeErr != nil {
+		st.mu.Unlock()
+		return io.ErrClosedPipe
+	}
+	st.closeErr = io.ErrClosedPipe
+	st.buf.Reset()
+	close(st.die)
+	st.mu.Unlock()
+
+	st.sess.removeStream(st.id)
+	if st.sess.IsClosed() {
+		return nil
+	}
+	return st.sess.writeFrame(cmdFIN, st.id, nil)
+}
+
+// LocalAddr implements net.Conn.
+func (st *Stream) LocalAddr() net.Addr {
+	return st.sess.LocalAddr()
+}
+
+// RemoteAddr implements net.Conn.
+func (st *Stream) RemoteAddr() net.Addr {
+	return st.sess.RemoteAddr()
+}
+
+// SetDeadline implements net.Conn.
+func (st *Stream) SetDeadline(t time.Time) error {
+	_ = st.SetReadDeadline(t)
+	return st.SetWriteDeadline(t)
+}
+
+// SetReadDeadline implements net.Conn.
+func (st *Stream) SetReadDeadline(t time.Time) error {
+	st.mu.Lock()
+	st.readDeadline = t
+	st.mu.Unlock()
+	notify(st.readable)
+	return nil
+}
+
+// SetWriteDeadline implements net.Conn, the deadline applies to the wait for the peer's window.
+func (st *Stream) SetWriteDeadline(t time.Time) error {
+	st.mu.Lock()
+	st.writeDeadline = t
+	st.mu.Unlock()
+	notify(st.writable)
+	return nil
+}
+
+// wait blocks until ch is signaled, the stream or session is closed, or the deadline is exceeded.
+func (st *Stream) wait(ch chan struct{}, deadline time.Time) error {
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		d := time.Until(deadline)
+		if d <= 0 {
+			return os.ErrDeadlineExceeded
+		}
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case <-ch:
+		return nil
+	case <-st.die:
+		return nil // the caller reports the close error
+	case <-timeout:
+		return os.ErrDeadlineExceeded
+	}
+}
+
+func (st *Stream) isFinRecv() bool {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.finRecv
+}
+
+// pushData appends a payload received from the peer, taking ownership of it.
+// The stream is reset if the peer sends more than the window allows.
+func (st *Stream) pushData(payload []byte) {
+	st.mu.Lock()
+	if st.closeErr != nil {
+		st.mu.Unlock()
+		st.buf.FreeNode(payload)
+		return
+	}
+	if st.buf.Buffered()+len(payload) > st.sess.cfg.StreamWindow {
+		st.closeErr = ErrWindowExceeded
+		st.buf.Reset()
+		close(st.die)
+		st.mu.Unlock()
+		st.buf.FreeNode(payload)
+		st.sess.removeStream(st.id)
+		_ = st.sess.writeFrame(cmdFIN, st.id, nil)
+		return
+	}
+	st.buf.Append(payload)
+	st.mu.Unlock()
+	notify(st.readable)
+}
+
+func (st *Stream) finReceived() {
+	st.mu.Lock()
+	st.finRecv = true
+	st.mu.Unlock()
+	notify(st.readable)
+	notify(st.writable)
+}
+
+func (st *Stream) windowUpdate(consumed, window uint32) {
+	st.mu.Lock()
+	st.peerRead = consumed
+	st.peerWindow = window
+	st.mu.Unlock()
+	notify(st.writable)
+}
+
+// sessionClosed releases the stream once its session is closed.
+func (st *Stream) sessionClosed() {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.closeErr == nil {
+		st.closeErr = st.sess.closeErr
+		st.buf.Reset()
+		close(st.die)
+	}
+}
+
+// notify signals ch without blocking.
+func notify(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
@@ -1,15 +1,72 @@
 package kcp
 
 import (
+	"errors"
 	"sync"
 	"time"
 )
 
+const (
+	_defaultMinBackoff = 100 * time.Millisecond
+	_defaultMaxBackoff = 30 * time.Second
+	_poolMaxFails      = 3    // failed health checks after which a server is down
+	_ewmaAlpha         = 0.25 // weight of the last latency in PoolConn.EWMA
+)
+
+// ErrNoAliveConn will be returned when the pool has no server alive.
+var ErrNoAliveConn = errors.New("no alive connection in the pool")
+
+// PoolEventType is the type of a PoolEvent.
+type PoolEventType int
+
+const (
+	PoolEventAdded        PoolEventType = iota // a server has been added
+	PoolEventRemoved                           // a server has been removed
+	PoolEventDown                              // a server failed too many health checks
+	PoolEventUp                                // a server down has been redialed
+	PoolEventRedialFailed                      // redialing a server down failed, Err tells why
+)
+
+// String returns the name of the event type.
+func (t PoolEventType) String() string {
+	switch t {
+	case PoolEventAdded:
+		return "added"
+	case PoolEventRemoved:
+		return "removed"
+	case PoolEventDown:
+		return "down"
+	case PoolEventUp:
+		return "up"
+	case PoolEventRedialFailed:
+		return "redial failed"
+	}
+	return "unknown"
+}
+
+// PoolEvent reports a change of the servers of a Pool.
+type PoolEvent struct {
+	Type PoolEventType
+	Addr string
+	Err  error
+}
+
 // Pool manages a pool of KCP connections to multiple servers.
 type Pool struct {
 	cfg     *Config
 	servers []*PoolConn
 	mu      sync.RWMutex
+
+	balancer   Balancer
+	interval   time.Duration
+	timeout    time.Duration
+	minBackoff time.Duration
+	maxBackoff time.Duration
+	onEvent    func(event PoolEvent)
+
+	stop      chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
 }
 
 // PoolConn represents a connection in the KCP connection pool.
@@ -21,21 +78,114 @@ type PoolConn struct {
 	Conn     *Conn
 	FailCnt  int
 	IsAlive  bool
+
+	weight   int
+	health   *Conn   // dedicated to the health checks, dialed on the first one
+	ewma     float64 // EWMA of the latency in nanoseconds
+	backoff  time.Duration
+	nextDial time.Time // when the server down can be redialed
+}
+
+// Weight returns the weight of the server for RoundRobin.
+func (pc *PoolConn) Weight() int {
+	return pc.weight
+}
+
+// EWMA returns the exponentially weighted moving average of the latency measured by the health checks.
+func (pc *PoolConn) EWMA() time.Duration {
+	pc.mu.RLock()
+	defer pc.mu.RUnlock()
+	return time.Duration(pc.ewma)
+}
+
+func (pc *PoolConn) latency() time.Duration {
+	pc.mu.RLock()
+	defer pc.mu.RUnlock()
+	return pc.Latency
+}
+
+func (pc *PoolConn) conn() *Conn {
+	pc.mu.RLock()
+	defer pc.mu.RUnlock()
+	return pc.Conn
+}
+
+// close closes the connections to the server.
+func (pc *PoolConn) close() {
+	pc.mu.Lock()
+	conn, health := pc.Conn, pc.health
+	pc.health = nil
+	pc.mu.Unlock()
+	if conn != nil {
+		conn.Close()
+	}
+	if health != nil {
+		health.Close()
+	}
+}
+
+// PoolOption configures a Pool.
+type PoolOption func(p *Pool)
+
+// WithBalancer sets the strategy of Get, it defaults to LeastLatency.
+func WithBalancer(balancer Balancer) PoolOption {
+	return func(p *Pool) {
+		p.balancer = balancer
+	}
+}
+
+// WithHealthCheck runs HealthCheck with the given timeout every interval in the background, until Close.
+func WithHealthCheck(interval, timeout time.Duration) PoolOption {
+	return func(p *Pool) {
+		p.interval, p.timeout = interval, timeout
+	}
+}
+
+// WithBackoff sets the delay before redialing a server down, it starts at minDelay and doubles after every
+// failure up to maxDelay.
+func WithBackoff(minDelay, maxDelay time.Duration) PoolOption {
+	return func(p *Pool) {
+		p.minBackoff, p.maxBackoff = minDelay, maxDelay
+	}
+}
+
+// WithPoolEventHandler sets the handler receiving the events of the pool, it mustn't block.
+func WithPoolEventHandler(handler func(event PoolEvent)) PoolOption {
+	return func(p *Pool) {
+		p.onEvent = handler
+	}
 }
 
 // NewPool creates a new KCP connection pool with the given configuration.
-func NewPool(cfg *Config) *Pool {
+func NewPool(cfg *Config, opts ...PoolOption) *Pool {
 	if cfg == nil {
 		cfg = DefaultConfig()
 	}
-	return &Pool{
-		cfg:     cfg,
-		servers: make([]*PoolConn, 0),
+	p := &Pool{
+		cfg:        cfg,
+		servers:    make([]*PoolConn, 0),
+		balancer:   LeastLatency(),
+		minBackoff: _defaultMinBackoff,
+		maxBackoff: _defaultMaxBackoff,
+		stop:       make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	if p.interval > 0 {
+		p.wg.Add(1)
+		go p.healthLoop()
 	}
+	return p
 }
 
 // Add adds a new server connection to the pool.
 func (p *Pool) Add(addr string) error {
+	return p.AddWeighted(addr, 1)
+}
+
+// AddWeighted adds a new server connection with the given weight for RoundRobin to the pool.
+func (p *Pool) AddWeighted(addr string, weight int) error {
 	conn, err := Dial(addr, p.cfg)
 	if err != nil {
 		return err
@@ -46,37 +196,76 @@ func (p *Pool) Add(addr string) error {
 		Conn:     conn,
 		IsAlive:  true,
 		LastPing: time.Now(),
+		weight:   max(weight, 1),
 	}
 	p.mu.Lock()
 	p.servers = append(p.servers, pc)
 	p.mu.Unlock()
+	p.emit(PoolEvent{Type: PoolEventAdded, Addr: addr})
 	return nil
 }
 
+// Remove closes the connection to the server and removes it from the pool, it returns false if
+// the server isn't in the pool.
+func (p *Pool) Remove(addr string) bool {
+	p.mu.Lock()
+	var removed *PoolConn
+	for i, pc := range p.servers {
+		if pc.Addr == addr {
+			removed = pc
+			p.servers = append(p.servers[:i:i], p.servers[i+1:]...)
+			break
+		}
+	}
+	p.mu.Unlock()
+	if removed == nil {
+		return false
+	}
+	removed.close()
+	p.emit(PoolEvent{Type: PoolEventRemoved, Addr: addr})
+	return true
+}
+
+// Get returns the connection to one of the servers alive picked by the balancer for the key,
+// which is only used by key-aware balancers such as ConsistentHash.
+func (p *Pool) Get(key string) (*Conn, error) {
+	alive := p.alive()
+	if len(alive) == 0 {
+		return nil, ErrNoAliveConn
+	}
+	return p.balancer.Pick(alive, key).conn(), nil
+}
+
 // GetBest returns the connection with the lowest latency that is currently alive.
 func (p *Pool) GetBest() *Conn {
+	alive := p.alive()
+	if len(alive) == 0 {
+		return nil
+	}
+	return LeastLatency().Pick(alive, "").conn()
+}
+
+// alive returns the servers currently alive.
+func (p *Pool) alive() []*PoolConn {
 	p.mu.RLock()
 	defer p.mu.RUnlock()
-	var best *PoolConn
+	var alive []*PoolConn
 	for _, pc := range p.servers {
 		pc.mu.RLock()
-		isActive := pc.IsAlive
-		latency := pc.Latency
-		pc.mu.RUnlock()
-		if !isActive {
-			continue
+		if pc.IsAlive {
+			alive = append(alive, pc)
 		}
-		if best == nil || latency < best.Latency {
-			best = pc
-		}
-	}
-	if best == nil {
-		return nil
+		pc.mu.RUnlock()
 	}
-	return best.Conn
+	return alive
 }
 
-// HealthCheck performs a health check on all connections in the pool.
+// HealthCheck pings the servers alive, a server failing too many pings in a row is down.
+// The servers down are redialed once their backoff delay has elapsed.
+// The pings go over a dedicated connection to every server, so the connections returned by Get
+// may be in use during the health check. Those connections get a MsgTypeHeartbeat message instead,
+// which a Router ignores and keeps their sessions alive, and their server is down at once if it fails,
+// e.g. because the connection has been closed, so that it is redialed.
 func (p *Pool) HealthCheck(timeout time.Duration) {
 	p.mu.RLock()
 	servers := make([]*PoolConn, len(p.servers))
@@ -88,33 +277,169 @@ func (p *Pool) HealthCheck(timeout time.Duration) {
 		wg.Add(1)
 		go func(pc *PoolConn) {
 			defer wg.Done()
-			latency, err := pc.Conn.Ping(timeout)
-			pc.mu.Lock()
-			if err != nil {
-				pc.FailCnt++
-				if pc.FailCnt >= 3 {
-					pc.IsAlive = false
-				}
-			} else {
-				pc.FailCnt = 0
-				pc.Latency = latency
-				pc.IsAlive = true
-				pc.LastPing = time.Now()
+			pc.mu.RLock()
+			alive, nextDial := pc.IsAlive, pc.nextDial
+			pc.mu.RUnlock()
+			if alive {
+				p.ping(pc, timeout)
+			} else if !time.Now().Before(nextDial) {
+				p.redial(pc, timeout)
 			}
-			pc.mu.Unlock()
 		}(pc)
 	}
 	wg.Wait()
 }
 
-// Close closes all connections in the pool.
+func (p *Pool) ping(pc *PoolConn, timeout time.Duration) {
+	if conn := pc.conn(); conn != nil {
+		if err := conn.SendMsgWithTimeout(MsgTypeHeartbeat, nil, timeout); err != nil {
+			p.down(pc, err)
+			return
+		}
+	}
+
+	var latency time.Duration
+	health, err := p.healthConn(pc)
+	if err == nil {
+		if latency, err = health.Ping(timeout); err != nil {
+			// A late pong mustn't be read by the next ping, it gets a new connection.
+			p.dropHealthConn(pc, health)
+		}
+	}
+	pc.mu.Lock()
+	if err != nil {
+		pc.FailCnt++
+		fails := pc.FailCnt
+		pc.mu.Unlock()
+		if fails >= _poolMaxFails {
+			p.down(pc, err)
+		}
+		return
+	}
+	pc.FailCnt = 0
+	pc.observe(latency)
+	pc.mu.Unlock()
+}
+
+// down marks the server down because of err, unless it is already.
+func (p *Pool) down(pc *PoolConn, err error) {
+	pc.mu.Lock()
+	if !pc.IsAlive {
+		pc.mu.Unlock()
+		return
+	}
+	pc.IsAlive = false
+	pc.backoff = p.minBackoff
+	pc.nextDial = time.Now().Add(pc.backoff)
+	pc.mu.Unlock()
+	p.emit(PoolEvent{Type: PoolEventDown, Addr: pc.Addr, Err: err})
+}
+
+// healthConn returns the health check connection to the server, dialing it if there is none.
+func (p *Pool) healthConn(pc *PoolConn) (*Conn, error) {
+	pc.mu.RLock()
+	health := pc.health
+	pc.mu.RUnlock()
+	if health != nil {
+		return health, nil
+	}
+	health, err := Dial(pc.Addr, p.cfg)
+	if err != nil {
+		return nil, err
+	}
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	if pc.health != nil {
+		// A concurrent health check dialed it first.
+		health.Close()
+		return pc.health, nil
+	}
+	pc.health = health
+	return health, nil
+}
+
+// dropHealthConn closes the health check connection to the server, unless it has been replaced.
+func (p *Pool) dropHealthConn(pc *PoolConn, health *Conn) {
+	pc.mu.Lock()
+	if pc.health == health {
+		pc.health = nil
+	}
+	pc.mu.Unlock()
+	health.Close()
+}
+
+// redial replaces the connection to a server down once a ping succeeds on the new one,
+// which isn't in use yet.
+func (p *Pool) redial(pc *PoolConn, timeout time.Duration) {
+	conn, err := Dial(pc.Addr, p.cfg)
+	var latency time.Duration
+	if err == nil {
+		if latency, err = conn.Ping(timeout); err != nil {
+			conn.Close()
+		}
+	}
+
+	pc.mu.Lock()
+	if err != nil {
+		pc.backoff = min(pc.backoff*2, p.maxBackoff)
+		pc.nextDial = time.Now().Add(pc.backoff)
+		pc.mu.Unlock()
+		p.emit(PoolEvent{Type: PoolEventRedialFailed, Addr: pc.Addr, Err: err})
+		return
+	}
+	old := pc.Conn
+	pc.Conn = conn
+	pc.IsAlive = true
+	pc.FailCnt = 0
+	pc.backoff = 0
+	pc.observe(latency)
+	pc.mu.Unlock()
+	if old != nil {
+		old.Close()
+	}
+	p.emit(PoolEvent{Type: PoolEventUp, Addr: pc.Addr})
+}
+
+// observe records the latency of a successful ping, it must be called with mu held.
+func (pc *PoolConn) observe(latency time.Duration) {
+	pc.Latency = latency
+	pc.LastPing = time.Now()
+	if pc.ewma == 0 {
+		pc.ewma = float64(latency)
+	} else {
+		pc.ewma += _ewmaAlpha * (float64(latency) - pc.ewma)
+	}
+}
+
+func (p *Pool) healthLoop() {
+	defer p.wg.Done()
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+			p.HealthCheck(p.timeout)
+		}
+	}
+}
+
+func (p *Pool) emit(event PoolEvent) {
+	if p.onEvent != nil {
+		p.onEvent(event)
+	}
+}
+
+// Close stops the background health checks and closes all connections in the pool.
 func (p *Pool) Close() {
-	p.mu.RLock()
-	defer p.mu.RUnlock()
+	p.closeOnce.Do(func() { close(p.stop) })
+	p.wg.Wait()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
 	for _, pc := range p.servers {
-		if pc.Conn != nil {
-			pc.Conn.Close()
-		}
+		pc.close()
 	}
 	p.servers = nil
 }
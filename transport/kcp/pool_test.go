@@ -0,0 +1,196 @@
+package kcp
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBalancer(t *testing.T) {
+	conns := []*PoolConn{
+		{Addr: "a", Latency: 30 * time.Millisecond, ewma: float64(30 * time.Millisecond), weight: 3},
+		{Addr: "b", Latency: 10 * time.Millisecond, ewma: float64(10 * time.Millisecond), weight: 1},
+		{Addr: "c", Latency: 20 * time.Millisecond, ewma: float64(90 * time.Millisecond), weight: 1},
+	}
+	pick := func(b Balancer, key string) string {
+		return b.Pick(conns, key).Addr
+	}
+
+	t.Run("least latency", func(t *testing.T) {
+		require.Equal(t, "b", pick(LeastLatency(), ""))
+	})
+
+	t.Run("round robin", func(t *testing.T) {
+		b := RoundRobin()
+		var picks string
+		for i := 0; i < 10; i++ {
+			picks += pick(b, "")
+		}
+		require.Equal(t, "abacaabaca", picks)
+	})
+
+	t.Run("p2c", func(t *testing.T) {
+		b := P2C()
+		counts := make(map[string]int)
+		for i := 0; i < 300; i++ {
+			counts[pick(b, "")]++
+		}
+		// The slowest connection always loses, the others are picked in turn.
+		require.Zero(t, counts["c"])
+		require.Greater(t, counts["a"], 0)
+		require.Greater(t, counts["b"], counts["a"])
+	})
+
+	t.Run("consistent hash", func(t *testing.T) {
+		b := ConsistentHash()
+		owners := make(map[string]string)
+		for i := 0; i < 100; i++ {
+			key := fmt.Sprint("key-", i)
+			owners[key] = pick(b, key)
+			require.Equal(t, owners[key], pick(b, key))
+		}
+
+		// Only the keys of the missing connection move.
+		alive := []*PoolConn{conns[0], conns[2]}
+		for key, owner := range owners {
+			got := b.Pick(alive, key).Addr
+			if owner != "b" {
+				require.Equal(t, owner, got)
+			} else {
+				require.NotEqual(t, "b", got)
+			}
+		}
+	})
+}
+
+func TestPool(t *testing.T) {
+	listen := func(addr string) *Server {
+		s := NewServer(nil)
+		require.NoError(t, s.Listen(addr))
+		go func() { _ = s.Serve(NewRouter()) }()
+		return s
+	}
+	stop := func(s *Server) {
+		ctx, cancel := context.WithTimeout(context.Background(), testStopTimeout)
+		defer cancel()
+		_ = s.Stop(ctx)
+	}
+	first, second := listen("127.0.0.1:0"), listen("127.0.0.1:0")
+	defer stop(second)
+	addr := first.Addr().String()
+
+	events := make(chan PoolEvent, 16)
+	pool := NewPool(nil,
+		WithBalancer(RoundRobin()),
+		WithHealthCheck(50*time.Millisecond, 50*time.Millisecond),
+		WithBackoff(20*time.Millisecond, 100*time.Millisecond),
+		WithPoolEventHandler(func(event PoolEvent) { events <- event }),
+	)
+	defer pool.Close()
+	require.NoError(t, pool.Add(addr))
+	require.NoError(t, pool.AddWeighted(second.Addr().String(), 2))
+	next := func() PoolEvent {
+		select {
+		case event := <-events:
+			return event
+		case <-time.After(3 * time.Second):
+			t.Fatal("no pool event")
+		}
+		return PoolEvent{}
+	}
+	require.Equal(t, PoolEventAdded, next().Type)
+	require.Equal(t, PoolEventAdded, next().Type)
+
+	conn, err := pool.Get("")
+	require.NoError(t, err)
+	require.NotNil(t, conn)
+
+	// A server failing the health checks goes down, then it is redialed once back.
+	stop(first)
+	event := next()
+	require.Equal(t, PoolEventDown, event.Type)
+	require.Equal(t, addr, event.Addr)
+	require.Len(t, pool.alive(), 1)
+
+	first = listen(addr)
+	defer stop(first)
+	for event = next(); event.Type == PoolEventRedialFailed; event = next() {
+		require.Error(t, event.Err)
+	}
+	require.Equal(t, PoolEventUp, event.Type)
+	require.Len(t, pool.alive(), 2)
+
+	require.True(t, pool.Remove(addr))
+	require.False(t, pool.Remove(addr))
+	require.Equal(t, PoolEvent{Type: PoolEventRemoved, Addr: addr}, next())
+	require.Len(t, pool.alive(), 1)
+
+	pool.Remove(second.Addr().String())
+	_, err = pool.Get("")
+	require.ErrorIs(t, err, ErrNoAliveConn)
+}
+
+func TestPool_HealthCheckDuringTraffic(t *testing.T) {
+	router := NewRouter()
+	router.Handle(MsgTypeData, func(msg *Message) error {
+		return msg.Reply(MsgTypeData, msg.Payload)
+	})
+	s := startServer(t, nil, router)
+
+	events := make(chan PoolEvent, 16)
+	pool := NewPool(nil,
+		WithHealthCheck(2*time.Millisecond, 100*time.Millisecond),
+		WithPoolEventHandler(func(event PoolEvent) { events <- event }),
+	)
+	defer pool.Close()
+	require.NoError(t, pool.Add(s.Addr().String()))
+	conn, err := pool.Get("")
+	require.NoError(t, err)
+
+	// The health checks neither read the replies nor the pongs mix with them.
+	for deadline, i := time.Now().Add(300*time.Millisecond), 0; time.Now().Before(deadline); i++ {
+		payload := []byte(fmt.Sprint(i))
+		require.NoError(t, conn.SendMsg(MsgTypeData, payload))
+		msgType, reply, err := conn.RecvMsgWithTimeout(time.Second)
+		require.NoError(t, err)
+		require.Equal(t, MsgTypeData, msgType)
+		require.Equal(t, payload, reply)
+	}
+	require.Equal(t, PoolEventAdded, (<-events).Type)
+	require.Empty(t, events)
+	require.Len(t, pool.alive(), 1)
+}
+
+func TestPool_ClosedConn(t *testing.T) {
+	s := startServer(t, nil, NewRouter())
+	events := make(chan PoolEvent, 16)
+	pool := NewPool(nil,
+		WithHealthCheck(20*time.Millisecond, 100*time.Millisecond),
+		WithBackoff(20*time.Millisecond, 100*time.Millisecond),
+		WithPoolEventHandler(func(event PoolEvent) { events <- event }),
+	)
+	defer pool.Close()
+	require.NoError(t, pool.Add(s.Addr().String()))
+	require.Equal(t, PoolEventAdded, (<-events).Type)
+
+	// The connection returned by Get is probed too, once closed its server is redialed.
+	conn, err := pool.Get("")
+	require.NoError(t, err)
+	require.NoError(t, conn.Close())
+	for _, want := range []PoolEventType{PoolEventDown, PoolEventUp} {
+		select {
+		case event := <-events:
+			require.Equal(t, want, event.Type)
+		case <-time.After(3 * time.Second):
+			t.Fatal("no pool event")
+		}
+	}
+	redialed, err := pool.Get("")
+	require.NoError(t, err)
+	require.NotSame(t, conn, redialed)
+	_, err = redialed.Ping(time.Second)
+	require.NoError(t, err)
+}
@@ -0,0 +1,108 @@
+package kcp
+
+import "errors"
+
+// QueueFullPolicy tells what to do with a message pushed to a session whose send queue is full.
+type QueueFullPolicy int
+
+const (
+	// QueueFullDrop drops the message.
+	QueueFullDrop QueueFullPolicy = iota
+	// QueueFullDisconnect drops the message and closes the session, for clients which can't miss one.
+	QueueFullDisconnect
+)
+
+var (
+	ErrSessionNotFound = errors.New("session not found")
+	ErrSessionClosed   = errors.New("session is closed")
+	ErrQueueFull       = errors.New("send queue is full")
+)
+
+type pushedMsg struct {
+	msgType uint32
+	payload []byte
+}
+
+// SendTo queues a message to the session with the given ID, it returns ErrQueueFull if the session
+// can't keep up, in which case it is also closed with QueueFullDisconnect.
+// The payload may be shared between sessions and mustn't be modified afterward.
+func (s *Server) SendTo(sessionID string, msgType uint32, payload []byte) error {
+	session := s.GetSession(sessionID)
+	if session == nil {
+		return ErrSessionNotFound
+	}
+	return s.push(session, msgType, payload)
+}
+
+// Broadcast queues a message to every session, it returns the number of sessions it was queued to.
+func (s *Server) Broadcast(msgType uint32, payload []byte) int {
+	var n int
+	for _, session := range s.sessions.snapshot() {
+		if s.push(session, msgType, payload) == nil {
+			n++
+		}
+	}
+	return n
+}
+
+// Join adds the session with the given ID to the group, the session leaves its groups once closed.
+func (s *Server) Join(sessionID, group string) error {
+	return s.sessions.Join(sessionID, group)
+}
+
+// Leave removes the session with the given ID from the group.
+func (s *Server) Leave(sessionID, group string) {
+	s.sessions.Leave(sessionID, group)
+}
+
+// GroupSize returns the number of sessions in the group.
+func (s *Server) GroupSize(group string) int {
+	return s.sessions.GroupSize(group)
+}
+
+// SendGroup queues a message to every session of the group, it returns the number of sessions
+// it was queued to.
+func (s *Server) SendGroup(group string, msgType uint32, payload []byte) int {
+	var n int
+	for _, session := range s.sessions.members(group) {
+		if s.push(session, msgType, payload) == nil {
+			n++
+		}
+	}
+	return n
+}
+
+// push queues a message to the session, applying the send queue policy if it is full.
+func (s *Server) push(session *Session, msgType uint32, payload []byte) error {
+	select {
+	case <-session.done:
+		return ErrSessionClosed
+	default:
+	}
+	select {
+	case session.outbox <- pushedMsg{msgType: msgType, payload: payload}:
+		return nil
+	default:
+	}
+	if s.cfg.SendQueuePolicy == QueueFullDisconnect {
+		session.close(CloseReasonQueueFull)
+	}
+	return ErrQueueFull
+}
+
+// writeLoop writes the messages pushed to the session until its handler returns.
+func (s *Server) writeLoop(session *Session) {
+	for {
+		select {
+		case msg := <-session.outbox:
+			if err := session.Conn.SendMsg(msg.msgType, msg.payload); err != nil {
+				session.close(CloseReasonSendError)
+				return
+			}
+		case <-session.done:
+			return
+		case <-session.Context().Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package kcp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer_Push(t *testing.T) {
+	hello := make(chan [2]string, 2) // client name and session ID
+	srv := startServer(t, nil, HandlerFunc(func(conn *Conn, session *Session) error {
+		_, payload, err := conn.RecvMsg()
+		if err != nil {
+			return err
+		}
+		hello <- [2]string{string(payload), session.ID()}
+		for {
+			if _, _, err := conn.RecvMsg(); err != nil {
+				return err
+			}
+		}
+	}))
+
+	clients := make(map[string]*Conn)
+	ids := make(map[string]string)
+	for _, name := range []string{"alice", "bob"} {
+		conn, err := Dial(srv.Addr().String(), nil)
+		require.NoError(t, err)
+		defer conn.Close()
+		require.NoError(t, conn.SendMsg(MsgTypeData, []byte(name)))
+		h := <-hello
+		clients[h[0]], ids[h[0]] = conn, h[1]
+	}
+	recv := func(name string) string {
+		msgType, payload, err := clients[name].RecvMsgWithTimeout(time.Second)
+		require.NoError(t, err)
+		require.Equal(t, MsgTypeData, msgType)
+		return string(payload)
+	}
+
+	require.Equal(t, 2, srv.Broadcast(MsgTypeData, []byte("all")))
+	require.Equal(t, "all", recv("alice"))
+	require.Equal(t, "all", recv("bob"))
+
+	require.NoError(t, srv.SendTo(ids["bob"], MsgTypeData, []byte("to bob")))
+	require.ErrorIs(t, srv.SendTo("unknown", MsgTypeData, nil), ErrSessionNotFound)
+	require.Equal(t, "to bob", recv("bob"))
+
+	require.NoError(t, srv.Join(ids["alice"], "room"))
+	require.ErrorIs(t, srv.Join("unknown", "room"), ErrSessionNotFound)
+	require.Equal(t, 1, srv.SendGroup("room", MsgTypeData, []byte("room")))
+	require.Equal(t, "room", recv("alice"))
+	require.Zero(t, srv.SendGroup("other", MsgTypeData, nil))
+
+	// A closed session leaves its groups.
+	require.NoError(t, srv.Join(ids["bob"], "room"))
+	require.Equal(t, 2, srv.GroupSize("room"))
+	srv.GetSession(ids["alice"]).close(CloseReasonHandlerDone)
+	require.Eventually(t, func() bool {
+		return srv.GroupSize("room") == 1
+	}, time.Second, 10*time.Millisecond)
+	srv.Leave(ids["bob"], "room")
+	require.Zero(t, srv.GroupSize("room"))
+}
+
+func TestServer_pushQueueFull(t *testing.T) {
+	for _, policy := range []QueueFullPolicy{QueueFullDrop, QueueFullDisconnect} {
+		cfg := DefaultConfig()
+		cfg.SendQueuePolicy = policy
+		srv := NewServer(cfg)
+
+		// Nobody writes the queue, nor listens on the other side.
+		conn, err := Dial("127.0.0.1:1", nil)
+		require.NoError(t, err)
+		session := &Session{Conn: conn, outbox: make(chan pushedMsg, 1), done: make(chan struct{})}
+
+		require.NoError(t, srv.push(session, MsgTypeData, nil))
+		require.ErrorIs(t, srv.push(session, MsgTypeData, nil), ErrQueueFull)
+		if policy == QueueFullDisconnect {
+			require.Equal(t, CloseReasonQueueFull, session.reason(nil))
+		} else {
+			require.Equal(t, CloseReasonHandlerDone, session.reason(nil))
+			_ = conn.Close()
+		}
+
+		close(session.done)
+		require.ErrorIs(t, srv.push(session, MsgTypeData, nil), ErrSessionClosed)
+	}
+}
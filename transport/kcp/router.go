@@ -0,0 +1,148 @@
+package kcp
+
+import (
+	"strings"
+	"sync"
+)
+
+// Message is a message received on a connection served by a Router.
+type Message struct {
+	Type    uint32
+	Payload []byte
+	Conn    *Conn
+	Session *Session
+}
+
+// Reply sends a message of the given type on the connection the message was received from.
+func (m *Message) Reply(msgType uint32, payload []byte) error {
+	return m.Conn.SendMsg(msgType, payload)
+}
+
+// MsgHandlerFunc handles the messages of a type, returning an error closes the connection.
+type MsgHandlerFunc func(msg *Message) error
+
+// Middleware wraps a MsgHandlerFunc with cross-cutting behavior.
+type Middleware func(next MsgHandlerFunc) MsgHandlerFunc
+
+// Router is a Handler reading the messages of a connection in order and dispatching them
+// to the handler of their type through the middleware chain.
+// MsgTypePing is answered with MsgTypePong and MsgTypeHeartbeat is ignored as the server records the
+// heartbeat of every frame, unless other handlers are registered for them.
+// Resuming sessions is opt-in, by registering HandleResume for MsgTypeResume.
+type Router struct {
+	mu          sync.RWMutex
+	handlers    map[uint32]MsgHandlerFunc
+	middlewares []Middleware
+	notFound    MsgHandlerFunc
+
+	// chains holds the handlers wrapped by the middlewares, rebuilt whenever they change.
+	chains        map[uint32]MsgHandlerFunc
+	notFoundChain MsgHandlerFunc
+}
+
+// NewRouter returns a Router with the built-in ping and heartbeat handlers.
+func NewRouter() *Router {
+	r := &Router{handlers: make(map[uint32]MsgHandlerFunc)}
+	r.handlers[MsgTypePing] = handlePing
+	r.handlers[MsgTypeHeartbeat] = handleHeartbeat
+	r.notFound = handleNotFound
+	r.rebuild()
+	return r
+}
+
+// Handle registers the handler of the message type, replacing the previous one.
+func (r *Router) Handle(msgType uint32, handler MsgHandlerFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.handlers[msgType] = handler
+	r.chains[msgType] = r.wrap(handler)
+}
+
+// NotFound sets the handler of the message types without handler, by default they are ignored.
+func (r *Router) NotFound(handler MsgHandlerFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.notFound = handler
+	r.notFoundChain = r.wrap(handler)
+}
+
+// Use appends middlewares to the chain, the first one added is the outermost.
+func (r *Router) Use(middlewares ...Middleware) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.middlewares = append(r.middlewares, middlewares...)
+	r.rebuild()
+}
+
+// HandleConn implements Handler.
+func (r *Router) HandleConn(conn *Conn, session *Session) error {
+	return r.serve(conn, session, nil)
+}
+
+// serve dispatches the messages of the connection, wrapping their handlers with outer if not nil.
+func (r *Router) serve(conn *Conn, session *Session, outer Middleware) error {
+	for {
+		msgType, payload, err := conn.RecvMsg()
+		if err != nil {
+			return err
+		}
+		msg := &Message{Type: msgType, Payload: payload, Conn: conn, Session: session}
+		h := r.handler(msgType)
+		if outer != nil {
+			h = outer(h)
+		}
+		if err := h(msg); err != nil {
+			return err
+		}
+	}
+}
+
+// handler returns the handler of the message type wrapped by the middlewares.
+func (r *Router) handler(msgType uint32) MsgHandlerFunc {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if h, ok := r.chains[msgType]; ok {
+		return h
+	}
+	return r.notFoundChain
+}
+
+// rebuild wraps every handler with the middlewares, it must be called with mu held.
+func (r *Router) rebuild() {
+	r.chains = make(map[uint32]MsgHandlerFunc, len(r.handlers))
+	for msgType, h := range r.handlers {
+		r.chains[msgType] = r.wrap(h)
+	}
+	r.notFoundChain = r.wrap(r.notFound)
+}
+
+// wrap returns the handler wrapped by the middlewares, it must be called with mu held.
+func (r *Router) wrap(h MsgHandlerFunc) MsgHandlerFunc {
+	for i := len(r.middlewares) - 1; i >= 0; i-- {
+		h = r.middlewares[i](h)
+	}
+	return h
+}
+
+func handlePing(msg *Message) error {
+	return msg.Reply(MsgTypePong, nil)
+}
+
+func handleHeartbeat(*Message) error {
+	return nil
+}
+
+// HandleResume is the MsgTypeResume handler resuming the session whose ID and resume token are
+// the payload, separated by a colon. It replies with the ID and the resume token of the session,
+// which is a new one if it couldn't be resumed, in the same format. An empty payload just asks for them.
+// With Auth, the connection has to authenticate as the identity of the session before resuming it.
+func HandleResume(msg *Message) error {
+	if id, token, ok := strings.Cut(string(msg.Payload), ":"); ok {
+		_ = msg.Session.Resume(id, token)
+	}
+	return msg.Reply(MsgTypeResume, []byte(msg.Session.ID()+":"+msg.Session.ResumeToken()))
+}
+
+func handleNotFound(*Message) error {
+	return nil
+}
@@ -0,0 +1,132 @@
+package kcp
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRouter(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		observed []uint32
+		panics   int
+		sessions = make(chan *Session, 8)
+	)
+	router := NewRouter()
+	router.Use(
+		Metrics(func(msgType uint32, _ time.Duration, _ error) {
+			mu.Lock()
+			observed = append(observed, msgType)
+			mu.Unlock()
+		}),
+		Recovery(func(*Message, error) {
+			mu.Lock()
+			panics++
+			mu.Unlock()
+		}),
+		Auth(func(msg *Message) (any, error) {
+			if string(msg.Payload) != "token" {
+				return nil, errors.New("bad token")
+			}
+			return "alice", nil
+		}),
+	)
+	router.Handle(MsgTypeData, func(msg *Message) error {
+		sessions <- msg.Session
+		if string(msg.Payload) == "panic" {
+			panic("boom")
+		}
+		return msg.Reply(MsgTypeAck, msg.Payload)
+	})
+
+	// Late packets of a closed client open a new session on the listener, the heartbeat timeout reaps it.
+	cfg := DefaultConfig()
+	cfg.HeartbeatTimeout = 500 * time.Millisecond
+	srv := startServer(t, cfg, router)
+	addr := srv.Addr().String()
+
+	// Pings are answered before authentication, other messages are refused.
+	conn, err := Dial(addr, nil)
+	require.NoError(t, err)
+	_, err = conn.Ping(time.Second)
+	require.NoError(t, err)
+	require.NoError(t, conn.SendMsg(MsgTypeData, []byte("hello")))
+	msgType, payload, err := conn.RecvMsgWithTimeout(time.Second)
+	require.NoError(t, err)
+	require.Equal(t, MsgTypeError, msgType)
+	require.Equal(t, ErrUnauthenticated.Error(), string(payload))
+	_ = conn.Close()
+
+	conn, err = Dial(addr, nil)
+	require.NoError(t, err)
+	defer conn.Close()
+	require.NoError(t, conn.SendMsg(MsgTypeAuth, []byte("token")))
+	msgType, _, err = conn.RecvMsgWithTimeout(time.Second)
+	require.NoError(t, err)
+	require.Equal(t, MsgTypeAuth, msgType)
+
+	require.NoError(t, conn.SendMsg(MsgTypeHeartbeat, nil))
+	require.NoError(t, conn.SendMsg(MsgTypeData, []byte("hello")))
+	msgType, payload, err = conn.RecvMsgWithTimeout(time.Second)
+	require.NoError(t, err)
+	require.Equal(t, MsgTypeAck, msgType)
+	require.Equal(t, "hello", string(payload))
+
+	session := <-sessions
+	identity, ok := session.Identity()
+	require.True(t, ok)
+	require.Equal(t, "alice", identity)
+	lastHeartbeat, lastActivity := session.Heartbeat()
+	require.WithinDuration(t, time.Now(), lastHeartbeat, time.Second)
+	require.False(t, lastActivity.Before(lastHeartbeat))
+
+	// A panic is recovered and closes the connection.
+	require.NoError(t, conn.SendMsg(MsgTypeData, []byte("panic")))
+	<-sessions
+	require.Eventually(t, func() bool {
+		return srv.SessionCount() == 0
+	}, 2*time.Second, 10*time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Equal(t, 1, panics)
+	require.Equal(t, []uint32{
+		MsgTypePing, MsgTypeData,
+		MsgTypeAuth, MsgTypeHeartbeat, MsgTypeData, MsgTypeData,
+	}, observed)
+}
+
+func TestRouter_Chain(t *testing.T) {
+	var wrapped, calls []string
+	trace := func(name string) Middleware {
+		return func(next MsgHandlerFunc) MsgHandlerFunc {
+			wrapped = append(wrapped, name)
+			return func(msg *Message) error {
+				calls = append(calls, name)
+				return next(msg)
+			}
+		}
+	}
+	router := NewRouter()
+	router.Use(trace("outer"), trace("inner"))
+	router.Handle(MsgTypeData, func(*Message) error {
+		calls = append(calls, "data")
+		return nil
+	})
+
+	// The chains are built when the router changes, not for every message.
+	wrapped = nil
+	for i := 0; i < 3; i++ {
+		require.NoError(t, router.handler(MsgTypeData)(&Message{Type: MsgTypeData}))
+	}
+	require.Empty(t, wrapped)
+	require.Equal(t, []string{"outer", "inner", "data", "outer", "inner", "data", "outer", "inner", "data"}, calls)
+
+	calls = nil
+	require.NoError(t, router.handler(MsgTypeRequest)(&Message{Type: MsgTypeRequest}))
+	require.Equal(t, []string{"outer", "inner"}, calls)
+}
@@ -0,0 +1,148 @@
+// Package rpc implements request/response calls over the message framing of transport/kcp.
+// Every request carries an ID echoed by its response, so a Client runs many calls concurrently
+// on a single connection, and a Router dispatches them to the handler of their method.
+package rpc
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go-pkg/encoding"
+	"go-pkg/transport/kcp"
+)
+
+// Client calls the methods of a Router over a kcp.Conn.
+type Client struct {
+	conn  *kcp.Conn
+	codec encoding.Codec
+	opts  options
+	seq   atomic.Uint64
+
+	mu      sync.Mutex
+	pending map[uint64]chan response
+	err     error // set once the client is closed
+	done    chan struct{}
+}
+
+// NewClient returns a Client owning conn, nothing else may read from conn.
+func NewClient(conn *kcp.Conn, opts ...Option) (*Client, error) {
+	o, codec, err := newOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	c := &Client{
+		conn:    conn,
+		codec:   codec,
+		opts:    o,
+		pending: make(map[uint64]chan response),
+		done:    make(chan struct{}),
+	}
+	go c.recvLoop()
+	return c, nil
+}
+
+// Call calls the method with req and decodes the result into resp, which may be nil to ignore it.
+// The deadline of ctx is sent to the server, a call failed by the server returns an *Error.
+func (c *Client) Call(ctx context.Context, method string, req, resp any) error {
+	if len(method) > maxMethodLen {
+		return ErrMethodTooLong
+	}
+	body, err := c.codec.Marshal(req)
+	if err != nil {
+		return err
+	}
+	var timeout time.Duration
+	if deadline, ok := ctx.Deadline(); ok {
+		if timeout = time.Until(deadline); timeout <= 0 {
+			return context.DeadlineExceeded
+		}
+	}
+
+	id := c.seq.Add(1)
+	ch := make(chan response, 1)
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return c.err
+	}
+	c.pending[id] = ch
+	c.mu.Unlock()
+	defer c.forget(id)
+
+	if err := c.conn.SendMsg(kcp.MsgTypeRequest, encodeRequest(id, timeout, method, body)); err != nil {
+		return err
+	}
+	select {
+	case res := <-ch:
+		if res.code != CodeOK {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			return &Error{Code: res.code, Message: string(res.body)}
+		}
+		if resp == nil || len(res.body) == 0 {
+			return nil
+		}
+		return c.codec.Unmarshal(res.body, resp)
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-c.done:
+		return c.err
+	}
+}
+
+// Close closes the client and its connection, pending calls fail with ErrClientClosed.
+func (c *Client) Close() error {
+	if c.shutdown(ErrClientClosed) {
+		return c.conn.Close()
+	}
+	return nil
+}
+
+func (c *Client) forget(id uint64) {
+	c.mu.Lock()
+	delete(c.pending, id)
+	c.mu.Unlock()
+}
+
+// shutdown fails the pending calls with err, it reports whether the client was still open.
+func (c *Client) shutdown(err error) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return false
+	}
+	c.err = err
+	close(c.done)
+	return true
+}
+
+func (c *Client) recvLoop() {
+	for {
+		msgType, payload, err := c.conn.RecvMsgWithTimeout(0)
+		if err != nil {
+			if c.shutdown(err) {
+				_ = c.conn.Close()
+			}
+			return
+		}
+		if msgType != kcp.MsgTypeResponse {
+			continue
+		}
+		res, err := decodeResponse(payload)
+		if err != nil {
+			c.opts.handleError(err)
+			continue
+		}
+
+		c.mu.Lock()
+		ch, ok := c.pending[res.id]
+		delete(c.pending, res.id)
+		c.mu.Unlock()
+		if ok {
+			ch <- res
+		}
+	}
+}
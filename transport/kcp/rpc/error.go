@@ -0,0 +1,61 @@
+package rpc
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrClientClosed  = errors.New("rpc client is closed")
+	ErrInvalidFrame  = errors.New("invalid rpc frame")
+	ErrUnknownCodec  = errors.New("unknown rpc codec")
+	ErrMethodTooLong = errors.New("rpc method name too long")
+)
+
+// Code tells how a call failed.
+type Code uint8
+
+const (
+	CodeOK            Code = iota
+	CodeApplication        // the handler returned an error
+	CodeUnknownMethod      // no handler is registered for the method
+	CodeBadRequest         // the request could not be decoded
+	CodeInternal           // the handler panicked or the response could not be encoded
+	CodeOverloaded         // the connection already has the maximum number of calls in progress
+)
+
+// String returns the name of the code.
+func (c Code) String() string {
+	switch c {
+	case CodeOK:
+		return "ok"
+	case CodeApplication:
+		return "application error"
+	case CodeUnknownMethod:
+		return "unknown method"
+	case CodeBadRequest:
+		return "bad request"
+	case CodeInternal:
+		return "internal error"
+	case CodeOverloaded:
+		return "overloaded"
+	}
+	return fmt.Sprintf("code %d", uint8(c))
+}
+
+// Error is the error of a call returned by the server.
+type Error struct {
+	Code    Code
+	Message string
+}
+
+// Error implements the error interface.
+func (e *Error) Error() string {
+	return fmt.Sprintf("rpc: %s: %s", e.Code, e.Message)
+}
+
+// Is reports whether target is an *Error with the same code, so that errors.Is can match on the code only.
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code && (t.Message == "" || t.Message == e.Message)
+}
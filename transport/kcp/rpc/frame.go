@@ -0,0 +1,90 @@
+package rpc
+
+import (
+	"encoding/binary"
+	"math"
+	"time"
+)
+
+const (
+	// request header: [id: 8 bytes][timeout in milliseconds: 4 bytes][method length: 2 bytes][method]
+	requestHeaderSize = 14
+	// response header: [id: 8 bytes][code: 1 byte]
+	responseHeaderSize = 9
+
+	maxMethodLen = 1<<16 - 1
+)
+
+type request struct {
+	id      uint64
+	timeout time.Duration
+	method  string
+	body    []byte
+}
+
+func encodeRequest(id uint64, timeout time.Duration, method string, body []byte) []byte {
+	buf := make([]byte, requestHeaderSize+len(method)+len(body))
+	binary.BigEndian.PutUint64(buf[0:8], id)
+	binary.BigEndian.PutUint32(buf[8:12], encodeTimeout(timeout))
+	binary.BigEndian.PutUint16(buf[12:14], uint16(len(method)))
+	copy(buf[requestHeaderSize:], method)
+	copy(buf[requestHeaderSize+len(method):], body)
+	return buf
+}
+
+// encodeTimeout returns the timeout in milliseconds, rounded up so that the server never gives up before
+// the caller, and clamped to the largest one the frame holds (about 49 days) instead of wrapping around.
+func encodeTimeout(timeout time.Duration) uint32 {
+	if timeout <= 0 {
+		return 0
+	}
+	ms := timeout / time.Millisecond
+	if timeout%time.Millisecond != 0 {
+		ms++
+	}
+	if ms > math.MaxUint32 {
+		return math.MaxUint32
+	}
+	return uint32(ms)
+}
+
+func decodeRequest(buf []byte) (request, error) {
+	if len(buf) < requestHeaderSize {
+		return request{}, ErrInvalidFrame
+	}
+	methodLen := int(binary.BigEndian.Uint16(buf[12:14]))
+	if len(buf) < requestHeaderSize+methodLen {
+		return request{}, ErrInvalidFrame
+	}
+	return request{
+		id:      binary.BigEndian.Uint64(buf[0:8]),
+		timeout: time.Duration(binary.BigEndian.Uint32(buf[8:12])) * time.Millisecond,
+		method:  string(buf[requestHeaderSize : requestHeaderSize+methodLen]),
+		body:    buf[requestHeaderSize+methodLen:],
+	}, nil
+}
+
+type response struct {
+	id   uint64
+	code Code
+	body []byte
+}
+
+func encodeResponse(id uint64, code Code, body []byte) []byte {
+	buf := make([]byte, responseHeaderSize+len(body))
+	binary.BigEndian.PutUint64(buf[0:8], id)
+	buf[8] = byte(code)
+	copy(buf[responseHeaderSize:], body)
+	return buf
+}
+
+func decodeResponse(buf []byte) (response, error) {
+	if len(buf) < responseHeaderSize {
+		return response{}, ErrInvalidFrame
+	}
+	return response{
+		id:   binary.BigEndian.Uint64(buf[0:8]),
+		code: Code(buf[8]),
+		body: buf[responseHeaderSize:],
+	}, nil
+}
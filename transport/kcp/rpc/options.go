@@ -0,0 +1,68 @@
+package rpc
+
+import (
+	"go-pkg/encoding"
+	// the default codec
+	_ "go-pkg/encoding/json"
+)
+
+const (
+	// DefaultCodec is the name of the codec used unless WithCodec is given.
+	DefaultCodec = "json"
+	// DefaultMaxConcurrency is the number of calls a Router serves concurrently per connection
+	// unless WithMaxConcurrency is given.
+	DefaultMaxConcurrency = 256
+)
+
+type options struct {
+	codec          string
+	errorHandler   func(err error)
+	maxConcurrency int
+}
+
+// Option configures a Client or a Router.
+type Option func(opts *options)
+
+// WithCodec sets the name of the encoding.Codec of the payloads, e.g. "json" or "proto".
+// The codec package must be imported to register it, client and server must use the same codec.
+func WithCodec(name string) Option {
+	return func(opts *options) {
+		opts.codec = name
+	}
+}
+
+// WithErrorHandler sets the handler receiving the errors that can't be returned to a caller,
+// e.g. a response that could not be sent or a panic recovered from a method handler.
+func WithErrorHandler(handler func(err error)) Option {
+	return func(opts *options) {
+		opts.errorHandler = handler
+	}
+}
+
+// WithMaxConcurrency sets the number of calls a Router serves concurrently per connection,
+// extra calls fail right away with CodeOverloaded. It is ignored if n <= 0 and by Clients.
+func WithMaxConcurrency(n int) Option {
+	return func(opts *options) {
+		if n > 0 {
+			opts.maxConcurrency = n
+		}
+	}
+}
+
+func newOptions(opts []Option) (options, encoding.Codec, error) {
+	o := options{codec: DefaultCodec, maxConcurrency: DefaultMaxConcurrency}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	codec := encoding.GetCodec(o.codec)
+	if codec == nil {
+		return o, nil, ErrUnknownCodec
+	}
+	return o, codec, nil
+}
+
+func (o *options) handleError(err error) {
+	if o.errorHandler != nil {
+		o.errorHandler(err)
+	}
+}
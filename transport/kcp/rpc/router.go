@@ -0,0 +1,157 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"go-pkg/encoding"
+	"go-pkg/rec"
+	"go-pkg/transport/kcp"
+)
+
+// HandlerFunc handles the calls of a method, decode decodes the request into v.
+// The returned value is encoded as the response, a returned error is sent to the caller as an *Error.
+type HandlerFunc func(ctx context.Context, decode func(v any) error) (any, error)
+
+// Router dispatches the calls received on kcp connections to the handler of their method,
+// it implements kcp.Handler.
+type Router struct {
+	codec encoding.Codec
+	opts  options
+
+	mu       sync.RWMutex
+	handlers map[string]HandlerFunc
+}
+
+// NewRouter returns an empty Router.
+func NewRouter(opts ...Option) (*Router, error) {
+	o, codec, err := newOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	return &Router{
+		codec:    codec,
+		opts:     o,
+		handlers: make(map[string]HandlerFunc),
+	}, nil
+}
+
+// Handle registers the handler of the method, replacing the previous one.
+func (r *Router) Handle(method string, handler HandlerFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.handlers[method] = handler
+}
+
+// Register registers a typed handler of the method on the router.
+func Register[Req, Resp any](r *Router, method string, fn func(ctx context.Context, req *Req) (*Resp, error)) {
+	r.Handle(method, func(ctx context.Context, decode func(v any) error) (any, error) {
+		req := new(Req)
+		if err := decode(req); err != nil {
+			return nil, err
+		}
+		resp, err := fn(ctx, req)
+		if err != nil || resp == nil {
+			return nil, err
+		}
+		return resp, nil
+	})
+}
+
+// HandleConn implements kcp.Handler, it serves the calls of the connection concurrently until it is closed,
+// up to the limit set by WithMaxConcurrency. Pings are answered with pongs.
+func (r *Router) HandleConn(conn *kcp.Conn, _ *kcp.Session) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	defer cancel()
+	sem := make(chan struct{}, r.opts.maxConcurrency)
+
+	for {
+		msgType, payload, err := conn.RecvMsgWithTimeout(0)
+		if err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrClosedPipe) {
+				return nil
+			}
+			return err
+		}
+		switch msgType {
+		case kcp.MsgTypePing:
+			if err := conn.SendMsg(kcp.MsgTypePong, nil); err != nil {
+				return err
+			}
+		case kcp.MsgTypeRequest:
+			req, err := decodeRequest(payload)
+			if err != nil {
+				r.opts.handleError(err)
+				continue
+			}
+			select {
+			case sem <- struct{}{}:
+			default:
+				// Rejecting the call keeps reading, so the pings and heartbeats of the connection go on.
+				if err := conn.SendMsg(kcp.MsgTypeResponse, encodeResponse(req.id, CodeOverloaded, nil)); err != nil {
+					return err
+				}
+				continue
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer func() { <-sem }()
+				r.serve(ctx, conn, req)
+			}()
+		}
+	}
+}
+
+func (r *Router) serve(ctx context.Context, conn *kcp.Conn, req request) {
+	code, body := r.call(ctx, req)
+	if err := conn.SendMsg(kcp.MsgTypeResponse, encodeResponse(req.id, code, body)); err != nil {
+		r.opts.handleError(fmt.Errorf("failed to send response of %s: %w", req.method, err))
+	}
+}
+
+// call runs the handler of the request and returns the code and body of the response.
+func (r *Router) call(ctx context.Context, req request) (code Code, body []byte) {
+	r.mu.RLock()
+	handler, ok := r.handlers[req.method]
+	r.mu.RUnlock()
+	if !ok {
+		return CodeUnknownMethod, []byte(req.method)
+	}
+	if req.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, req.timeout)
+		defer cancel()
+	}
+
+	defer rec.RecoverWith(func(err error) {
+		r.opts.handleError(err)
+		code, body = CodeInternal, []byte("panic in handler")
+	})
+	var badRequest bool
+	resp, err := handler(ctx, func(v any) error {
+		if err := r.codec.Unmarshal(req.body, v); err != nil {
+			badRequest = true
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		if badRequest {
+			return CodeBadRequest, []byte(err.Error())
+		}
+		return CodeApplication, []byte(err.Error())
+	}
+	if resp == nil {
+		return CodeOK, nil
+	}
+	if body, err = r.codec.Marshal(resp); err != nil {
+		return CodeInternal, []byte(err.Error())
+	}
+	return CodeOK, body
+}
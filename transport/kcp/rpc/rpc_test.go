@@ -0,0 +1,146 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"testing"
+	"time"
+
+	_ "go-pkg/encoding/proto"
+	"go-pkg/transport/kcp"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+type sleepRequest struct {
+	Millis int    `json:"millis"`
+	Echo   string `json:"echo"`
+}
+
+type sleepResponse struct {
+	Echo string `json:"echo"`
+}
+
+// newTestClient serves the router on a kcp server and returns a client connected to it.
+func newTestClient(t *testing.T, router *Router, opts ...Option) *Client {
+	srv := kcp.NewServer(nil)
+	require.NoError(t, srv.Listen("127.0.0.1:0"))
+	go func() { _ = srv.Serve(router) }()
+
+	conn, err := kcp.Dial(srv.Addr().String(), nil)
+	require.NoError(t, err)
+	client, err := NewClient(conn, opts...)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = client.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_ = srv.Stop(ctx)
+	})
+	return client
+}
+
+func TestCall(t *testing.T) {
+	router, err := NewRouter()
+	require.NoError(t, err)
+	Register(router, "sleep", func(ctx context.Context, req *sleepRequest) (*sleepResponse, error) {
+		select {
+		case <-time.After(time.Duration(req.Millis) * time.Millisecond):
+			return &sleepResponse{Echo: req.Echo}, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	})
+	Register(router, "fail", func(ctx context.Context, req *sleepRequest) (*sleepResponse, error) {
+		return nil, errors.New("boom")
+	})
+	Register(router, "panic", func(ctx context.Context, req *sleepRequest) (*sleepResponse, error) {
+		panic("oops")
+	})
+	client := newTestClient(t, router)
+	ctx := context.Background()
+
+	// The calls run concurrently, so the slow one doesn't hold back the others.
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		order []string
+	)
+	for _, c := range []sleepRequest{{Millis: 300, Echo: "slow"}, {Millis: 10, Echo: "fast"}, {Millis: 50, Echo: "medium"}} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var resp sleepResponse
+			require.NoError(t, client.Call(ctx, "sleep", &c, &resp))
+			require.Equal(t, c.Echo, resp.Echo)
+			mu.Lock()
+			order = append(order, resp.Echo)
+			mu.Unlock()
+		}()
+		time.Sleep(5 * time.Millisecond)
+	}
+	wg.Wait()
+	require.Equal(t, []string{"fast", "medium", "slow"}, order)
+
+	err = client.Call(ctx, "fail", &sleepRequest{}, nil)
+	require.ErrorIs(t, err, &Error{Code: CodeApplication})
+	require.EqualError(t, err, "rpc: application error: boom")
+	require.ErrorIs(t, client.Call(ctx, "missing", nil, nil), &Error{Code: CodeUnknownMethod})
+	require.ErrorIs(t, client.Call(ctx, "panic", &sleepRequest{}, nil), &Error{Code: CodeInternal})
+	require.ErrorIs(t, client.Call(ctx, "sleep", "not an object", nil), &Error{Code: CodeBadRequest})
+
+	// The deadline is enforced on both sides.
+	timeout, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, client.Call(timeout, "sleep", &sleepRequest{Millis: 1000}, nil), context.DeadlineExceeded)
+
+	require.NoError(t, client.Close())
+	require.ErrorIs(t, client.Call(ctx, "sleep", &sleepRequest{}, nil), ErrClientClosed)
+}
+
+func TestCall_Proto(t *testing.T) {
+	router, err := NewRouter(WithCodec("proto"))
+	require.NoError(t, err)
+	Register(router, "upper", func(ctx context.Context, req *wrapperspb.StringValue) (*wrapperspb.StringValue, error) {
+		return wrapperspb.String(req.GetValue() + "!"), nil
+	})
+	client := newTestClient(t, router, WithCodec("proto"))
+
+	resp := new(wrapperspb.StringValue)
+	require.NoError(t, client.Call(context.Background(), "upper", wrapperspb.String("hi"), resp))
+	require.Equal(t, "hi!", resp.GetValue())
+
+	_, err = NewRouter(WithCodec("xml"))
+	require.ErrorIs(t, err, ErrUnknownCodec)
+}
+
+func TestCall_MaxConcurrency(t *testing.T) {
+	router, err := NewRouter(WithMaxConcurrency(1))
+	require.NoError(t, err)
+	started, block := make(chan struct{}), make(chan struct{})
+	Register(router, "block", func(ctx context.Context, req *sleepRequest) (*sleepResponse, error) {
+		close(started)
+		<-block
+		return &sleepResponse{}, nil
+	})
+	client := newTestClient(t, router)
+	ctx := context.Background()
+
+	done := make(chan error, 1)
+	go func() { done <- client.Call(ctx, "block", &sleepRequest{}, nil) }()
+	<-started
+	require.ErrorIs(t, client.Call(ctx, "block", &sleepRequest{}, nil), &Error{Code: CodeOverloaded})
+	close(block)
+	require.NoError(t, <-done)
+}
+
+func TestEncodeTimeout(t *testing.T) {
+	require.Zero(t, encodeTimeout(0))
+	require.EqualValues(t, 1, encodeTimeout(time.Microsecond))
+	require.EqualValues(t, 20, encodeTimeout(20*time.Millisecond))
+	require.EqualValues(t, uint32(math.MaxUint32), encodeTimeout(60*24*time.Hour))
+	require.EqualValues(t, uint32(math.MaxUint32), encodeTimeout(time.Duration(math.MaxInt64)))
+}
@@ -3,6 +3,7 @@ package kcp
 import (
 	"context"
 	"fmt"
+	"net"
 	"sync"
 	"time"
 
@@ -10,15 +11,20 @@ import (
 )
 
 // Server represents a KCP server that manages incoming connections and sessions.
+// Its sessions are only reaped once Config.HeartbeatTimeout or Config.IdleTimeout is set, both are disabled by default.
 type Server struct {
-	listener  *kcp.Listener
-	cfg       *Config
-	handler   Handler
-	sessions  map[string]*Session
-	sessionMu sync.RWMutex
+	listener *kcp.Listener
+	cfg      *Config
+	handler  Handler
+	sessions *SessionManager
+	stats    *serverStats
 
+	stopMu   sync.Mutex // orders wg.Add in Serve before wg.Wait in Stop
 	stopChan chan struct{}
 	wg       sync.WaitGroup
+
+	onSessionOpen  func(session *Session)
+	onSessionClose func(session *Session, reason CloseReason, err error)
 }
 
 // Handler defines the interface for handling KCP connections.
@@ -41,14 +47,19 @@ func NewServer(cfg *Config) *Server {
 	}
 	return &Server{
 		cfg:      cfg,
-		sessions: make(map[string]*Session),
+		sessions: NewSessionManager(),
+		stats:    newServerStats(),
 		stopChan: make(chan struct{}),
 	}
 }
 
 // Listen starts listening for incoming KCP connections on the specified address.
 func (s *Server) Listen(addr string) error {
-	listener, err := kcp.ListenWithOptions(addr, nil, 10, 3)
+	block, err := s.cfg.blockCrypt()
+	if err != nil {
+		return err
+	}
+	listener, err := kcp.ListenWithOptions(addr, block, s.cfg.DataShards, s.cfg.ParityShards)
 	if err != nil {
 		return fmt.Errorf("failed liston on %s: %w", addr, err)
 	}
@@ -56,11 +67,21 @@ func (s *Server) Listen(addr string) error {
 	return nil
 }
 
+// Addr returns the address the server listens on, nil before Listen.
+func (s *Server) Addr() net.Addr {
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Addr()
+}
+
 func (s *Server) Serve(handler Handler) error {
 	s.handler = handler
 
-	s.wg.Add(1)
-	go s.heartbeat()
+	if !s.track() {
+		return nil
+	}
+	go s.reaper()
 
 	for {
 		select {
@@ -77,11 +98,39 @@ func (s *Server) Serve(handler Handler) error {
 				continue
 			}
 		}
-		s.wg.Add(1)
+		if !s.track() {
+			conn.Close()
+			return nil
+		}
 		go s.handleConn(conn)
 	}
 }
 
+// track adds a goroutine to wait for on Stop, it returns false if the server is stopped.
+func (s *Server) track() bool {
+	s.stopMu.Lock()
+	defer s.stopMu.Unlock()
+	select {
+	case <-s.stopChan:
+		return false
+	default:
+		s.wg.Add(1)
+		return true
+	}
+}
+
+// OnSessionOpen sets the hook called for every new session, before its handler runs.
+// It must be set before Serve.
+func (s *Server) OnSessionOpen(fn func(session *Session)) {
+	s.onSessionOpen = fn
+}
+
+// OnSessionClose sets the hook called once a session is closed, with the reason and the error
+// returned by its handler. It must be set before Serve.
+func (s *Server) OnSessionClose(fn func(session *Session, reason CloseReason, err error)) {
+	s.onSessionClose = fn
+}
+
 // ServeFunc is a convenience method to serve using a function as the handler.
 func (s *Server) ServeFunc(fn func(conn *Conn, session *Session) error) error {
 	return s.Serve(HandlerFunc(fn))
@@ -95,56 +144,87 @@ func (s *Server) handleConn(kcpConn *kcp.UDPSession) {
 		cfg:  s.cfg,
 	}
 	conn.applyConfig()
-	defer conn.Close()
 
+	ctx, cancel := context.WithCancel(context.Background())
 	session := &Session{
 		LastActivity:  time.Now(),
 		LastHeartbeat: time.Now(),
 		Conn:          conn,
 		IsAlive:       true,
-		ID:            kcpConn.RemoteAddr().String(),
+		id:            newSessionID(),
+		resumeToken:   newSessionID(),
+		outbox:        make(chan pushedMsg, s.sendQueueSize()),
+		done:          make(chan struct{}),
+		writerDone:    make(chan struct{}),
+		ctx:           ctx,
+		cancel:        cancel,
 	}
-	s.addSession(session)
-	defer s.removeSession(session.ID)
-	if s.handler != nil {
-		if err := s.handler.HandleConn(conn, session); err != nil {
-			// Handle error (log, etc.)
+	// Every frame received proves the peer is alive.
+	conn.onRecv = func(msgType uint32, frame bool) {
+		session.received(frame && isKeepAlive(msgType))
+		if frame {
+			s.stats.received(msgType)
 		}
 	}
+	conn.onSend = s.stats.sent
+	s.sessions.Add(session)
+	s.stats.opened.Add(1)
+	go func() {
+		defer close(session.writerDone)
+		s.writeLoop(session)
+	}()
+	if s.onSessionOpen != nil {
+		s.onSessionOpen(session)
+	}
+
+	var err error
+	if s.handler != nil {
+		err = s.handler.HandleConn(conn, session)
+	}
+	reason := session.reason(err)
+	session.close(reason)
+	close(session.done)
+	<-session.writerDone
+	s.stats.closeSession(s.sessions, session, reason)
+	if s.onSessionClose != nil {
+		s.onSessionClose(session, reason, err)
+	}
 }
 
-// addSession adds a new session to the server's session map.
-func (s *Server) addSession(session *Session) {
-	s.sessionMu.Lock()
-	defer s.sessionMu.Unlock()
-	s.sessions[session.ID] = session
+// sendQueueSize returns the size of the send queue of the sessions.
+func (s *Server) sendQueueSize() int {
+	if s.cfg.SendQueueSize <= 0 {
+		return _defaultSendQueueSize
+	}
+	return s.cfg.SendQueueSize
 }
 
-// removeSession removes a session by its ID.
-func (s *Server) removeSession(sessionID string) {
-	s.sessionMu.Lock()
-	defer s.sessionMu.Unlock()
-	delete(s.sessions, sessionID)
+// Sessions returns the manager of the open sessions.
+func (s *Server) Sessions() *SessionManager {
+	return s.sessions
 }
 
 // GetSession retrieves a session by its ID.
 func (s *Server) GetSession(sessionID string) *Session {
-	s.sessionMu.RLock()
-	defer s.sessionMu.RUnlock()
-	return s.sessions[sessionID]
+	return s.sessions.Get(sessionID)
 }
 
 // SessionCount returns the current number of active sessions.
 func (s *Server) SessionCount() int {
-	s.sessionMu.RLock()
-	defer s.sessionMu.RUnlock()
-	return len(s.sessions)
+	return s.sessions.Len()
 }
 
-// heartbeat periodically checks sessions for heartbeats and removes inactive ones.
-func (s *Server) heartbeat() {
+// reaper periodically closes the sessions which missed their heartbeat or have been idle for too long.
+func (s *Server) reaper() {
 	defer s.wg.Done()
-	ticker := time.NewTicker(s.cfg.HeartbeatTimeout / 2)
+	interval := s.cfg.HeartbeatTimeout
+	if interval <= 0 || (s.cfg.IdleTimeout > 0 && s.cfg.IdleTimeout < interval) {
+		interval = s.cfg.IdleTimeout
+	}
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval / 2)
 	defer ticker.Stop()
 
 	for {
@@ -152,43 +232,34 @@ func (s *Server) heartbeat() {
 		case <-s.stopChan:
 			return
 		case <-ticker.C:
-			s.checkHeartbeats()
+			s.sessions.reap(s.cfg.HeartbeatTimeout, s.cfg.IdleTimeout)
 		}
 	}
 }
 
-// checkHeartbeats checks all sessions for heartbeat timeouts and marks inactive sessions.
-func (s *Server) checkHeartbeats() {
-	now := time.Now()
-	timeout := s.cfg.HeartbeatTimeout
-
-	s.sessionMu.Lock()
-	var timeoutSessions []string
-	for id, session := range s.sessions {
-		session.mu.RLock()
-		if session.IsAlive && now.Sub(session.LastHeartbeat) > timeout {
-			timeoutSessions = append(timeoutSessions, id)
-		}
-		session.mu.RUnlock()
-	}
-	s.sessionMu.Unlock()
-	for _, id := range timeoutSessions {
-		s.sessionMu.Lock()
-		if session, exists := s.sessions[id]; exists {
-			session.mu.Lock()
-			session.IsAlive = false
-			session.mu.Unlock()
-		}
-		s.sessionMu.Unlock()
-	}
-}
-
-// Stop gracefully stops the server, closing all connections and waiting for ongoing operations to finish.
+// Stop stops accepting connections and sends a MsgTypeGoodbye message to every session, then waits for
+// their handlers to return. Once ctx is done, the remaining sessions are closed and ctx.Err() is returned.
 func (s *Server) Stop(ctx context.Context) error {
-	close(s.stopChan)
+	s.stopMu.Lock()
+	select {
+	case <-s.stopChan:
+	default:
+		close(s.stopChan)
+	}
+	s.stopMu.Unlock()
 
+	// Closing the listener would close its sessions too, only unblock Serve until they are drained.
 	if s.listener != nil {
-		s.listener.Close()
+		_ = s.listener.SetReadDeadline(time.Now())
+		defer s.listener.Close()
+	}
+	// The goodbyes go through the send queues, so a stalled peer can't hold Stop past ctx.
+	// A session whose queue is full gets none.
+	for _, session := range s.sessions.snapshot() {
+		select {
+		case session.outbox <- pushedMsg{msgType: MsgTypeGoodbye}:
+		default:
+		}
 	}
 
 	done := make(chan struct{})
@@ -199,6 +270,9 @@ func (s *Server) Stop(ctx context.Context) error {
 
 	select {
 	case <-ctx.Done():
+		for _, session := range s.sessions.snapshot() {
+			session.close(CloseReasonServerStop)
+		}
 		return ctx.Err()
 	case <-done:
 		return nil
@@ -0,0 +1,243 @@
+package kcp
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type closedSession struct {
+	session *Session
+	reason  CloseReason
+	err     error
+}
+
+// testStopTimeout bounds the graceful stop of the test servers, whose handlers may ignore the goodbye.
+const testStopTimeout = 100 * time.Millisecond
+
+// startServer starts a server serving handler on a local port until the end of the test,
+// setup is called before it serves, e.g. to set the session hooks.
+func startServer(t *testing.T, cfg *Config, handler Handler, setup ...func(s *Server)) *Server {
+	s := NewServer(cfg)
+	for _, fn := range setup {
+		fn(s)
+	}
+	require.NoError(t, s.Listen("127.0.0.1:0"))
+	go func() { _ = s.Serve(handler) }()
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), testStopTimeout)
+		defer cancel()
+		_ = s.Stop(ctx)
+	})
+	return s
+}
+
+func startHookServer(t *testing.T, cfg *Config, handler HandlerFunc) (*Server, chan *Session, chan closedSession) {
+	opened := make(chan *Session, 4)
+	closed := make(chan closedSession, 4)
+	s := startServer(t, cfg, handler, func(s *Server) {
+		s.OnSessionOpen(func(session *Session) { opened <- session })
+		s.OnSessionClose(func(session *Session, reason CloseReason, err error) {
+			closed <- closedSession{session, reason, err}
+		})
+	})
+	return s, opened, closed
+}
+
+func TestServer_HeartbeatTimeout(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.HeartbeatTimeout = 200 * time.Millisecond
+	srv, opened, closed := startHookServer(t, cfg, func(conn *Conn, session *Session) error {
+		for {
+			if _, _, err := conn.RecvMsg(); err != nil {
+				return err
+			}
+		}
+	})
+
+	conn, err := Dial(srv.Addr().String(), nil)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// Any frame keeps the session alive.
+	require.NoError(t, conn.SendMsg(MsgTypeData, []byte("hello")))
+	session := <-opened
+	for i := 0; i < 5; i++ {
+		time.Sleep(80 * time.Millisecond)
+		require.NoError(t, conn.SendMsg(MsgTypeData, nil))
+	}
+	require.Equal(t, 1, srv.SessionCount())
+
+	select {
+	case c := <-closed:
+		require.Same(t, session, c.session)
+		require.Equal(t, CloseReasonHeartbeatTimeout, c.reason)
+		require.False(t, session.IsAlive)
+	case <-time.After(2 * time.Second):
+		t.Fatal("session not closed")
+	}
+	require.Zero(t, srv.SessionCount())
+}
+
+func TestServer_HeartbeatInterval(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.HeartbeatTimeout = 200 * time.Millisecond
+	srv, opened, closed := startHookServer(t, cfg, NewRouter().HandleConn)
+
+	clientCfg := DefaultConfig()
+	clientCfg.HeartbeatInterval = 50 * time.Millisecond
+	conn, err := Dial(srv.Addr().String(), clientCfg)
+	require.NoError(t, err)
+	require.NoError(t, conn.SendMsg(MsgTypeData, nil))
+	<-opened
+
+	// The heartbeats keep the idle session alive until the client is closed.
+	time.Sleep(600 * time.Millisecond)
+	require.Equal(t, 1, srv.SessionCount())
+	require.NoError(t, conn.Close())
+	select {
+	case c := <-closed:
+		require.Equal(t, CloseReasonHeartbeatTimeout, c.reason)
+	case <-time.After(2 * time.Second):
+		t.Fatal("session not closed")
+	}
+}
+
+func TestServer_MaxMsgSize(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.MaxMsgSize = 1024
+	srv, _, closed := startHookServer(t, cfg, func(conn *Conn, session *Session) error {
+		for {
+			if _, _, err := conn.RecvMsg(); err != nil {
+				return err
+			}
+		}
+	})
+
+	conn, err := Dial(srv.Addr().String(), nil)
+	require.NoError(t, err)
+	defer conn.Close()
+	require.NoError(t, conn.SendMsg(MsgTypeData, make([]byte, 1024)))
+	require.NoError(t, conn.SendMsg(MsgTypeData, make([]byte, 1025)))
+	select {
+	case c := <-closed:
+		require.ErrorIs(t, c.err, ErrMsgTooLarge)
+	case <-time.After(2 * time.Second):
+		t.Fatal("session not closed")
+	}
+}
+
+func TestServer_SessionHooks(t *testing.T) {
+	srv, opened, closed := startHookServer(t, nil, func(conn *Conn, session *Session) error {
+		_, _, err := conn.RecvMsg()
+		return err
+	})
+
+	conn, err := Dial(srv.Addr().String(), nil)
+	require.NoError(t, err)
+	defer conn.Close()
+	require.NoError(t, conn.SendMsg(MsgTypeData, nil))
+
+	session := <-opened
+	c := <-closed
+	require.Same(t, session, c.session)
+	require.Equal(t, CloseReasonHandlerDone, c.reason)
+	require.NoError(t, c.err)
+	require.Nil(t, srv.GetSession(session.ID()))
+}
+
+func TestServer_Stop(t *testing.T) {
+	t.Run("graceful", func(t *testing.T) {
+		srv, opened, closed := startHookServer(t, nil, func(conn *Conn, session *Session) error {
+			for {
+				msgType, _, err := conn.RecvMsg()
+				if err != nil {
+					return err
+				}
+				if msgType == MsgTypeGoodbye {
+					return nil
+				}
+			}
+		})
+
+		conn, err := Dial(srv.Addr().String(), nil)
+		require.NoError(t, err)
+		defer conn.Close()
+		require.NoError(t, conn.SendMsg(MsgTypeData, nil))
+		<-opened
+
+		// The client echoes the goodbye so the handler returns before the deadline.
+		go func() {
+			if msgType, _, err := conn.RecvMsg(); err == nil && msgType == MsgTypeGoodbye {
+				_ = conn.SendMsg(MsgTypeGoodbye, nil)
+			}
+		}()
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		require.NoError(t, srv.Stop(ctx))
+		require.Equal(t, CloseReasonHandlerDone, (<-closed).reason)
+	})
+
+	t.Run("deadline", func(t *testing.T) {
+		srv, opened, closed := startHookServer(t, nil, func(conn *Conn, session *Session) error {
+			for {
+				if _, _, err := conn.RecvMsg(); err != nil {
+					return err
+				}
+			}
+		})
+
+		conn, err := Dial(srv.Addr().String(), nil)
+		require.NoError(t, err)
+		defer conn.Close()
+		require.NoError(t, conn.SendMsg(MsgTypeData, nil))
+		<-opened
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		require.ErrorIs(t, srv.Stop(ctx), context.DeadlineExceeded)
+
+		msgType, _, err := conn.RecvMsgWithTimeout(time.Second)
+		require.NoError(t, err)
+		require.Equal(t, MsgTypeGoodbye, msgType)
+
+		select {
+		case c := <-closed:
+			require.Equal(t, CloseReasonServerStop, c.reason)
+		case <-time.After(2 * time.Second):
+			t.Fatal("session not closed")
+		}
+	})
+	t.Run("stalled peer", func(t *testing.T) {
+		srv, opened, _ := startHookServer(t, nil, func(conn *Conn, session *Session) error {
+			for {
+				if _, _, err := conn.RecvMsg(); err != nil {
+					return err
+				}
+			}
+		})
+
+		conn, err := Dial(srv.Addr().String(), nil)
+		require.NoError(t, err)
+		require.NoError(t, conn.SendMsg(MsgTypeData, nil))
+		session := <-opened
+
+		// The peer is gone, the messages pushed to it fill the send window until the writes block.
+		require.NoError(t, conn.Close())
+		payload := make([]byte, 64<<10)
+		for i := 0; i < 64; i++ {
+			_ = srv.SendTo(session.ID(), MsgTypeData, payload)
+		}
+		// Give the write loop the time to fill the window.
+		time.Sleep(100 * time.Millisecond)
+		require.NotZero(t, len(session.outbox))
+
+		start := time.Now()
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		require.ErrorIs(t, srv.Stop(ctx), context.DeadlineExceeded)
+		require.Less(t, time.Since(start), time.Second)
+	})
+}
@@ -1,16 +1,467 @@
 package kcp
 
 import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"reflect"
 	"sync"
 	"time"
 )
 
+// ErrIdentityMismatch will be returned when resuming a session authenticated as another identity.
+var ErrIdentityMismatch = errors.New("session is authenticated as another identity")
+
+// CloseReason tells why a session has been closed.
+type CloseReason int
+
+const (
+	CloseReasonHandlerDone      CloseReason = iota // the handler returned without error
+	CloseReasonHandlerError                        // the handler returned an error
+	CloseReasonHeartbeatTimeout                    // no frame was received within Config.HeartbeatTimeout
+	CloseReasonServerStop                          // the server was stopped
+	CloseReasonQueueFull                           // the send queue was full with QueueFullDisconnect
+	CloseReasonSendError                           // writing a pushed message failed
+	CloseReasonIdleTimeout                         // no message but keepalives was received within Config.IdleTimeout
+	CloseReasonResumed                             // another connection resumed the session
+)
+
+// String returns the name of the reason.
+func (r CloseReason) String() string {
+	switch r {
+	case CloseReasonHandlerDone:
+		return "handler done"
+	case CloseReasonHandlerError:
+		return "handler error"
+	case CloseReasonHeartbeatTimeout:
+		return "heartbeat timeout"
+	case CloseReasonServerStop:
+		return "server stop"
+	case CloseReasonQueueFull:
+		return "queue full"
+	case CloseReasonSendError:
+		return "send error"
+	case CloseReasonIdleTimeout:
+		return "idle timeout"
+	case CloseReasonResumed:
+		return "resumed"
+	}
+	return fmt.Sprintf("reason %d", int(r))
+}
+
+// Session is a connection served by a Server, with its state.
 type Session struct {
-	mu            sync.RWMutex
+	mu sync.RWMutex
+	// LastHeartbeat is the time the last frame was received, and LastActivity the time the last one
+	// which isn't a ping, pong or heartbeat was.
 	LastHeartbeat time.Time
 	LastActivity  time.Time
-	Data          interface{}
-	ID            string
 	Conn          *Conn
 	IsAlive       bool
+
+	id            string
+	resumeToken   string
+	authenticated bool
+	identity      any
+	attrs         map[any]any
+	closeReason   *CloseReason // set when the server closes the session
+
+	manager    *SessionManager
+	outbox     chan pushedMsg // messages pushed by the server, written by Server.writeLoop
+	done       chan struct{}  // closed once the handler returned
+	writerDone chan struct{}  // closed once Server.writeLoop returned
+	ctx        context.Context
+	cancel     context.CancelFunc
+}
+
+// NewSession returns an open session of the connection with the given ID, for a SessionManager used
+// without a Server. The connection may be nil if the session only tracks a connection managed elsewhere.
+func NewSession(id string, conn *Conn) *Session {
+	now := time.Now()
+	return &Session{
+		LastActivity:  now,
+		LastHeartbeat: now,
+		Conn:          conn,
+		IsAlive:       true,
+		id:            id,
+	}
+}
+
+// ID returns the random identifier of the session, which the client can resume the session with along
+// with its ResumeToken. It only changes when the session resumes another one.
+func (s *Session) ID() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.id
+}
+
+// Context returns a context cancelled once the session is closed.
+func (s *Session) Context() context.Context {
+	if s.ctx == nil {
+		return context.Background()
+	}
+	return s.ctx
+}
+
+// Touch records activity on the session, heartbeat also refreshes LastHeartbeat.
+func (s *Session) Touch(heartbeat bool) {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.LastActivity = now
+	if heartbeat {
+		s.LastHeartbeat = now
+	}
+}
+
+// received records a frame or read received on the connection.
+func (s *Session) received(keepalive bool) {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.LastHeartbeat = now
+	if !keepalive {
+		s.LastActivity = now
+	}
+}
+
+// Heartbeat returns the time of the last heartbeat and activity of the session.
+func (s *Session) Heartbeat() (lastHeartbeat, lastActivity time.Time) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.LastHeartbeat, s.LastActivity
+}
+
+// Authenticate marks the session as authenticated as the given identity.
+func (s *Session) Authenticate(identity any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.authenticated = true
+	s.identity = identity
+}
+
+// Identity returns the identity the session is authenticated as, ok is false if it isn't authenticated.
+func (s *Session) Identity() (identity any, ok bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.identity, s.authenticated
+}
+
+// ResumeToken returns the secret the client must present along with the ID to resume the session.
+// Unlike the ID, it mustn't be logged or shared with other clients. A session resuming another one
+// keeps its own token.
+func (s *Session) ResumeToken() string {
+	return s.resumeToken
+}
+
+// Resume makes the session take over the session with the given ID, which may still be open on a previous
+// connection of the client, e.g. before its address changed. The session gets the ID, attributes, groups
+// and pending pushed messages of the resumed one, which is closed with CloseReasonResumed.
+// It returns ErrSessionNotFound if there is no such session or token doesn't match its ResumeToken,
+// and ErrIdentityMismatch if the resumed session is authenticated and the session isn't authenticated
+// as the same identity. It must be called from the handler of the session.
+func (s *Session) Resume(id, token string) error {
+	if s.manager == nil {
+		return ErrSessionNotFound
+	}
+	return s.manager.resume(s, id, token)
+}
+
+// canResume returns nil if the session may resume old, the tokens are compared in constant time.
+func (s *Session) canResume(old *Session, token string) error {
+	if old.resumeToken == "" || subtle.ConstantTimeCompare([]byte(old.resumeToken), []byte(token)) != 1 {
+		return ErrSessionNotFound
+	}
+	oldIdentity, ok := old.Identity()
+	if !ok {
+		return nil
+	}
+	if identity, ok := s.Identity(); !ok || !reflect.DeepEqual(identity, oldIdentity) {
+		return ErrIdentityMismatch
+	}
+	return nil
+}
+
+// adopt copies the attributes of the resumed session.
+func (s *Session) adopt(old *Session) {
+	old.mu.RLock()
+	attrs := make(map[any]any, len(old.attrs))
+	for k, v := range old.attrs {
+		attrs[k] = v
+	}
+	old.mu.RUnlock()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for k, v := range s.attrs {
+		if _, ok := attrs[k]; !ok {
+			attrs[k] = v
+		}
+	}
+	s.attrs = attrs
+}
+
+// close closes the connection of the session for the given reason, the first reason wins.
+func (s *Session) close(reason CloseReason) {
+	s.mu.Lock()
+	if s.closeReason == nil {
+		s.closeReason = &reason
+	}
+	s.IsAlive = false
+	s.mu.Unlock()
+	if s.cancel != nil {
+		s.cancel()
+	}
+	if s.Conn != nil {
+		_ = s.Conn.Close()
+	}
+}
+
+// reason returns why the session has been closed, given the error returned by its handler.
+func (s *Session) reason(err error) CloseReason {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	switch {
+	case s.closeReason != nil:
+		return *s.closeReason
+	case err != nil:
+		return CloseReasonHandlerError
+	}
+	return CloseReasonHandlerDone
+}
+
+// Attr is a typed attribute of the sessions, it is the key of its values.
+type Attr[T any] struct {
+	name string
+}
+
+// NewAttr returns a new attribute, the name is only informative.
+func NewAttr[T any](name string) *Attr[T] {
+	return &Attr[T]{name: name}
+}
+
+// Name returns the name of the attribute.
+func (a *Attr[T]) Name() string {
+	return a.name
+}
+
+// Get returns the value of the attribute for the session, ok is false if it isn't set.
+func (a *Attr[T]) Get(s *Session) (v T, ok bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	v, ok = s.attrs[a].(T)
+	return v, ok
+}
+
+// Set sets the value of the attribute for the session.
+func (a *Attr[T]) Set(s *Session, v T) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.attrs == nil {
+		s.attrs = make(map[any]any)
+	}
+	s.attrs[a] = v
+}
+
+// Delete removes the value of the attribute for the session.
+func (a *Attr[T]) Delete(s *Session) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.attrs, a)
+}
+
+// SessionManager holds the open sessions of a Server by ID, and the groups they joined.
+type SessionManager struct {
+	mu       sync.RWMutex
+	sessions map[string]*Session
+	groups   map[string]map[string]bool // session IDs by group
+}
+
+// NewSessionManager returns an empty SessionManager, a Server creates its own.
+func NewSessionManager() *SessionManager {
+	return &SessionManager{
+		sessions: make(map[string]*Session),
+		groups:   make(map[string]map[string]bool),
+	}
+}
+
+// newSessionID returns a random ID, it is also used for the resume tokens, which can't be guessed.
+func newSessionID() string {
+	return rand.Text()
+}
+
+// Get returns the session with the given ID, nil if there is none.
+func (m *SessionManager) Get(id string) *Session {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.sessions[id]
+}
+
+// Len returns the number of open sessions.
+func (m *SessionManager) Len() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.sessions)
+}
+
+// Range calls fn for every open session until it returns false.
+func (m *SessionManager) Range(fn func(session *Session) bool) {
+	for _, session := range m.snapshot() {
+		if !fn(session) {
+			return
+		}
+	}
+}
+
+// Join adds the session with the given ID to the group, the session leaves its groups once closed.
+func (m *SessionManager) Join(id, group string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.sessions[id] == nil {
+		return ErrSessionNotFound
+	}
+	members := m.groups[group]
+	if members == nil {
+		members = make(map[string]bool)
+		m.groups[group] = members
+	}
+	members[id] = true
+	return nil
+}
+
+// Leave removes the session with the given ID from the group.
+func (m *SessionManager) Leave(id, group string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.leaveLocked(id, group)
+}
+
+// GroupSize returns the number of sessions in the group.
+func (m *SessionManager) GroupSize(group string) int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.groups[group])
+}
+
+// Add adds the session, replacing the one with the same ID. The sessions of a Server are added by it.
+func (m *SessionManager) Add(session *Session) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	session.manager = m
+	m.sessions[session.ID()] = session
+}
+
+// Remove removes the session and its group memberships, unless another session resumed it.
+func (m *SessionManager) Remove(session *Session) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	id := session.ID()
+	if m.sessions[id] != session {
+		return
+	}
+	delete(m.sessions, id)
+	for group, members := range m.groups {
+		if members[id] {
+			m.leaveLocked(id, group)
+		}
+	}
+}
+
+func (m *SessionManager) leaveLocked(id, group string) {
+	members := m.groups[group]
+	delete(members, id)
+	if len(members) == 0 {
+		delete(m.groups, group)
+	}
+}
+
+func (m *SessionManager) resume(session *Session, id, token string) error {
+	m.mu.Lock()
+	old := m.sessions[id]
+	if old == session {
+		m.mu.Unlock()
+		return nil
+	}
+	prevID := session.ID()
+	if old == nil || m.sessions[prevID] != session {
+		m.mu.Unlock()
+		return ErrSessionNotFound
+	}
+	if err := session.canResume(old, token); err != nil {
+		m.mu.Unlock()
+		return err
+	}
+	delete(m.sessions, prevID)
+	for _, members := range m.groups {
+		if members[prevID] {
+			delete(members, prevID)
+			members[id] = true
+		}
+	}
+	session.mu.Lock()
+	session.id = id
+	session.mu.Unlock()
+	m.sessions[id] = session
+	m.mu.Unlock()
+
+	session.adopt(old)
+	old.close(CloseReasonResumed)
+	// The handler of the old session may still be running, but its writer stops once it is closed.
+	// Wait for it so that it doesn't take a message while the outbox is drained.
+	if old.writerDone != nil {
+		<-old.writerDone
+	}
+	for {
+		select {
+		case msg := <-old.outbox:
+			select {
+			case session.outbox <- msg:
+			default:
+			}
+			continue
+		default:
+		}
+		return nil
+	}
+}
+
+// members returns the sessions of the group.
+func (m *SessionManager) members(group string) []*Session {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	sessions := make([]*Session, 0, len(m.groups[group]))
+	for id := range m.groups[group] {
+		if session := m.sessions[id]; session != nil {
+			sessions = append(sessions, session)
+		}
+	}
+	return sessions
+}
+
+// snapshot returns the open sessions.
+func (m *SessionManager) snapshot() []*Session {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	sessions := make([]*Session, 0, len(m.sessions))
+	for _, session := range m.sessions {
+		sessions = append(sessions, session)
+	}
+	return sessions
+}
+
+// reap closes the sessions which missed their heartbeat or have been idle for too long,
+// a timeout <= 0 is disabled.
+func (m *SessionManager) reap(heartbeatTimeout, idleTimeout time.Duration) {
+	now := time.Now()
+	for _, session := range m.snapshot() {
+		lastHeartbeat, lastActivity := session.Heartbeat()
+		switch {
+		case heartbeatTimeout > 0 && now.Sub(lastHeartbeat) > heartbeatTimeout:
+			session.close(CloseReasonHeartbeatTimeout)
+		case idleTimeout > 0 && now.Sub(lastActivity) > idleTimeout:
+			session.close(CloseReasonIdleTimeout)
+		}
+	}
 }
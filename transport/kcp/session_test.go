@@ -0,0 +1,203 @@
+package kcp
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAttr(t *testing.T) {
+	user := NewAttr[string]("user")
+	score := NewAttr[int]("score")
+	session := &Session{}
+
+	_, ok := user.Get(session)
+	require.False(t, ok)
+	user.Set(session, "alice")
+	score.Set(session, 42)
+	v, ok := user.Get(session)
+	require.True(t, ok)
+	require.Equal(t, "alice", v)
+	n, ok := score.Get(session)
+	require.True(t, ok)
+	require.Equal(t, 42, n)
+
+	// Attributes are keyed by identity, not by name.
+	_, ok = NewAttr[string]("user").Get(session)
+	require.False(t, ok)
+
+	user.Delete(session)
+	_, ok = user.Get(session)
+	require.False(t, ok)
+	require.Equal(t, "score", score.Name())
+}
+
+func TestSessionManager_reap(t *testing.T) {
+	m := NewSessionManager()
+	open := func(lastHeartbeat, lastActivity time.Duration) *Session {
+		conn, err := Dial("127.0.0.1:1", nil)
+		require.NoError(t, err)
+		now := time.Now()
+		session := &Session{
+			id:            newSessionID(),
+			Conn:          conn,
+			LastHeartbeat: now.Add(-lastHeartbeat),
+			LastActivity:  now.Add(-lastActivity),
+		}
+		m.Add(session)
+		return session
+	}
+	alive := open(0, 0)
+	idle := open(0, time.Minute)
+	dead := open(time.Minute, time.Minute)
+	defer alive.Conn.Close()
+
+	m.reap(10*time.Second, 0)
+	require.Equal(t, CloseReasonHeartbeatTimeout, dead.reason(nil))
+	require.Nil(t, idle.closeReason)
+
+	m.reap(10*time.Second, 30*time.Second)
+	require.Equal(t, CloseReasonIdleTimeout, idle.reason(nil))
+	require.Nil(t, alive.closeReason)
+}
+
+func TestNewSession(t *testing.T) {
+	m := NewSessionManager()
+	session := NewSession("id", nil)
+	m.Add(session)
+	require.Same(t, session, m.Get("id"))
+	require.Equal(t, "id", session.ID())
+
+	// A session without connection can still be reaped.
+	session.LastHeartbeat = time.Now().Add(-time.Minute)
+	m.reap(time.Second, 0)
+	require.Equal(t, CloseReasonHeartbeatTimeout, session.reason(nil))
+	require.False(t, session.IsAlive)
+}
+
+func TestServer_IdleTimeout(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.IdleTimeout = 200 * time.Millisecond
+	srv, opened, closed := startHookServer(t, cfg, NewRouter().HandleConn)
+
+	conn, err := Dial(srv.Addr().String(), nil)
+	require.NoError(t, err)
+	defer conn.Close()
+	require.NoError(t, conn.SendMsg(MsgTypeData, nil))
+	<-opened
+
+	// Heartbeats keep the connection alive, not the session active.
+	for i := 0; i < 5; i++ {
+		if conn.SendMsg(MsgTypeHeartbeat, nil) != nil {
+			break
+		}
+		time.Sleep(80 * time.Millisecond)
+	}
+	select {
+	case c := <-closed:
+		require.Equal(t, CloseReasonIdleTimeout, c.reason)
+	case <-time.After(2 * time.Second):
+		t.Fatal("session not closed")
+	}
+}
+
+func TestServer_Resume(t *testing.T) {
+	user := NewAttr[string]("user")
+	router := NewRouter()
+	router.Use(Auth(func(msg *Message) (any, error) {
+		return string(msg.Payload), nil
+	}))
+	router.Handle(MsgTypeResume, HandleResume)
+	router.Handle(MsgTypeData, func(msg *Message) error {
+		user.Set(msg.Session, string(msg.Payload))
+		return msg.Reply(MsgTypeAck, nil)
+	})
+	srv, _, closed := startHookServer(t, nil, router.HandleConn)
+	addr := srv.Addr().String()
+
+	dial := func(identity string) *Conn {
+		conn, err := Dial(addr, nil)
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = conn.Close() })
+		require.NoError(t, conn.SendMsg(MsgTypeAuth, []byte(identity)))
+		msgType, _, err := conn.RecvMsgWithTimeout(time.Second)
+		require.NoError(t, err)
+		require.Equal(t, MsgTypeAuth, msgType)
+		return conn
+	}
+	resume := func(conn *Conn, id, token string) (string, string) {
+		var payload []byte
+		if id != "" {
+			payload = []byte(id + ":" + token)
+		}
+		require.NoError(t, conn.SendMsg(MsgTypeResume, payload))
+		msgType, payload, err := conn.RecvMsgWithTimeout(time.Second)
+		require.NoError(t, err)
+		require.Equal(t, MsgTypeResume, msgType)
+		id, token, ok := strings.Cut(string(payload), ":")
+		require.True(t, ok)
+		return id, token
+	}
+
+	first := dial("alice")
+	id, token := resume(first, "", "")
+	require.NotEmpty(t, id)
+	require.NotEmpty(t, token)
+	require.NotEqual(t, id, token)
+	require.NoError(t, first.SendMsg(MsgTypeData, []byte("alice")))
+	msgType, _, err := first.RecvMsgWithTimeout(time.Second)
+	require.NoError(t, err)
+	require.Equal(t, MsgTypeAck, msgType)
+	require.NoError(t, srv.Join(id, "room"))
+
+	// The ID alone, or another identity, doesn't take over the session.
+	other := dial("alice")
+	otherID, _ := resume(other, id, "")
+	require.NotEqual(t, id, otherID)
+	otherID, _ = resume(other, id, id)
+	require.NotEqual(t, id, otherID)
+	otherID, _ = resume(dial("mallory"), id, token)
+	require.NotEqual(t, id, otherID)
+
+	// A new connection, from another local port, takes over the session.
+	second := dial("alice")
+	resumedID, resumedToken := resume(second, id, token)
+	require.Equal(t, id, resumedID)
+	require.NotEqual(t, token, resumedToken)
+
+	c := <-closed
+	require.Equal(t, CloseReasonResumed, c.reason)
+	require.Equal(t, 3, srv.SessionCount())
+	session := srv.GetSession(id)
+	require.NotNil(t, session)
+	require.NotSame(t, c.session, session)
+	name, ok := user.Get(session)
+	require.True(t, ok)
+	require.Equal(t, "alice", name)
+	require.Equal(t, 1, srv.GroupSize("room"))
+
+	require.NoError(t, srv.SendTo(id, MsgTypeData, []byte("pushed")))
+	msgType, payload, err := second.RecvMsgWithTimeout(time.Second)
+	require.NoError(t, err)
+	require.Equal(t, MsgTypeData, msgType)
+	require.Equal(t, "pushed", string(payload))
+
+	// The old token is spent, an unknown ID keeps the session.
+	otherID, _ = resume(other, id, token)
+	require.NotEqual(t, id, otherID)
+	unknownID, _ := resume(other, "unknown", token)
+	require.Equal(t, otherID, unknownID)
+}
+
+func TestServer_ResumeOptIn(t *testing.T) {
+	srv, _, _ := startHookServer(t, nil, NewRouter().HandleConn)
+	conn, err := Dial(srv.Addr().String(), nil)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	require.NoError(t, conn.SendMsg(MsgTypeResume, nil))
+	_, _, err = conn.RecvMsgWithTimeout(200 * time.Millisecond)
+	require.Error(t, err)
+}
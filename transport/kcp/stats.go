@@ -0,0 +1,119 @@
+package kcp
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ConnStats is a snapshot of the statistics of a connection.
+// kcp-go only counts the retransmissions, the lost packets and the FEC recoveries for the whole process,
+// they are exported by the collector of go-pkg/prometheus.NewKCPSnmpCollector.
+type ConnStats struct {
+	RTT    time.Duration // round trip of the last Ping, 0 before the first one
+	SRTT   time.Duration // smoothed round trip measured by kcp on the acknowledgements
+	RTTVar time.Duration // variation of the round trip
+	RTO    time.Duration // retransmission timeout
+
+	BytesSent     uint64 // bytes written by the application, without the kcp overhead
+	BytesReceived uint64 // bytes read by the application
+}
+
+// Stats returns the statistics of the connection.
+func (c *Conn) Stats() ConnStats {
+	return ConnStats{
+		RTT:           time.Duration(c.rtt.Load()),
+		SRTT:          time.Duration(c.conn.GetSRTT()) * time.Millisecond,
+		RTTVar:        time.Duration(c.conn.GetSRTTVar()) * time.Millisecond,
+		RTO:           time.Duration(c.conn.GetRTO()) * time.Millisecond,
+		BytesSent:     c.bytesSent.Load(),
+		BytesReceived: c.bytesReceived.Load(),
+	}
+}
+
+// ServerStats is a snapshot of the statistics of a Server.
+type ServerStats struct {
+	Sessions       int                    // open sessions
+	SessionsOpened uint64                 // sessions opened since the start
+	SessionsClosed map[CloseReason]uint64 // sessions closed since the start, by reason
+	MsgsReceived   map[uint32]uint64      // messages received, by type, see MsgTypeOther
+	MsgsSent       map[uint32]uint64      // messages sent, by type, see MsgTypeOther
+	BytesSent      uint64                 // bytes sent on all the sessions, closed ones included
+	BytesReceived  uint64                 // bytes received on all the sessions, closed ones included
+	// SRTT holds the smoothed round trip of every open session.
+	SRTT []time.Duration
+}
+
+// serverStats counts the sessions and messages of a Server.
+type serverStats struct {
+	opened atomic.Uint64
+
+	// mu is held while a closed session moves its bytes to the totals, so they never decrease.
+	mu            sync.Mutex
+	bytesSent     uint64 // of the closed sessions
+	bytesReceived uint64
+	closed        map[CloseReason]uint64
+
+	// The messages by countedMsgType, counted on every frame without lock.
+	msgsReceived [MsgTypeResume + 1]atomic.Uint64
+	msgsSent     [MsgTypeResume + 1]atomic.Uint64
+}
+
+func newServerStats() *serverStats {
+	return &serverStats{
+		closed: make(map[CloseReason]uint64),
+	}
+}
+
+func (s *serverStats) received(msgType uint32) {
+	s.msgsReceived[countedMsgType(msgType)].Add(1)
+}
+
+func (s *serverStats) sent(msgType uint32) {
+	s.msgsSent[countedMsgType(msgType)].Add(1)
+}
+
+// closeSession removes the session from the manager and adds its bytes to the totals.
+func (s *serverStats) closeSession(sessions *SessionManager, session *Session, reason CloseReason) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sessions.Remove(session)
+	s.bytesSent += session.Conn.bytesSent.Load()
+	s.bytesReceived += session.Conn.bytesReceived.Load()
+	s.closed[reason]++
+}
+
+// Stats returns the statistics of the server.
+func (s *Server) Stats() ServerStats {
+	s.stats.mu.Lock()
+	defer s.stats.mu.Unlock()
+	sessions := s.sessions.snapshot()
+	stats := ServerStats{
+		Sessions:       len(sessions),
+		SessionsOpened: s.stats.opened.Load(),
+		SessionsClosed: make(map[CloseReason]uint64, len(s.stats.closed)),
+		MsgsReceived:   make(map[uint32]uint64),
+		MsgsSent:       make(map[uint32]uint64),
+		BytesSent:      s.stats.bytesSent,
+		BytesReceived:  s.stats.bytesReceived,
+		SRTT:           make([]time.Duration, 0, len(sessions)),
+	}
+	for _, session := range sessions {
+		conn := session.Conn
+		stats.BytesSent += conn.bytesSent.Load()
+		stats.BytesReceived += conn.bytesReceived.Load()
+		stats.SRTT = append(stats.SRTT, time.Duration(conn.conn.GetSRTT())*time.Millisecond)
+	}
+	for reason, n := range s.stats.closed {
+		stats.SessionsClosed[reason] = n
+	}
+	for msgType := range s.stats.msgsReceived {
+		if n := s.stats.msgsReceived[msgType].Load(); n > 0 {
+			stats.MsgsReceived[uint32(msgType)] = n
+		}
+		if n := s.stats.msgsSent[msgType].Load(); n > 0 {
+			stats.MsgsSent[uint32(msgType)] = n
+		}
+	}
+	return stats
+}
@@ -0,0 +1,54 @@
+package kcp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStats(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.HeartbeatTimeout = 300 * time.Millisecond
+	s := startServer(t, cfg, NewRouter())
+
+	conn, err := Dial(s.Addr().String(), nil)
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		_, err = conn.Ping(time.Second)
+		require.NoError(t, err)
+	}
+
+	cs := conn.Stats()
+	require.Positive(t, cs.RTT)
+	require.Positive(t, cs.RTO)
+	require.Equal(t, cs.BytesSent, cs.BytesReceived)
+	require.Positive(t, cs.BytesSent)
+
+	ss := s.Stats()
+	require.Equal(t, 1, ss.Sessions)
+	require.EqualValues(t, 1, ss.SessionsOpened)
+	require.Len(t, ss.SRTT, 1)
+	require.EqualValues(t, 3, ss.MsgsReceived[MsgTypePing])
+	require.EqualValues(t, 3, ss.MsgsSent[MsgTypePong])
+	require.Equal(t, cs.BytesSent, ss.BytesReceived)
+	require.Equal(t, cs.BytesReceived, ss.BytesSent)
+
+	// The types the package doesn't define are counted together.
+	require.NoError(t, conn.SendMsg(1000, nil))
+	require.NoError(t, conn.SendMsg(2000, nil))
+	require.Eventually(t, func() bool {
+		return s.Stats().MsgsReceived[MsgTypeOther] == 2
+	}, time.Second, time.Millisecond)
+	require.Len(t, s.Stats().MsgsReceived, 2)
+	cs = conn.Stats()
+
+	// The bytes of a closed session stay in the totals.
+	require.NoError(t, conn.Close())
+	require.Eventually(t, func() bool {
+		return s.Stats().SessionsClosed[CloseReasonHeartbeatTimeout] == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	ss = s.Stats()
+	require.Zero(t, ss.Sessions)
+	require.Equal(t, cs.BytesSent, ss.BytesReceived)
+}
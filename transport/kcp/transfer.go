@@ -0,0 +1,595 @@
+package kcp
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+
+	bsPool "go-pkg/pool/byte_slice"
+)
+
+const (
+	// DefaultChunkSize is the chunk size of NewManifest when none is given.
+	DefaultChunkSize = 256 << 10 // 256KB
+	// MaxChunkSize is the largest chunk size accepted by a TransferServer, the Config.MaxMsgSize of its
+	// Server must be larger.
+	MaxChunkSize = 16 << 20 // 16MB
+
+	transferWindow  = 4 // chunks sent on a stream before waiting for their acknowledgement
+	transferRetries = 3 // times a chunk failing verification is sent again
+	transferConns   = 4 // connections Pool.SendFile opens to the server
+)
+
+// The first byte of the MsgTypeData and MsgTypeAck payloads of a transfer tells what they carry:
+//
+//	manifest: data [kind][manifest JSON]           ack [kind][bitmap of the chunks already stored]
+//	chunk:    data [kind][index 4][chunk]          ack [kind][index 4][status 1]
+//	finish:   data [kind]                          ack [kind][status 1]
+const (
+	transferManifest byte = iota + 1
+	transferChunk
+	transferFinish
+)
+
+const (
+	transferOK byte = iota
+	transferCorrupted
+	transferIncomplete
+)
+
+var (
+	ErrInvalidManifest    = errors.New("invalid transfer manifest")
+	ErrChunkCorrupted     = errors.New("chunk failed SHA-256 verification")
+	ErrTransferIncomplete = errors.New("transfer is incomplete")
+	ErrNoTransferConn     = errors.New("no connection to transfer on")
+	ErrInvalidTransferMsg = errors.New("invalid transfer message")
+)
+
+// Manifest describes a file split in fixed-size chunks, with the SHA-256 of every chunk.
+type Manifest struct {
+	// ID identifies the transfer, it is derived from the other fields so sending the same file again
+	// resumes the previous transfer.
+	ID        string   `json:"id"`
+	Name      string   `json:"name"`
+	Size      int64    `json:"size"`
+	ChunkSize int      `json:"chunk_size"`
+	Chunks    []string `json:"chunks"` // hex SHA-256 of every chunk
+}
+
+// NewManifest reads the file of the given size from r and returns its manifest,
+// a chunkSize <= 0 uses DefaultChunkSize.
+func NewManifest(name string, r io.ReaderAt, size int64, chunkSize int) (*Manifest, error) {
+	if chunkSize <= 0 {
+		chunkSize = DefaultChunkSize
+	}
+	m := &Manifest{Name: name, Size: size, ChunkSize: chunkSize}
+	buf := bsPool.GetLarge(chunkSize)
+	defer bsPool.PutLarge(buf)
+	for i := 0; i < m.NumChunks(); i++ {
+		off, n := m.chunk(i)
+		if _, err := r.ReadAt(buf[:n], off); err != nil {
+			return nil, fmt.Errorf("failed read chunk %d: %w", i, err)
+		}
+		sum := sha256.Sum256(buf[:n])
+		m.Chunks = append(m.Chunks, hex.EncodeToString(sum[:]))
+	}
+	m.ID = m.computeID()
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// NumChunks returns the number of chunks of the file.
+func (m *Manifest) NumChunks() int {
+	return int((m.Size + int64(m.ChunkSize) - 1) / int64(m.ChunkSize))
+}
+
+// Validate checks the manifest is consistent and its name is a plain file name.
+func (m *Manifest) Validate() error {
+	switch {
+	case m.Size < 0, m.ChunkSize <= 0, m.ChunkSize > MaxChunkSize:
+		return fmt.Errorf("%w: size %d, chunk size %d", ErrInvalidManifest, m.Size, m.ChunkSize)
+	case len(m.Chunks) != m.NumChunks():
+		return fmt.Errorf("%w: %d chunks, expected %d", ErrInvalidManifest, len(m.Chunks), m.NumChunks())
+	case m.Name == "" || m.Name == "." || m.Name == ".." || filepath.Base(m.Name) != m.Name:
+		return fmt.Errorf("%w: name %q", ErrInvalidManifest, m.Name)
+	case m.ID != m.computeID():
+		return fmt.Errorf("%w: id %q", ErrInvalidManifest, m.ID)
+	}
+	return nil
+}
+
+// chunk returns the offset and length of the i-th chunk.
+func (m *Manifest) chunk(i int) (off int64, n int) {
+	off = int64(i) * int64(m.ChunkSize)
+	return off, int(min(int64(m.ChunkSize), m.Size-off))
+}
+
+// verify tells whether data is the i-th chunk.
+func (m *Manifest) verify(i int, data []byte) bool {
+	if _, n := m.chunk(i); n != len(data) {
+		return false
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]) == m.Chunks[i]
+}
+
+func (m *Manifest) computeID() string {
+	h := sha256.New()
+	_ = json.NewEncoder(h).Encode(struct {
+		Name      string
+		Size      int64
+		ChunkSize int
+		Chunks    []string
+	}{m.Name, m.Size, m.ChunkSize, m.Chunks})
+	return hex.EncodeToString(h.Sum(nil)[:16])
+}
+
+// SendFile sends the file of the manifest, read from r, in parallel over the given connections, which must
+// be served by the same TransferServer, or TransferServers sharing one TransferStore, as every chunk is
+// stored by a single one of them. The chunks already stored by the receiver,
+// e.g. by a previous call interrupted by a dropped connection, are skipped, and a chunk is sent again on
+// another connection if its connection fails. onProgress, if not nil, is called with the number of bytes
+// stored so far. Once every chunk is sent, the file is checked complete on every connection, so servers
+// not sharing the store fail with ErrTransferIncomplete.
+//
+// The connections mustn't be used by others during the transfer, and should be closed if it fails as they
+// may still hold acknowledgements. They are closed by SendFile if ctx is done before the transfer ends.
+func SendFile(ctx context.Context, conns []*Conn, m *Manifest, r io.ReaderAt, onProgress func(stored int64)) error {
+	if len(conns) == 0 {
+		return ErrNoTransferConn
+	}
+	if err := m.Validate(); err != nil {
+		return err
+	}
+	manifest, err := json.Marshal(m)
+	if err != nil {
+		return fmt.Errorf("failed json marshal: %w", err)
+	}
+
+	t := &transfer{
+		ctx:        ctx,
+		m:          m,
+		r:          r,
+		onProgress: onProgress,
+		work:       make(chan int, m.NumChunks()),
+		done:       make(chan struct{}),
+	}
+	stop := context.AfterFunc(ctx, func() {
+		// Unblock the streams waiting for an acknowledgement, whatever their read deadline.
+		for _, conn := range conns {
+			_ = conn.Close()
+		}
+	})
+	defer stop()
+
+	// Every stream announces the manifest, a chunk is missing unless every stream tells it is stored.
+	var (
+		streams []*Conn
+		errs    []error
+		planned []bool
+	)
+	for _, conn := range conns {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		stored, err := sendManifest(conn, manifest, m.NumChunks())
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if planned == nil {
+			planned = stored
+		} else {
+			for i, ok := range stored {
+				planned[i] = planned[i] && ok
+			}
+		}
+		streams = append(streams, conn)
+	}
+	if len(streams) == 0 {
+		return errors.Join(errs...)
+	}
+	t.plan(planned)
+
+	errs = make([]error, len(streams))
+	var wg sync.WaitGroup
+	for i, conn := range streams {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = t.stream(conn)
+		}()
+	}
+	wg.Wait()
+
+	select {
+	case <-t.done:
+	default:
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return errors.Join(errs...)
+	}
+	// Every stream left checks the file is complete, which fails unless its server shares the store.
+	var finished bool
+	for i, conn := range streams {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if errs[i] == nil {
+			errs[i] = finish(conn)
+			finished = true
+		} else {
+			errs[i] = nil
+		}
+	}
+	if !finished {
+		return ErrNoTransferConn
+	}
+	return errors.Join(errs...)
+}
+
+func sendManifest(conn *Conn, manifest []byte, numChunks int) ([]bool, error) {
+	payload, err := transferRoundTrip(conn, append([]byte{transferManifest}, manifest...), transferManifest)
+	if err != nil {
+		return nil, err
+	}
+	if len(payload) != (numChunks+7)/8 {
+		return nil, ErrInvalidTransferMsg
+	}
+	stored := make([]bool, numChunks)
+	for i := range stored {
+		stored[i] = payload[i/8]&(1<<(i%8)) != 0
+	}
+	return stored, nil
+}
+
+func finish(conn *Conn) error {
+	payload, err := transferRoundTrip(conn, []byte{transferFinish}, transferFinish)
+	if err != nil {
+		return err
+	}
+	switch {
+	case len(payload) != 1:
+		return ErrInvalidTransferMsg
+	case payload[0] == transferIncomplete:
+		return ErrTransferIncomplete
+	}
+	return nil
+}
+
+// transferRoundTrip sends a transfer message and returns the payload of its acknowledgement after the kind.
+func transferRoundTrip(conn *Conn, data []byte, kind byte) ([]byte, error) {
+	if err := conn.SendMsg(MsgTypeData, data); err != nil {
+		return nil, err
+	}
+	return recvTransferAck(conn, kind)
+}
+
+func recvTransferAck(conn *Conn, kind byte) ([]byte, error) {
+	msgType, payload, err := conn.RecvMsg()
+	switch {
+	case err != nil:
+		return nil, err
+	case msgType == MsgTypeError:
+		return nil, fmt.Errorf("transfer refused: %s", payload)
+	case msgType != MsgTypeAck || len(payload) == 0 || payload[0] != kind:
+		return nil, ErrInvalidTransferMsg
+	}
+	return payload[1:], nil
+}
+
+// transfer is the state of a SendFile shared by its streams.
+type transfer struct {
+	ctx        context.Context
+	m          *Manifest
+	r          io.ReaderAt
+	onProgress func(stored int64)
+
+	work      chan int // chunks to send, a chunk is in it at most once
+	remaining atomic.Int64
+	stored    atomic.Int64
+	done      chan struct{} // closed once every chunk is stored
+
+	mu      sync.Mutex
+	retries map[int]int
+}
+
+// plan queues the chunks which aren't stored yet.
+func (t *transfer) plan(stored []bool) {
+	var missing int64
+	for i, ok := range stored {
+		if ok {
+			_, n := t.m.chunk(i)
+			t.stored.Add(int64(n))
+			continue
+		}
+		t.work <- i
+		missing++
+	}
+	t.remaining.Store(missing)
+	if t.onProgress != nil {
+		t.onProgress(t.stored.Load())
+	}
+	if missing == 0 {
+		close(t.done)
+	}
+}
+
+// stream sends the chunks it takes from the work queue on conn, keeping up to transferWindow of them
+// unacknowledged, until every chunk is stored. On failure its unacknowledged chunks are queued again.
+func (t *transfer) stream(conn *Conn) error {
+	var inflight []int
+	defer func() {
+		for _, i := range inflight {
+			t.work <- i
+		}
+	}()
+
+	buf := bsPool.GetLarge(t.m.ChunkSize + 5)
+	defer bsPool.PutLarge(buf)
+	for {
+		for len(inflight) < transferWindow {
+			i, ok, err := t.next(len(inflight) == 0)
+			if err != nil || (!ok && len(inflight) == 0) {
+				return err
+			}
+			if !ok {
+				break
+			}
+			inflight = append(inflight, i)
+			if err := t.sendChunk(conn, buf, i); err != nil {
+				return err
+			}
+		}
+
+		if err := t.ctx.Err(); err != nil {
+			return err
+		}
+		payload, err := recvTransferAck(conn, transferChunk)
+		if err != nil {
+			return err
+		}
+		if len(payload) != 5 || len(inflight) == 0 || binary.BigEndian.Uint32(payload) != uint32(inflight[0]) {
+			return ErrInvalidTransferMsg
+		}
+		i := inflight[0]
+		inflight = inflight[1:]
+		if payload[4] != transferOK {
+			if err := t.retry(i); err != nil {
+				return err
+			}
+			continue
+		}
+		t.ack(i)
+	}
+}
+
+// next takes a chunk from the work queue, waiting for one if block is set, ok is false once every
+// chunk is stored or if there is none to take without blocking.
+func (t *transfer) next(block bool) (i int, ok bool, err error) {
+	if err := t.ctx.Err(); err != nil {
+		return 0, false, err
+	}
+	if !block {
+		select {
+		case i = <-t.work:
+			return i, true, nil
+		default:
+			return 0, false, nil
+		}
+	}
+	select {
+	case i = <-t.work:
+		return i, true, nil
+	case <-t.done:
+		return 0, false, nil
+	case <-t.ctx.Done():
+		return 0, false, t.ctx.Err()
+	}
+}
+
+func (t *transfer) sendChunk(conn *Conn, buf []byte, i int) error {
+	off, n := t.m.chunk(i)
+	buf = buf[:5+n]
+	buf[0] = transferChunk
+	binary.BigEndian.PutUint32(buf[1:5], uint32(i))
+	if _, err := t.r.ReadAt(buf[5:], off); err != nil && !(errors.Is(err, io.EOF) && off+int64(n) == t.m.Size) {
+		return fmt.Errorf("failed read chunk %d: %w", i, err)
+	}
+	return conn.SendMsg(MsgTypeData, buf)
+}
+
+func (t *transfer) ack(i int) {
+	_, n := t.m.chunk(i)
+	stored := t.stored.Add(int64(n))
+	if t.onProgress != nil {
+		t.onProgress(stored)
+	}
+	if t.remaining.Add(-1) == 0 {
+		close(t.done)
+	}
+}
+
+// retry queues a chunk which failed verification again, unless it failed too many times already.
+func (t *transfer) retry(i int) error {
+	t.mu.Lock()
+	if t.retries == nil {
+		t.retries = make(map[int]int)
+	}
+	t.retries[i]++
+	retries := t.retries[i]
+	t.mu.Unlock()
+	if retries > transferRetries {
+		return fmt.Errorf("%w: chunk %d", ErrChunkCorrupted, i)
+	}
+	t.work <- i
+	return nil
+}
+
+// SendFile sends the file of the manifest to one of the alive servers of the pool, which must be a
+// TransferServer, see SendFile. The server is picked by the balancer with the manifest ID as key, so with
+// ConsistentHash sending the file again resumes the transfer on the same server.
+// The chunks are sent in parallel over dedicated connections to the server, dialed for the transfer and
+// closed afterward, so the connections returned by Get are left alone and no acknowledgement outlives
+// a failed transfer.
+func (p *Pool) SendFile(ctx context.Context, m *Manifest, r io.ReaderAt, onProgress func(stored int64)) error {
+	alive := p.alive()
+	if len(alive) == 0 {
+		return ErrNoAliveConn
+	}
+	pc := p.balancer.Pick(alive, m.ID)
+	conns := make([]*Conn, transferConns)
+	errs := make([]error, transferConns)
+	var wg sync.WaitGroup
+	for i := range conns {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			conns[i], errs[i] = DialWithContext(ctx, pc.Addr, p.cfg)
+		}()
+	}
+	wg.Wait()
+
+	var dialed []*Conn
+	for _, conn := range conns {
+		if conn != nil {
+			dialed = append(dialed, conn)
+			defer conn.Close()
+		}
+	}
+	if len(dialed) == 0 {
+		return errors.Join(errs...)
+	}
+	return SendFile(ctx, dialed, m, r, onProgress)
+}
+
+// TransferStore stores the files received by a TransferServer.
+type TransferStore interface {
+	// Open returns the file of the manifest, the same file for the same manifest ID until it is complete,
+	// so concurrent transfers of the file share it.
+	Open(m *Manifest) (TransferFile, error)
+}
+
+// TransferFile is a file being received, it must be safe for concurrent use.
+type TransferFile interface {
+	// Manifest returns the manifest of the file.
+	Manifest() *Manifest
+	// Stored returns which chunks are stored.
+	Stored() []bool
+	// WriteChunk stores the i-th chunk, which has been verified.
+	WriteChunk(i int, data []byte) error
+	// Complete finalizes the file, it returns ErrTransferIncomplete if some chunks aren't stored.
+	Complete() error
+}
+
+// TransferServer receives the files sent by SendFile into a TransferStore.
+// It is a Handler, and its HandleMsg can be registered for MsgTypeData on a Router too.
+type TransferServer struct {
+	store  TransferStore
+	router *Router
+}
+
+// transferFile is the file being received by a session.
+var transferFile = NewAttr[TransferFile]("transfer_file")
+
+// NewTransferServer returns a TransferServer storing the files into store.
+func NewTransferServer(store TransferStore) *TransferServer {
+	t := &TransferServer{store: store, router: NewRouter()}
+	t.router.Handle(MsgTypeData, t.HandleMsg)
+	return t
+}
+
+// HandleConn implements Handler.
+func (t *TransferServer) HandleConn(conn *Conn, session *Session) error {
+	return t.router.HandleConn(conn, session)
+}
+
+// HandleMsg handles a MsgTypeData message of a transfer.
+func (t *TransferServer) HandleMsg(msg *Message) error {
+	if len(msg.Payload) == 0 {
+		return t.refuse(msg, ErrInvalidTransferMsg)
+	}
+	switch kind, data := msg.Payload[0], msg.Payload[1:]; kind {
+	case transferManifest:
+		var m Manifest
+		if err := json.Unmarshal(data, &m); err != nil {
+			return t.refuse(msg, fmt.Errorf("%w: %w", ErrInvalidManifest, err))
+		}
+		if err := m.Validate(); err != nil {
+			return t.refuse(msg, err)
+		}
+		f, err := t.store.Open(&m)
+		if err != nil {
+			return t.refuse(msg, err)
+		}
+		transferFile.Set(msg.Session, f)
+		stored := f.Stored()
+		bitmap := make([]byte, 1+(len(stored)+7)/8)
+		bitmap[0] = transferManifest
+		for i, ok := range stored {
+			if ok {
+				bitmap[1+i/8] |= 1 << (i % 8)
+			}
+		}
+		return msg.Reply(MsgTypeAck, bitmap)
+
+	case transferChunk:
+		f, m, err := t.file(msg)
+		if err != nil {
+			return t.refuse(msg, err)
+		}
+		if len(data) < 4 || int(binary.BigEndian.Uint32(data)) >= m.NumChunks() {
+			return t.refuse(msg, ErrInvalidTransferMsg)
+		}
+		i := int(binary.BigEndian.Uint32(data))
+		ack := []byte{transferChunk, 0, 0, 0, 0, transferOK}
+		copy(ack[1:5], data[:4])
+		if !m.verify(i, data[4:]) {
+			ack[5] = transferCorrupted
+		} else if err := f.WriteChunk(i, data[4:]); err != nil {
+			return t.refuse(msg, err)
+		}
+		return msg.Reply(MsgTypeAck, ack)
+
+	case transferFinish:
+		f, _, err := t.file(msg)
+		if err != nil {
+			return t.refuse(msg, err)
+		}
+		status := transferOK
+		if err := f.Complete(); errors.Is(err, ErrTransferIncomplete) {
+			status = transferIncomplete
+		} else if err != nil {
+			return t.refuse(msg, err)
+		}
+		transferFile.Delete(msg.Session)
+		return msg.Reply(MsgTypeAck, []byte{transferFinish, status})
+	}
+	return t.refuse(msg, ErrInvalidTransferMsg)
+}
+
+// file returns the file being received by the session.
+func (t *TransferServer) file(msg *Message) (TransferFile, *Manifest, error) {
+	f, ok := transferFile.Get(msg.Session)
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: no manifest", ErrInvalidManifest)
+	}
+	return f, f.Manifest(), nil
+}
+
+// refuse replies the error to the sender and closes the connection.
+func (t *TransferServer) refuse(msg *Message, err error) error {
+	_ = msg.Reply(MsgTypeError, []byte(err.Error()))
+	return err
+}
@@ -0,0 +1,182 @@
+package kcp
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// DirStore is a TransferStore writing the files into a directory. A file being received is kept
+// in <id>.part, with its manifest in <id>.manifest and the chunks stored so far in <id>.chunks,
+// so a transfer can be resumed after a restart. Once complete it is renamed to its name.
+// The progress of the files being received is held in memory, so the concurrent transfers of a file must
+// go through the same DirStore, and a directory mustn't be used by several DirStores at the same time.
+type DirStore struct {
+	dir   string
+	mu    sync.Mutex
+	files map[string]*dirFile
+}
+
+// NewDirStore returns a DirStore writing into dir, which is created if needed.
+func NewDirStore(dir string) (*DirStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed create %s: %w", dir, err)
+	}
+	return &DirStore{dir: dir, files: make(map[string]*dirFile)}, nil
+}
+
+// Open implements TransferStore.
+func (s *DirStore) Open(m *Manifest) (TransferFile, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if f := s.files[m.ID]; f != nil {
+		return f, nil
+	}
+	f, err := s.open(m)
+	if err != nil {
+		return nil, err
+	}
+	s.files[m.ID] = f
+	return f, nil
+}
+
+// Close closes the files being received, they can be resumed by another DirStore.
+func (s *DirStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var errs []error
+	for id, f := range s.files {
+		f.mu.Lock()
+		errs = append(errs, f.close())
+		f.mu.Unlock()
+		delete(s.files, id)
+	}
+	return errors.Join(errs...)
+}
+
+func (s *DirStore) path(id, ext string) string {
+	return filepath.Join(s.dir, id+ext)
+}
+
+// open opens the files of the manifest, the progress of a previous transfer is kept if its manifest is the same.
+func (s *DirStore) open(m *Manifest) (*dirFile, error) {
+	manifest, err := json.Marshal(m)
+	if err != nil {
+		return nil, fmt.Errorf("failed json marshal: %w", err)
+	}
+	flag := os.O_RDWR | os.O_CREATE
+	prev, err := os.ReadFile(s.path(m.ID, ".manifest"))
+	if _, statErr := os.Stat(s.path(m.ID, ".part")); err != nil || statErr != nil || !bytes.Equal(prev, manifest) {
+		if err := os.WriteFile(s.path(m.ID, ".manifest"), manifest, 0o644); err != nil {
+			return nil, err
+		}
+		flag |= os.O_TRUNC
+	}
+
+	data, err := os.OpenFile(s.path(m.ID, ".part"), flag, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	chunks, err := os.OpenFile(s.path(m.ID, ".chunks"), flag, 0o644)
+	if err != nil {
+		data.Close()
+		return nil, err
+	}
+	stored := make([]byte, m.NumChunks())
+	if _, err := chunks.ReadAt(stored, 0); err != nil && !errors.Is(err, io.EOF) {
+		data.Close()
+		chunks.Close()
+		return nil, err
+	}
+	f := &dirFile{store: s, m: m, data: data, chunks: chunks, stored: make([]bool, len(stored))}
+	for i, b := range stored {
+		f.stored[i] = b == 1
+	}
+	return f, nil
+}
+
+type dirFile struct {
+	store  *DirStore
+	m      *Manifest
+	mu     sync.Mutex
+	data   *os.File
+	chunks *os.File // one byte per chunk, 1 once stored
+	stored []bool
+	done   bool
+}
+
+func (f *dirFile) Manifest() *Manifest {
+	return f.m
+}
+
+func (f *dirFile) Stored() []bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	stored := make([]bool, len(f.stored))
+	copy(stored, f.stored)
+	return stored
+}
+
+func (f *dirFile) WriteChunk(i int, data []byte) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.done || f.stored[i] {
+		return nil
+	}
+	off, _ := f.m.chunk(i)
+	if _, err := f.data.WriteAt(data, off); err != nil {
+		return err
+	}
+	// The chunk is marked once its data is written, a chunk interrupted in between is sent again.
+	if _, err := f.chunks.WriteAt([]byte{1}, int64(i)); err != nil {
+		return err
+	}
+	f.stored[i] = true
+	return nil
+}
+
+func (f *dirFile) Complete() error {
+	if err := f.complete(); err != nil {
+		return err
+	}
+	s := f.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.files[f.m.ID] == f {
+		delete(s.files, f.m.ID)
+	}
+	return nil
+}
+
+func (f *dirFile) complete() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.done {
+		return nil
+	}
+	for _, ok := range f.stored {
+		if !ok {
+			return ErrTransferIncomplete
+		}
+	}
+	if err := f.close(); err != nil {
+		return err
+	}
+	s := f.store
+	if err := os.Rename(s.path(f.m.ID, ".part"), filepath.Join(s.dir, f.m.Name)); err != nil {
+		return err
+	}
+	_ = os.Remove(s.path(f.m.ID, ".chunks"))
+	_ = os.Remove(s.path(f.m.ID, ".manifest"))
+	f.done = true
+	return nil
+}
+
+func (f *dirFile) close() error {
+	return errors.Join(f.data.Close(), f.chunks.Close())
+}
@@ -0,0 +1,217 @@
+package kcp
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testChunkSize = 64 << 10
+
+// countingStore counts the chunks written and fails once limit of them are, if limit > 0.
+// The writes wait for block to be closed, if not nil.
+type countingStore struct {
+	TransferStore
+	limit   int64
+	block   chan struct{}
+	written atomic.Int64
+}
+
+type countingFile struct {
+	TransferFile
+	store *countingStore
+}
+
+func (s *countingStore) Open(m *Manifest) (TransferFile, error) {
+	f, err := s.TransferStore.Open(m)
+	if err != nil {
+		return nil, err
+	}
+	return &countingFile{TransferFile: f, store: s}, nil
+}
+
+func (f *countingFile) WriteChunk(i int, data []byte) error {
+	if f.store.block != nil {
+		<-f.store.block
+	}
+	if n := f.store.written.Add(1); f.store.limit > 0 && n > f.store.limit {
+		return errors.New("disk full")
+	}
+	return f.TransferFile.WriteChunk(i, data)
+}
+
+// corruptReader corrupts the chunk at the given offset the first time it is read.
+type corruptReader struct {
+	*bytes.Reader
+	off  int64
+	once sync.Once
+}
+
+func (r *corruptReader) ReadAt(p []byte, off int64) (int, error) {
+	n, err := r.Reader.ReadAt(p, off)
+	if off == r.off {
+		r.once.Do(func() { p[0] ^= 0xff })
+	}
+	return n, err
+}
+
+func randomFile(t *testing.T, size int) ([]byte, *Manifest) {
+	data := make([]byte, size)
+	_, _ = rand.Read(data)
+	m, err := NewManifest("file.bin", bytes.NewReader(data), int64(size), testChunkSize)
+	require.NoError(t, err)
+	return data, m
+}
+
+func TestManifest(t *testing.T) {
+	data, m := randomFile(t, 3*testChunkSize+10)
+	require.Equal(t, 4, m.NumChunks())
+	require.NoError(t, m.Validate())
+	require.True(t, m.verify(3, data[3*testChunkSize:]))
+	require.False(t, m.verify(2, data[3*testChunkSize:]))
+
+	bad := *m
+	bad.Name = "../file.bin"
+	require.ErrorIs(t, bad.Validate(), ErrInvalidManifest)
+	bad = *m
+	bad.Chunks = append([]string{m.Chunks[1]}, m.Chunks[1:]...)
+	require.ErrorIs(t, bad.Validate(), ErrInvalidManifest)
+
+	empty, err := NewManifest("empty", bytes.NewReader(nil), 0, 0)
+	require.NoError(t, err)
+	require.Zero(t, empty.NumChunks())
+}
+
+func TestSendFile(t *testing.T) {
+	// Every server has its own store, the file goes to the server of its ID.
+	pool := NewPool(nil, WithBalancer(ConsistentHash()))
+	defer pool.Close()
+	dirs := make(map[string]string)
+	for i := 0; i < 2; i++ {
+		dir := t.TempDir()
+		store, err := NewDirStore(dir)
+		require.NoError(t, err)
+		defer store.Close()
+		addr := startServer(t, nil, NewTransferServer(store)).Addr().String()
+		require.NoError(t, pool.Add(addr))
+		dirs[addr] = dir
+	}
+
+	data, m := randomFile(t, 20*testChunkSize+123)
+	var progress atomic.Int64
+	r := &corruptReader{Reader: bytes.NewReader(data), off: 5 * testChunkSize}
+	require.NoError(t, pool.SendFile(context.Background(), m, r, func(stored int64) {
+		progress.Store(stored)
+	}))
+	require.Equal(t, m.Size, progress.Load())
+
+	var received int
+	for _, dir := range dirs {
+		got, err := os.ReadFile(filepath.Join(dir, m.Name))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		require.NoError(t, err)
+		require.Equal(t, data, got)
+		received++
+		leftovers, err := filepath.Glob(filepath.Join(dir, m.ID+".*"))
+		require.NoError(t, err)
+		require.Empty(t, leftovers)
+	}
+	require.Equal(t, 1, received)
+
+	// The transfer ran on its own connections, those of the pool only get their own replies.
+	conn, err := pool.Get("")
+	require.NoError(t, err)
+	_, err = conn.Ping(time.Second)
+	require.NoError(t, err)
+}
+
+func TestSendFile_Resume(t *testing.T) {
+	dir := t.TempDir()
+	data, m := randomFile(t, 10*testChunkSize)
+
+	// The first transfer fails after 4 chunks are stored.
+	store, err := NewDirStore(dir)
+	require.NoError(t, err)
+	failing := &countingStore{TransferStore: store, limit: 4}
+	conn, err := Dial(startServer(t, nil, NewTransferServer(failing)).Addr().String(), nil)
+	require.NoError(t, err)
+	err = SendFile(context.Background(), []*Conn{conn}, m, bytes.NewReader(data), nil)
+	require.Error(t, err)
+	conn.Close()
+	require.NoError(t, store.Close())
+
+	// Another store resumes from the chunks stored on disk.
+	store, err = NewDirStore(dir)
+	require.NoError(t, err)
+	defer store.Close()
+	counting := &countingStore{TransferStore: store}
+	conn, err = Dial(startServer(t, nil, NewTransferServer(counting)).Addr().String(), nil)
+	require.NoError(t, err)
+	defer conn.Close()
+	var first int64 = -1
+	require.NoError(t, SendFile(context.Background(), []*Conn{conn}, m, bytes.NewReader(data), func(stored int64) {
+		if first < 0 {
+			first = stored
+		}
+	}))
+	require.Equal(t, int64(4*testChunkSize), first)
+	require.Equal(t, int64(6), counting.written.Load())
+
+	received, err := os.ReadFile(filepath.Join(dir, m.Name))
+	require.NoError(t, err)
+	require.Equal(t, data, received)
+}
+
+func TestSendFile_Cancel(t *testing.T) {
+	store, err := NewDirStore(t.TempDir())
+	require.NoError(t, err)
+	defer store.Close()
+	blocked := &countingStore{TransferStore: store, block: make(chan struct{})}
+	defer close(blocked.block)
+	conn, err := Dial(startServer(t, nil, NewTransferServer(blocked)).Addr().String(), nil)
+	require.NoError(t, err)
+
+	// The transfer waiting for an acknowledgement gives up once ctx is done, and closes its connection.
+	data, m := randomFile(t, 4*testChunkSize)
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err = SendFile(ctx, []*Conn{conn}, m, bytes.NewReader(data), nil)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Less(t, time.Since(start), 2*time.Second)
+	require.Error(t, conn.SendMsg(MsgTypePing, nil))
+}
+
+func TestSendFile_Errors(t *testing.T) {
+	_, m := randomFile(t, testChunkSize)
+	require.ErrorIs(t, SendFile(context.Background(), nil, m, nil, nil), ErrNoTransferConn)
+
+	store, err := NewDirStore(t.TempDir())
+	require.NoError(t, err)
+	defer store.Close()
+	conn, err := Dial(startServer(t, nil, NewTransferServer(store)).Addr().String(), nil)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	bad := *m
+	bad.Name = "other.bin"
+	require.ErrorIs(t, SendFile(context.Background(), []*Conn{conn}, &bad, nil, nil), ErrInvalidManifest)
+
+	// The receiver refuses chunks before the manifest.
+	require.NoError(t, conn.SendMsg(MsgTypeData, []byte{transferChunk, 0, 0, 0, 0}))
+	msgType, payload, err := conn.RecvMsgWithTimeout(time.Second)
+	require.NoError(t, err)
+	require.Equal(t, MsgTypeError, msgType)
+	require.Contains(t, string(payload), "no manifest")
+}